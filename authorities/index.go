@@ -0,0 +1,271 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorities
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/deciphernow/nautls/identities"
+	"github.com/pkg/errors"
+)
+
+// Status defines the status of a certificate in the index of a store.
+type Status int
+
+const (
+	// Valid indicates that a certificate has not been revoked and has not expired.
+	Valid Status = iota
+
+	// Revoked indicates that a certificate has been revoked.
+	Revoked
+
+	// Expired indicates that a certificate has not been revoked but has expired.
+	Expired
+)
+
+const (
+	// shortTimeFormat defines the UTCTime format used by the index for times before 2050.
+	shortTimeFormat = "060102150405Z"
+
+	// longTimeFormat defines the GeneralizedTime format used by the index for times in or after 2050.
+	longTimeFormat = "20060102150405Z"
+)
+
+var (
+	// reasons maps revocation reasons to the names used by the index of openssl's ca command.
+	reasons = map[identities.RevocationReason]string{
+		identities.Unspecified:          "unspecified",
+		identities.KeyCompromise:        "keyCompromise",
+		identities.CACompromise:         "CACompromise",
+		identities.AffiliationChanged:   "affiliationChanged",
+		identities.Superseded:           "superseded",
+		identities.CessationOfOperation: "cessationOfOperation",
+		identities.CertificateHold:      "certificateHold",
+		identities.PrivilegeWithdrawn:   "privilegeWithdrawn",
+		identities.AACompromise:         "AACompromise",
+	}
+)
+
+// Entry represents a certificate in the index of a store.
+type Entry struct {
+	NotAfter     time.Time
+	Reason       identities.RevocationReason
+	RevokedAt    time.Time
+	SerialNumber *big.Int
+	Subject      string
+}
+
+// Status returns the status of the entry at the provided time.
+func (e *Entry) Status(now time.Time) Status {
+
+	if !e.RevokedAt.IsZero() {
+		return Revoked
+	}
+
+	if now.After(e.NotAfter) {
+		return Expired
+	}
+
+	return Valid
+}
+
+// String returns the entry as a line of the index in the format of openssl's ca command (i.e., the status, expiration,
+// revocation, serial number, file name and subject separated by tabs). Control characters in the subject (e.g., line
+// breaks that would split the entry across lines) are escaped as hex pairs (see RFC 4514 section 2.4).
+func (e *Entry) String() string {
+
+	status := "V"
+	revocation := ""
+
+	if !e.RevokedAt.IsZero() {
+		status = "R"
+		revocation = formatTime(e.RevokedAt)
+		if e.Reason != identities.Unspecified {
+			revocation = fmt.Sprintf("%s,%s", revocation, reasons[e.Reason])
+		}
+	}
+
+	return strings.Join([]string{status, formatTime(e.NotAfter), revocation, serialString(e.SerialNumber), "unknown", escapeControls(e.Subject)}, "\t")
+}
+
+// parseEntry parses a line of the index into an entry. Note that expired entries (i.e., a status of "E") are read as
+// valid entries as the status is computed from the expiration.
+func parseEntry(line string) (Entry, error) {
+
+	fields := strings.SplitN(line, "\t", 6)
+	if len(fields) != 6 {
+		return Entry{}, fmt.Errorf("error parsing index entry with [%d] fields", len(fields))
+	}
+
+	var entry Entry
+	var err error
+
+	entry.NotAfter, err = parseTime(fields[1])
+	if err != nil {
+		return Entry{}, errors.Wrapf(err, "error parsing expiration [%s]", fields[1])
+	}
+
+	serial, ok := new(big.Int).SetString(fields[3], 16)
+	if !ok {
+		return Entry{}, fmt.Errorf("error parsing serial number [%s]", fields[3])
+	}
+
+	entry.SerialNumber = serial
+	entry.Subject = fields[5]
+
+	switch fields[0] {
+	case "V", "E":
+		return entry, nil
+	case "R":
+	default:
+		return Entry{}, fmt.Errorf("error parsing index entry with unknown status [%s]", fields[0])
+	}
+
+	revocation := strings.SplitN(fields[2], ",", 2)
+
+	entry.RevokedAt, err = parseTime(revocation[0])
+	if err != nil {
+		return Entry{}, errors.Wrapf(err, "error parsing revocation [%s]", fields[2])
+	}
+
+	if len(revocation) == 2 {
+		entry.Reason, err = parseReason(revocation[1])
+		if err != nil {
+			return Entry{}, errors.Wrapf(err, "error parsing revocation [%s]", fields[2])
+		}
+	}
+
+	return entry, nil
+}
+
+// escapeControls escapes the control characters of a distinguished name as hex pairs (e.g., a line feed as "\0a").
+func escapeControls(name string) string {
+
+	var builder strings.Builder
+
+	for _, character := range name {
+
+		if !unicode.IsControl(character) {
+			builder.WriteRune(character)
+			continue
+		}
+
+		for _, octet := range []byte(string(character)) {
+			fmt.Fprintf(&builder, "\\%02x", octet)
+		}
+	}
+
+	return builder.String()
+}
+
+// readIndex reads the entries of an index file. Note that an index that does not exist is read as empty.
+func readIndex(path string) ([]Entry, error) {
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading index [%s]", path)
+	}
+
+	var entries []Entry
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for number := 1; scanner.Scan(); number++ {
+
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		entry, err := parseEntry(scanner.Text())
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing line [%d] of index [%s]", number, path)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "error scanning index [%s]", path)
+	}
+
+	return entries, nil
+}
+
+// writeIndex atomically replaces an index file with the provided entries.
+func writeIndex(path string, entries []Entry) error {
+
+	var buffer bytes.Buffer
+	for _, entry := range entries {
+		buffer.WriteString(entry.String())
+		buffer.WriteString("\n")
+	}
+
+	return writeAtomic(path, buffer.Bytes(), 0644)
+}
+
+// formatTime formats a time as UTCTime before 2050 and as GeneralizedTime otherwise (see RFC 5280 section 4.1.2.5).
+func formatTime(value time.Time) string {
+
+	value = value.UTC()
+
+	if value.Year() >= 2050 {
+		return value.Format(longTimeFormat)
+	}
+
+	return value.Format(shortTimeFormat)
+}
+
+// parseTime parses a time formatted as either UTCTime or GeneralizedTime.
+func parseTime(value string) (time.Time, error) {
+
+	if len(value) == len(longTimeFormat) {
+		return time.Parse(longTimeFormat, value)
+	}
+
+	return time.Parse(shortTimeFormat, value)
+}
+
+// parseReason parses the name of a revocation reason.
+func parseReason(value string) (identities.RevocationReason, error) {
+
+	for reason, name := range reasons {
+		if strings.EqualFold(name, value) {
+			return reason, nil
+		}
+	}
+
+	return identities.Unspecified, fmt.Errorf("unknown revocation reason [%s]", value)
+}
+
+// serialString returns the upper case hexadecimal representation of a serial number with an even number of digits.
+func serialString(serial *big.Int) string {
+
+	value := strings.ToUpper(serial.Text(16))
+	if len(value)%2 == 1 {
+		value = "0" + value
+	}
+
+	return value
+}
@@ -0,0 +1,140 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorities
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/deciphernow/nautls/identities"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEntry(t *testing.T) {
+
+	Convey("When Entry", t, func() {
+
+		notAfter := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		Convey(".String is invoked on a valid entry", func() {
+
+			entry := Entry{NotAfter: notAfter, SerialNumber: big.NewInt(0xabc), Subject: "CN=nautls.com"}
+
+			Convey("it returns the index line", func() {
+				So(entry.String(), ShouldEqual, "V\t300102030405Z\t\t0ABC\tunknown\tCN=nautls.com")
+			})
+		})
+
+		Convey(".String is invoked on an entry with line breaks in the subject", func() {
+
+			entry := Entry{NotAfter: notAfter, SerialNumber: big.NewInt(0xabc), Subject: "CN=nautls.com\nV\r"}
+
+			Convey("it returns a single index line with the line breaks escaped", func() {
+				So(entry.String(), ShouldEqual, "V\t300102030405Z\t\t0ABC\tunknown\tCN=nautls.com\\0aV\\0d")
+			})
+		})
+
+		Convey(".String is invoked on a revoked entry", func() {
+
+			entry := Entry{
+				NotAfter:     time.Date(2050, 1, 2, 3, 4, 5, 0, time.UTC),
+				Reason:       identities.KeyCompromise,
+				RevokedAt:    notAfter,
+				SerialNumber: big.NewInt(0xabc),
+				Subject:      "CN=nautls.com",
+			}
+
+			Convey("it returns the index line", func() {
+				So(entry.String(), ShouldEqual, "R\t20500102030405Z\t300102030405Z,keyCompromise\t0ABC\tunknown\tCN=nautls.com")
+			})
+
+			Convey("#parseEntry is invoked on the line", func() {
+
+				parsed, err := parseEntry(entry.String())
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("it returns the entry", func() {
+					So(parsed.NotAfter, ShouldEqual, entry.NotAfter)
+					So(parsed.Reason, ShouldEqual, entry.Reason)
+					So(parsed.RevokedAt, ShouldEqual, entry.RevokedAt)
+					So(parsed.SerialNumber, ShouldResemble, entry.SerialNumber)
+					So(parsed.Subject, ShouldEqual, entry.Subject)
+				})
+			})
+		})
+
+		Convey(".Status is invoked", func() {
+
+			entry := Entry{NotAfter: notAfter, SerialNumber: big.NewInt(1)}
+
+			Convey("before the expiration it returns valid", func() {
+				So(entry.Status(notAfter.Add(-time.Hour)), ShouldEqual, Valid)
+			})
+
+			Convey("after the expiration it returns expired", func() {
+				So(entry.Status(notAfter.Add(time.Hour)), ShouldEqual, Expired)
+			})
+
+			Convey("after a revocation it returns revoked", func() {
+				entry.RevokedAt = notAfter.Add(-time.Hour)
+				So(entry.Status(notAfter.Add(time.Hour)), ShouldEqual, Revoked)
+			})
+		})
+
+		Convey("#parseEntry is invoked", func() {
+
+			Convey("with too few fields", func() {
+
+				_, err := parseEntry("V\t300102030405Z\t\t0ABC")
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("with an unknown status", func() {
+
+				_, err := parseEntry("X\t300102030405Z\t\t0ABC\tunknown\tCN=nautls.com")
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("with an unknown reason", func() {
+
+				_, err := parseEntry("R\t300102030405Z\t300102030405Z,invalid\t0ABC\tunknown\tCN=nautls.com")
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("with an invalid serial number", func() {
+
+				_, err := parseEntry("V\t300102030405Z\t\tXYZ\tunknown\tCN=nautls.com")
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,49 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+// +build windows
+
+package authorities
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// lock acquires an exclusive lock on a file (creating it if needed), blocking until the lock is available, and returns
+// a function that releases the lock.
+func lock(path string) (func() error, error) {
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error opening lock [%s]", path)
+	}
+
+	overlapped := &windows.Overlapped{}
+
+	if err := windows.LockFileEx(windows.Handle(file.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, overlapped); err != nil {
+		file.Close()
+		return nil, errors.Wrapf(err, "error acquiring lock [%s]", path)
+	}
+
+	unlock := func() error {
+		defer file.Close()
+		return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, overlapped)
+	}
+
+	return unlock, nil
+}
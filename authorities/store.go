@@ -0,0 +1,428 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorities
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/deciphernow/nautls/identities"
+	"github.com/pkg/errors"
+)
+
+const (
+	// authoritiesFile defines the name of the file containing the authorities of the issuing identity.
+	authoritiesFile = "authorities.pem"
+
+	// certificateFile defines the name of the file containing the certificate of the issuing identity.
+	certificateFile = "ca.pem"
+
+	// certificatesDirectory defines the name of the directory containing the issued certificates.
+	certificatesDirectory = "certs"
+
+	// crlFile defines the name of the file containing the most recent certificate revocation list.
+	crlFile = "crl.pem"
+
+	// indexFile defines the name of the file containing the index of issued certificates.
+	indexFile = "index.txt"
+
+	// keyFile defines the name of the file containing the key of the issuing identity.
+	keyFile = "ca.key"
+
+	// lockFile defines the name of the file locked while the store is modified.
+	lockFile = ".lock"
+)
+
+// Store represents a certificate authority persisted to a directory with a layout along the lines of openssl's ca
+// command. The directory contains the certificate, key and authorities of the issuing identity, an index of every
+// issued certificate and its status (see Entry), the issued certificates named by their serial numbers and the most
+// recent CRL. The key of the issuing identity is encrypted with a passphrase such that it is never at rest unencrypted.
+// Every operation reads the index while holding an exclusive file lock such that multiple processes may issue and revoke
+// certificates from the same store concurrently.
+type Store struct {
+	directory string
+	identity  *identities.Identity
+}
+
+// Create initializes a store in a directory (creating it if needed) for an issuing identity whose key is encrypted with
+// the passphrase. The passphrase must be a URL (see identities.IdentityConfig.Passphrase) that points to a non-empty
+// passphrase. An error is returned if the directory already contains a store.
+func Create(directory string, identity *identities.Identity, passphrase string) (*Store, error) {
+
+	store := &Store{directory: directory, identity: identity}
+
+	if _, err := os.Stat(store.path(certificateFile)); err == nil {
+		return nil, fmt.Errorf("error creating store as [%s] already contains a store", directory)
+	}
+
+	if err := os.MkdirAll(store.path(certificatesDirectory), 0755); err != nil {
+		return nil, errors.Wrapf(err, "error creating store directory [%s]", directory)
+	}
+
+	_, err := identity.WriteEncrypted(store.path(certificateFile), store.path(keyFile), store.path(authoritiesFile), passphrase)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error writing identity to store [%s]", directory)
+	}
+
+	if err := writeIndex(store.path(indexFile), nil); err != nil {
+		return nil, errors.Wrapf(err, "error writing index to store [%s]", directory)
+	}
+
+	return store, nil
+}
+
+// Open opens an existing store in a directory decrypting the key of the issuing identity with the passphrase (see
+// Create).
+func Open(directory string, passphrase string) (*Store, error) {
+
+	store := &Store{directory: directory}
+
+	config := &identities.IdentityConfig{
+		Authorities: fileURL(store.path(authoritiesFile)),
+		Certificate: fileURL(store.path(certificateFile)),
+		Key:         fileURL(store.path(keyFile)),
+		Passphrase:  passphrase,
+	}
+
+	identity, err := config.Build()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading identity from store [%s]", directory)
+	}
+
+	store.identity = identity
+
+	return store, nil
+}
+
+// Identity returns the issuing identity of the store. Note that certificates issued or revoked directly by the identity
+// are not recorded in the store.
+func (s *Store) Identity() *identities.Identity {
+	return s.identity
+}
+
+// Issue returns a new identity issued by the store (see identities.Identity.Issue) and records the certificate in the
+// store. The serial number of the template is replaced with a random serial number that is unique within the store.
+func (s *Store) Issue(template identities.Template, algorithm identities.KeyAlgorithm, size int) (*identities.Identity, error) {
+
+	var identity *identities.Identity
+
+	err := s.record(func(serial *big.Int) (*x509.Certificate, error) {
+
+		var err error
+
+		template.SerialNumber = serial
+
+		identity, err = s.identity.Issue(template, algorithm, size)
+		if err != nil {
+			return nil, err
+		}
+
+		return identity.Certificate, nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error issuing certificate for [%s]", template.Subject.CommonName)
+	}
+
+	return identity, nil
+}
+
+// SignRequest returns a certificate for a certificate signing request signed by the store (see
+// identities.Identity.SignRequest) and records the certificate in the store. The serial number of the template is
+// replaced with a random serial number that is unique within the store.
+func (s *Store) SignRequest(request *x509.CertificateRequest, template identities.Template) (*x509.Certificate, error) {
+
+	var certificate *x509.Certificate
+
+	err := s.record(func(serial *big.Int) (*x509.Certificate, error) {
+
+		var err error
+
+		template.SerialNumber = serial
+
+		certificate, err = s.identity.SignRequest(request, template)
+
+		return certificate, err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error signing certificate request for [%s]", request.Subject.CommonName)
+	}
+
+	return certificate, nil
+}
+
+// Revoke marks a certificate issued by the store as revoked at the current time. An error is returned if the
+// certificate is not in the store or has already been revoked. Note that the revocation is included in CRLs created
+// after it is recorded (see CRL).
+func (s *Store) Revoke(serial *big.Int, reason identities.RevocationReason) error {
+
+	return s.locked(func() error {
+
+		entries, err := readIndex(s.path(indexFile))
+		if err != nil {
+			return err
+		}
+
+		for index := range entries {
+
+			if entries[index].SerialNumber.Cmp(serial) != 0 {
+				continue
+			}
+
+			if !entries[index].RevokedAt.IsZero() {
+				return fmt.Errorf("error revoking certificate [%s] as it has already been revoked", serialString(serial))
+			}
+
+			entries[index].Reason = reason
+			entries[index].RevokedAt = time.Now()
+
+			return writeIndex(s.path(indexFile), entries)
+		}
+
+		return fmt.Errorf("error revoking certificate [%s] as it is not in the store", serialString(serial))
+	})
+}
+
+// Entries returns the index entries of every certificate issued by the store in the order they were issued.
+func (s *Store) Entries() ([]Entry, error) {
+
+	var entries []Entry
+
+	err := s.locked(func() error {
+
+		var err error
+
+		entries, err = readIndex(s.path(indexFile))
+
+		return err
+	})
+
+	return entries, err
+}
+
+// Issued returns a value indicating whether a certificate with the provided serial number was issued by the store (e.g.,
+// for revocations.NewResponder).
+func (s *Store) Issued(serial *big.Int) (bool, error) {
+
+	entries, err := s.Entries()
+	if err != nil {
+		return false, errors.Wrapf(err, "error reading entries of store [%s]", s.directory)
+	}
+
+	for _, entry := range entries {
+		if entry.SerialNumber.Cmp(serial) == 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Certificate returns the certificate issued by the store with the provided serial number.
+func (s *Store) Certificate(serial *big.Int) (*x509.Certificate, error) {
+
+	path := s.certificatePath(serial)
+
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading certificate [%s]", path)
+	}
+
+	certificates, err := identities.DecodeCertificates(bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error decoding certificate [%s]", path)
+	}
+
+	if len(certificates) != 1 {
+		return nil, fmt.Errorf("expected one certificate in [%s] but found [%d]", path, len(certificates))
+	}
+
+	return certificates[0], nil
+}
+
+// CRL returns a certificate revocation list of the certificates revoked in the store signed by the issuing identity
+// (see identities.RevocationRegistry.CRL) and persists it as the most recent CRL of the store.
+func (s *Store) CRL(nextUpdate time.Duration) (*x509.RevocationList, error) {
+
+	var crl *x509.RevocationList
+
+	err := s.locked(func() error {
+
+		entries, err := readIndex(s.path(indexFile))
+		if err != nil {
+			return err
+		}
+
+		registry := identities.NewRevocationRegistry(s.identity)
+
+		for _, entry := range entries {
+			if !entry.RevokedAt.IsZero() {
+				revocation := identities.Revocation{Reason: entry.Reason, RevokedAt: entry.RevokedAt, SerialNumber: entry.SerialNumber}
+				if err := registry.Revoke(revocation); err != nil {
+					return err
+				}
+			}
+		}
+
+		crl, err = registry.CRL(nextUpdate)
+		if err != nil {
+			return err
+		}
+
+		return writeAtomic(s.path(crlFile), identities.EncodeCRL(crl), 0644)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating crl for store [%s]", s.directory)
+	}
+
+	return crl, nil
+}
+
+// CRLPath returns the path of the most recent CRL of the store.
+func (s *Store) CRLPath() string {
+	return s.path(crlFile)
+}
+
+// record allocates a unique serial number, invokes a function that signs a certificate with the serial number and
+// records the certificate in the store while holding the lock.
+func (s *Store) record(sign func(*big.Int) (*x509.Certificate, error)) error {
+
+	return s.locked(func() error {
+
+		entries, err := readIndex(s.path(indexFile))
+		if err != nil {
+			return err
+		}
+
+		serial, err := uniqueSerialNumber(entries)
+		if err != nil {
+			return err
+		}
+
+		certificate, err := sign(serial)
+		if err != nil {
+			return err
+		}
+
+		path := s.certificatePath(serial)
+		if err := writeAtomic(path, identities.EncodeCertificates([]*x509.Certificate{certificate}), 0644); err != nil {
+			return errors.Wrapf(err, "error writing certificate [%s]", path)
+		}
+
+		entry := Entry{
+			NotAfter:     certificate.NotAfter,
+			SerialNumber: certificate.SerialNumber,
+			Subject:      certificate.Subject.String(),
+		}
+
+		return writeIndex(s.path(indexFile), append(entries, entry))
+	})
+}
+
+// locked invokes a function while holding the lock of the store.
+func (s *Store) locked(function func() error) error {
+
+	unlock, err := lock(s.path(lockFile))
+	if err != nil {
+		return errors.Wrapf(err, "error locking store [%s]", s.directory)
+	}
+
+	err = function()
+
+	if unlockErr := unlock(); unlockErr != nil && err == nil {
+		err = errors.Wrapf(unlockErr, "error unlocking store [%s]", s.directory)
+	}
+
+	return err
+}
+
+// certificatePath returns the path of the certificate with the provided serial number.
+func (s *Store) certificatePath(serial *big.Int) string {
+	return s.path(certificatesDirectory, fmt.Sprintf("%s.pem", serialString(serial)))
+}
+
+// path returns the path of a file within the store.
+func (s *Store) path(elements ...string) string {
+	return filepath.Join(append([]string{s.directory}, elements...)...)
+}
+
+// uniqueSerialNumber returns a random serial number that is not used by any of the entries.
+func uniqueSerialNumber(entries []Entry) (*big.Int, error) {
+
+	for {
+
+		serial, err := identities.RandomSerialNumber()
+		if err != nil {
+			return nil, errors.Wrap(err, "error generating serial number")
+		}
+
+		unique := true
+		for _, entry := range entries {
+			if entry.SerialNumber.Cmp(serial) == 0 {
+				unique = false
+				break
+			}
+		}
+
+		if unique {
+			return serial, nil
+		}
+	}
+}
+
+// writeAtomic writes a file by writing a temporary file in the same directory and renaming it over the file.
+func writeAtomic(path string, content []byte, permission os.FileMode) error {
+
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.Wrapf(err, "error creating temporary file for [%s]", path)
+	}
+
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return errors.Wrapf(err, "error writing temporary file for [%s]", path)
+	}
+
+	if err := file.Close(); err != nil {
+		return errors.Wrapf(err, "error closing temporary file for [%s]", path)
+	}
+
+	if err := os.Chmod(file.Name(), permission); err != nil {
+		return errors.Wrapf(err, "error setting permissions of [%s]", path)
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return errors.Wrapf(err, "error renaming temporary file to [%s]", path)
+	}
+
+	return nil
+}
+
+// fileURL returns a file URL for a path.
+func fileURL(path string) string {
+
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		absolute = path
+	}
+
+	return fmt.Sprintf("file://%s", absolute)
+}
@@ -0,0 +1,268 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorities
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/deciphernow/nautls/identities"
+	"github.com/deciphernow/nautls/internal/temporary"
+	"github.com/deciphernow/nautls/internal/tests/identitytest"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStore(t *testing.T) {
+
+	Convey("When Store", t, func() {
+
+		temporary.WithDirectory(func(directory string) (interface{}, error) {
+
+			authority := identitytest.MustAuthority("NauTLS (Root)", t)
+			passphrase := "base64:///cGFzc3BocmFzZQ=="
+
+			store, err := Create(directory, authority, passphrase)
+			So(err, ShouldBeNil)
+
+			Convey(".Create is invoked on an existing store", func() {
+
+				_, err := Create(directory, authority, passphrase)
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey(".Issue is invoked", func() {
+
+				identity, err := store.Issue(identitytest.MustServerTemplate("nautls.com", t), identities.ECDSA, 256)
+				So(err, ShouldBeNil)
+
+				Convey("it returns an identity issued by the authority", func() {
+					So(identity.Certificate.CheckSignatureFrom(authority.Certificate), ShouldBeNil)
+				})
+
+				Convey("it records the certificate in the index", func() {
+
+					entries, err := store.Entries()
+					So(err, ShouldBeNil)
+
+					So(entries, ShouldHaveLength, 1)
+					So(entries[0].SerialNumber, ShouldResemble, identity.Certificate.SerialNumber)
+					So(entries[0].Subject, ShouldEqual, "CN=nautls.com")
+					So(entries[0].Status(time.Now()), ShouldEqual, Valid)
+				})
+
+				Convey("it persists the certificate", func() {
+
+					certificate, err := store.Certificate(identity.Certificate.SerialNumber)
+					So(err, ShouldBeNil)
+
+					So(certificate.Equal(identity.Certificate), ShouldBeTrue)
+				})
+
+				Convey(".Issued is invoked", func() {
+
+					issued, err := store.Issued(identity.Certificate.SerialNumber)
+					So(err, ShouldBeNil)
+
+					unknown, err := store.Issued(authority.Certificate.SerialNumber)
+					So(err, ShouldBeNil)
+
+					Convey("it reports only the certificates issued by the store", func() {
+						So(issued, ShouldBeTrue)
+						So(unknown, ShouldBeFalse)
+					})
+				})
+
+				Convey(".Revoke is invoked", func() {
+
+					err := store.Revoke(identity.Certificate.SerialNumber, identities.KeyCompromise)
+
+					Convey("it returns a nil error", func() {
+						So(err, ShouldBeNil)
+					})
+
+					Convey("it marks the entry as revoked", func() {
+
+						entries, err := store.Entries()
+						So(err, ShouldBeNil)
+
+						So(entries[0].Status(time.Now()), ShouldEqual, Revoked)
+						So(entries[0].Reason, ShouldEqual, identities.KeyCompromise)
+					})
+
+					Convey("and .Revoke is invoked again it returns a non-nil error", func() {
+						So(store.Revoke(identity.Certificate.SerialNumber, identities.KeyCompromise), ShouldNotBeNil)
+					})
+
+					Convey("and .CRL is invoked on a reopened store", func() {
+
+						reopened, err := Open(directory, passphrase)
+						So(err, ShouldBeNil)
+
+						crl, err := reopened.CRL(time.Hour)
+						So(err, ShouldBeNil)
+
+						Convey("it returns a crl with the revocation", func() {
+							So(crl.RevokedCertificateEntries, ShouldHaveLength, 1)
+							So(crl.RevokedCertificateEntries[0].SerialNumber, ShouldResemble, identity.Certificate.SerialNumber)
+							So(crl.RevokedCertificateEntries[0].ReasonCode, ShouldEqual, int(identities.KeyCompromise))
+						})
+
+						Convey("it persists the crl", func() {
+
+							persisted, err := identities.LoadCRL("file://" + reopened.CRLPath())
+							So(err, ShouldBeNil)
+
+							So(persisted.Raw, ShouldResemble, crl.Raw)
+						})
+					})
+				})
+			})
+
+			Convey(".SignRequest is invoked", func() {
+
+				key, err := identities.GenerateKey(identities.ECDSA, 256)
+				So(err, ShouldBeNil)
+
+				request, err := identities.NewRequest(identitytest.MustServerTemplate("nautls.com", t), key)
+				So(err, ShouldBeNil)
+
+				certificate, err := store.SignRequest(request, identitytest.MustServerTemplate("nautls.com", t))
+				So(err, ShouldBeNil)
+
+				Convey("it records the certificate in the index", func() {
+
+					entries, err := store.Entries()
+					So(err, ShouldBeNil)
+
+					So(entries, ShouldHaveLength, 1)
+					So(entries[0].SerialNumber, ShouldResemble, certificate.SerialNumber)
+				})
+			})
+
+			Convey(".Issue is invoked with a line break in the subject", func() {
+
+				template := identitytest.MustServerTemplate("nautls.com", t)
+				template.Subject.CommonName = "nautls.com\nV\t"
+
+				_, err := store.Issue(template, identities.ECDSA, 256)
+				So(err, ShouldBeNil)
+
+				Convey("it records a single entry with the line break escaped", func() {
+
+					entries, err := store.Entries()
+					So(err, ShouldBeNil)
+
+					So(entries, ShouldHaveLength, 1)
+					So(entries[0].Subject, ShouldEqual, "CN=nautls.com\\0aV\\09")
+				})
+			})
+
+			Convey(".Revoke is invoked on an unknown certificate", func() {
+
+				err := store.Revoke(identitytest.MustAuthority("NauTLS (Other)", t).Certificate.SerialNumber, identities.Unspecified)
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey(".Issue is invoked concurrently from multiple stores", func() {
+
+				var group sync.WaitGroup
+
+				for index := 0; index < 8; index++ {
+
+					opened, err := Open(directory, passphrase)
+					So(err, ShouldBeNil)
+
+					group.Add(1)
+					go func(store *Store) {
+						defer group.Done()
+						store.Issue(identitytest.MustServerTemplate("nautls.com", t), identities.ECDSA, 256)
+					}(opened)
+				}
+
+				group.Wait()
+
+				Convey("it records every certificate", func() {
+
+					entries, err := store.Entries()
+					So(err, ShouldBeNil)
+
+					So(entries, ShouldHaveLength, 8)
+
+					files, err := filepath.Glob(filepath.Join(directory, certificatesDirectory, "*.pem"))
+					So(err, ShouldBeNil)
+					So(files, ShouldHaveLength, 8)
+				})
+			})
+
+			Convey(".Create is invoked without a passphrase", func() {
+
+				_, err := Create(filepath.Join(directory, "unencrypted"), authority, "")
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey(".Open is invoked with another passphrase", func() {
+
+				_, err := Open(directory, "base64:///b3RoZXI=")
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("the key is encrypted", func() {
+
+				bytes, err := ioutil.ReadFile(filepath.Join(directory, keyFile))
+				So(err, ShouldBeNil)
+
+				block, _ := pem.Decode(bytes)
+				So(block.Type, ShouldEqual, "ENCRYPTED PRIVATE KEY")
+			})
+
+			Convey(".Open is invoked on a directory without a store", func() {
+
+				_, err := Open(filepath.Join(directory, "missing"), passphrase)
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("the key is only readable by the owner", func() {
+
+				info, err := os.Stat(filepath.Join(directory, keyFile))
+				So(err, ShouldBeNil)
+
+				So(info.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+			})
+
+			return nil, nil
+		})
+	})
+}
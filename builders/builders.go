@@ -15,23 +15,33 @@
 package builders
 
 import (
+	"crypto"
 	"crypto/tls"
 	"crypto/x509"
+	"fmt"
 	"net/url"
+	"time"
 
+	"github.com/deciphernow/nautls/identities"
 	"github.com/deciphernow/nautls/internal/urls"
+	"github.com/deciphernow/nautls/lints"
 	"github.com/pkg/errors"
 )
 
-// BuildCertificatePool provides a utility function for creating a certificate pool from an array of URLs. Note that if
-// the array of URLs is empty the system certificates will be used.
-func BuildCertificatePool(certificateURLs []string) (*x509.CertPool, error) {
+// BuildCertificatePool provides a utility function for creating a certificate pool from an array of URLs and any
+// additional certificates. Note that if both the array of URLs and the additional certificates are empty the system
+// certificates will be used.
+func BuildCertificatePool(certificateURLs []string, certificates ...*x509.Certificate) (*x509.CertPool, error) {
 
-	if len(certificateURLs) == 0 {
+	if len(certificateURLs) == 0 && len(certificates) == 0 {
 		return x509.SystemCertPool()
 	}
 
 	pool := x509.NewCertPool()
+	for _, certificate := range certificates {
+		pool.AddCert(certificate)
+	}
+
 	for _, certificate := range certificateURLs {
 
 		bytes, err := readResource(certificate)
@@ -47,8 +57,35 @@ func BuildCertificatePool(certificateURLs []string) (*x509.CertPool, error) {
 	return pool, nil
 }
 
-// BuildCertificates provides a utility function for loading a certificate from certificate and key URLs.
-func BuildCertificates(certificateURL string, keyURL string) ([]tls.Certificate, error) {
+// BuildCertificateList provides a utility function for loading the certificates from an array of URLs of PEM encoded
+// certificates and any additional certificates.
+func BuildCertificateList(certificateURLs []string, certificates ...*x509.Certificate) ([]*x509.Certificate, error) {
+
+	result := append([]*x509.Certificate{}, certificates...)
+
+	for _, certificateURL := range certificateURLs {
+
+		bytes, err := readResource(certificateURL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading certificate [%s]", certificateURL)
+		}
+
+		decoded, err := identities.DecodeCertificates(bytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error decoding certificate [%s]", certificateURL)
+		}
+
+		result = append(result, decoded...)
+	}
+
+	return result, nil
+}
+
+// BuildCertificates provides a utility function for loading a certificate from certificate and key URLs. The
+// certificates may be defined in any order as the leaf is identified by the key and the chain is ordered from the leaf
+// to the root with the trust anchor removed (see identities.BuildChains). Note that the passphrase URL is only required
+// if the key is encrypted and may otherwise be empty.
+func BuildCertificates(certificateURL string, keyURL string, passphraseURL string) ([]tls.Certificate, error) {
 
 	certificates := []tls.Certificate{}
 
@@ -56,7 +93,7 @@ func BuildCertificates(certificateURL string, keyURL string) ([]tls.Certificate,
 		return certificates, nil
 	}
 
-	certificate, err := readKeyPair(certificateURL, keyURL)
+	certificate, err := readKeyPair(certificateURL, keyURL, passphraseURL)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error loading key pair from [%s] and [%s]", certificateURL, keyURL)
 	}
@@ -64,20 +101,131 @@ func BuildCertificates(certificateURL string, keyURL string) ([]tls.Certificate,
 	return append(certificates, certificate), nil
 }
 
-// readKeyPair reads an X.509 key pair from a certificate and key URL.
-func readKeyPair(certificateURL string, keyURL string) (tls.Certificate, error) {
+// BuildPKCS12Certificates provides a utility function for loading a certificate from a PKCS #12 bundle URL. Note that
+// the passphrase URL points to the password of the bundle and may be empty if the bundle has no password.
+func BuildPKCS12Certificates(bundleURL string, passphraseURL string) ([]tls.Certificate, error) {
+
+	certificates := []tls.Certificate{}
+
+	if bundleURL == "" {
+		return certificates, nil
+	}
+
+	certificate, err := readPKCS12(bundleURL, passphraseURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading pkcs12 bundle from [%s]", bundleURL)
+	}
+
+	return append(certificates, certificate), nil
+}
+
+// LintCertificates provides a utility function for linting the chains of key pairs for a usage at the current time
+// (see lints.LintTLSCertificate) that returns a *lints.LintError if there are findings of error severity.
+func LintCertificates(certificates []tls.Certificate, usage lints.Usage) error {
+
+	var findings []lints.Finding
+
+	for _, certificate := range certificates {
+
+		linted, err := lints.LintTLSCertificate(certificate, usage, time.Now())
+		if err != nil {
+			return errors.Wrap(err, "error linting certificate")
+		}
+
+		findings = append(findings, linted...)
+	}
+
+	return lints.Check(findings)
+}
+
+// BuildKey provides a utility function for loading a private key from a key URL. Note that the passphrase URL is only
+// required if the key is encrypted and may otherwise be empty.
+func BuildKey(keyURL string, passphraseURL string) (crypto.Signer, error) {
+
+	keyBytes, err := readResource(keyURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading key [%s]", keyURL)
+	}
+
+	passphraseBytes, err := identities.LoadPassphrase(passphraseURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading passphrase [%s]", passphraseURL)
+	}
+
+	keys, err := identities.DecodeKeys(keyBytes, passphraseBytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error decoding key [%s]", keyURL)
+	}
+
+	if len(keys) != 1 {
+		return nil, fmt.Errorf("expected one key in [%s] but found [%d]", keyURL, len(keys))
+	}
+
+	return keys[0], nil
+}
+
+// readKeyPair reads an X.509 key pair from a certificate, key and passphrase URL.
+func readKeyPair(certificateURL string, keyURL string, passphraseURL string) (tls.Certificate, error) {
 
 	certificateBytes, err := readResource(certificateURL)
 	if err != nil {
 		return tls.Certificate{}, errors.Wrapf(err, "error reading certificate [%s]", certificateURL)
 	}
 
-	keyBytes, err := readResource(keyURL)
+	certificates, err := identities.DecodeCertificates(certificateBytes)
+	if err != nil {
+		return tls.Certificate{}, errors.Wrapf(err, "error decoding certificate [%s]", certificateURL)
+	}
+
+	key, err := BuildKey(keyURL, passphraseURL)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return keyPair(certificates, key)
+}
+
+// readPKCS12 reads an X.509 key pair from a PKCS #12 bundle and passphrase URL.
+func readPKCS12(bundleURL string, passphraseURL string) (tls.Certificate, error) {
+
+	bundleBytes, err := readResource(bundleURL)
+	if err != nil {
+		return tls.Certificate{}, errors.Wrapf(err, "error reading pkcs12 bundle [%s]", bundleURL)
+	}
+
+	passphraseBytes, err := identities.LoadPassphrase(passphraseURL)
+	if err != nil {
+		return tls.Certificate{}, errors.Wrapf(err, "error reading passphrase [%s]", passphraseURL)
+	}
+
+	identity, err := identities.DecodePKCS12(bundleBytes, string(passphraseBytes))
 	if err != nil {
-		return tls.Certificate{}, errors.Wrapf(err, "error reading key [%s]", keyURL)
+		return tls.Certificate{}, errors.Wrapf(err, "error decoding pkcs12 bundle [%s]", bundleURL)
+	}
+
+	return keyPair(append([]*x509.Certificate{identity.Certificate}, identity.Authorities...), identity.Key)
+}
+
+// keyPair returns an X.509 key pair for an unordered collection of certificates and a key. The leaf is the certificate
+// whose public key matches the key (or the first certificate if there is no such certificate) and the chain is the
+// preferred path from the leaf through the collection without a self signed trust anchor.
+func keyPair(certificates []*x509.Certificate, key crypto.Signer) (tls.Certificate, error) {
+
+	if len(certificates) == 0 {
+		return tls.Certificate{}, errors.New("no certificates defined")
+	}
+
+	leaf := identities.FindLeaf(certificates, key)
+	if leaf == nil {
+		leaf = certificates[0]
+	}
+
+	chain := identities.BuildChains(leaf, certificates)[0]
+	if len(chain) > 1 && identities.IsSelfSigned(chain[len(chain)-1]) {
+		chain = chain[:len(chain)-1]
 	}
 
-	return tls.X509KeyPair(certificateBytes, keyBytes)
+	return identities.NewIdentity(chain[1:], chain[0], key).TLSCertificate()
 }
 
 // readResource reads a resource URL into a byte array.
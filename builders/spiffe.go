@@ -0,0 +1,142 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builders
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+
+	"github.com/deciphernow/nautls/identities"
+	"github.com/pkg/errors"
+)
+
+// BuildSPIFFEBundles provides a utility function for loading the X.509-SVID authorities of SPIFFE trust bundles from a
+// map of trust domains (e.g., "nautls.com") to URLs. The authorities are returned keyed by trust domain.
+func BuildSPIFFEBundles(bundleURLs map[string]string) (map[string][]*x509.Certificate, error) {
+
+	bundles := map[string][]*x509.Certificate{}
+
+	for value, bundleURL := range bundleURLs {
+
+		trustDomain, err := identities.ParseSPIFFETrustDomain(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing trust domain of spiffe bundle [%s]", bundleURL)
+		}
+
+		bytes, err := readResource(bundleURL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading spiffe bundle [%s]", bundleURL)
+		}
+
+		authorities, err := identities.DecodeSPIFFEBundle(bytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error decoding spiffe bundle [%s]", bundleURL)
+		}
+
+		bundles[trustDomain] = append(bundles[trustDomain], authorities...)
+	}
+
+	return bundles, nil
+}
+
+// BuildSPIFFERoots provides a utility function for creating the certificate pools that X.509-SVIDs are verified against
+// keyed by trust domain from the authorities of SPIFFE trust bundles (see BuildSPIFFEBundles), an array of URLs and any
+// additional certificates. The authorities from the URLs and additional certificates are only trusted for the trust
+// domain of their own SPIFFE ID and are ignored if they do not have one. An error is returned if no authorities are
+// trusted for any trust domain such that SVIDs are never verified against the system authorities.
+func BuildSPIFFERoots(bundles map[string][]*x509.Certificate, certificateURLs []string, certificates ...*x509.Certificate) (map[string]*x509.CertPool, error) {
+
+	roots := map[string]*x509.CertPool{}
+
+	add := func(trustDomain string, certificate *x509.Certificate) {
+		if _, ok := roots[trustDomain]; !ok {
+			roots[trustDomain] = x509.NewCertPool()
+		}
+		roots[trustDomain].AddCert(certificate)
+	}
+
+	for trustDomain, authorities := range bundles {
+		for _, authority := range authorities {
+			add(trustDomain, authority)
+		}
+	}
+
+	certificates, err := BuildCertificateList(certificateURLs, certificates...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, certificate := range certificates {
+		if id, err := identities.SPIFFEID(certificate); err == nil {
+			add(id.Host, certificate)
+		}
+	}
+
+	if len(roots) == 0 {
+		return nil, errors.New("error building spiffe roots without spiffe bundles or authorities with spiffe ids")
+	}
+
+	return roots, nil
+}
+
+// BuildSPIFFEVerifier provides a utility function for creating a tls.Config.VerifyConnection function that authorizes
+// the peer by the SPIFFE ID of its X.509-SVID rather than by hostname.
+//
+// The peer certificates are verified as an X.509-SVID against the roots of its own trust domain (see BuildSPIFFERoots)
+// before the verified chains are passed to the verifyPeerCertificate and verifyConnection functions (e.g., when standard
+// verification is skipped). Note that both functions may be nil.
+func BuildSPIFFEVerifier(ids []string, trustDomains []string, roots map[string]*x509.CertPool, verifyPeerCertificate func([][]byte, [][]*x509.Certificate) error, verifyConnection func(tls.ConnectionState) error) (func(tls.ConnectionState) error, error) {
+
+	if len(roots) == 0 {
+		return nil, errors.New("error building spiffe verifier without roots")
+	}
+
+	authorizer, err := identities.NewSPIFFEAuthorizer(ids, trustDomains)
+	if err != nil {
+		return nil, errors.Wrap(err, "error building spiffe authorizer")
+	}
+
+	return func(state tls.ConnectionState) error {
+
+		chains, err := identities.VerifySVID(state.PeerCertificates, roots)
+		if err != nil {
+			return err
+		}
+
+		state.VerifiedChains = chains
+
+		if err := authorizer.Authorize(state.VerifiedChains[0][0]); err != nil {
+			return err
+		}
+
+		if verifyPeerCertificate != nil {
+
+			raw := make([][]byte, len(state.PeerCertificates))
+			for index, certificate := range state.PeerCertificates {
+				raw[index] = certificate.Raw
+			}
+
+			if err := verifyPeerCertificate(raw, state.VerifiedChains); err != nil {
+				return err
+			}
+		}
+
+		if verifyConnection != nil {
+			return verifyConnection(state)
+		}
+
+		return nil
+	}, nil
+}
@@ -14,11 +14,18 @@
 
 package clients
 
-import "crypto/tls"
+import (
+	"crypto/tls"
+	"crypto/x509"
+
+	"github.com/deciphernow/nautls/identities"
+	"github.com/deciphernow/nautls/revocations"
+)
 
 // SecurityBuilder provides an builder for client tls.Config instances.
 type SecurityBuilder struct {
-	config SecurityConfig
+	config    SecurityConfig
+	materials materials
 }
 
 // NewSecurityBuilder returns a new instance of the SecurityBuilder structure.
@@ -28,7 +35,7 @@ func NewSecurityBuilder() *SecurityBuilder {
 
 // Build creates a tls.Config from the SecurityBuilder.
 func (b *SecurityBuilder) Build() (*tls.Config, error) {
-	return b.config.Build()
+	return b.config.build(b.materials)
 }
 
 // WithAuthorities sets the certificate authorities trusted by the built tls.Config. The values must be URLs that point
@@ -64,8 +71,101 @@ func (b *SecurityBuilder) WithKey(key string) *SecurityBuilder {
 	return b
 }
 
+// WithPassphrase sets the passphrase used to decrypt the key if it is encrypted and the password of the PKCS #12 bundle.
+// The value must be a URL that points to the location of the passphrase.
+//
+// Note that in addition to those schemes supported by [getter](https://godoc.org/github.com/hashicorp/go-getter) a
+// "base64" scheme is supported for providing the passphrase in the path of the URL directly. This is most applicable
+// when the passphrase must be provided via an environement variable.
+func (b *SecurityBuilder) WithPassphrase(passphrase string) *SecurityBuilder {
+	b.config.Passphrase = passphrase
+	return b
+}
+
+// WithPKCS12 sets a PKCS #12 bundle containing a certificate, key and certificate chain. The value must be a URL that
+// points to the location of a DER encoded PKCS #12 bundle whose password is set with WithPassphrase.
+//
+// Note that in addition to those schemes supported by [getter](https://godoc.org/github.com/hashicorp/go-getter) a
+// "base64" scheme is supported for providing the bundle in the path of the URL directly. This is most applicable when
+// the bundle must be provided via an environement variable.
+func (b *SecurityBuilder) WithPKCS12(pkcs12 string) *SecurityBuilder {
+	b.config.PKCS12 = pkcs12
+	return b
+}
+
 // WithServer sets the server name used for certificate verification.
 func (b *SecurityBuilder) WithServer(server string) *SecurityBuilder {
 	b.config.Server = server
 	return b
 }
+
+// WithAuthorityCertificates adds in-memory certificates to the certificate authorities trusted by the built tls.Config.
+// These are trusted in addition to any set with WithAuthorities and, once provided, the system certificates are no
+// longer used by default.
+func (b *SecurityBuilder) WithAuthorityCertificates(authorities ...*x509.Certificate) *SecurityBuilder {
+	b.materials.authorities = append(b.materials.authorities, authorities...)
+	return b
+}
+
+// WithIdentity sets an in-memory identity used as the client certificate for mTLS connections with its authorities
+// attached as the certificate chain. Note that the identity is provided in addition to any certificate and key set with
+// WithCertificate and WithKey.
+func (b *SecurityBuilder) WithIdentity(identity *identities.Identity) *SecurityBuilder {
+	b.materials.identity = identity
+	return b
+}
+
+// WithRevocations sets the certificate revocation lists used to check the server certificate chains. The values must be
+// URLs that point to the locations of PEM or DER encoded X.509 CRLs.
+//
+// Note that in addition to those schemes supported by [getter](https://godoc.org/github.com/hashicorp/go-getter) a
+// "base64" scheme is supported for providing the CRL in the path of the URL directly. This is most applicable when the
+// CRL must be provided via an environement variable.
+func (b *SecurityBuilder) WithRevocations(revocations []string) *SecurityBuilder {
+	b.config.Revocations = revocations
+	return b
+}
+
+// WithRevocationPolicy sets whether certificates are rejected or accepted when the CRL of their issuer is stale.
+func (b *SecurityBuilder) WithRevocationPolicy(policy revocations.Policy) *SecurityBuilder {
+	b.config.RevocationPolicy = policy
+	return b
+}
+
+// WithOCSP sets how the OCSP status of the server certificate is checked.
+func (b *SecurityBuilder) WithOCSP(mode revocations.OCSPMode) *SecurityBuilder {
+	b.config.OCSP = mode
+	return b
+}
+
+// WithLint sets whether the client certificates and their chains are linted when the configuration is built and rejected
+// if there are findings of error severity (see lints.LintTLSCertificate).
+func (b *SecurityBuilder) WithLint(lint bool) *SecurityBuilder {
+	b.config.Lint = lint
+	return b
+}
+
+// WithSPIFFEIDs sets the SPIFFE IDs of the servers that are authorized. Once SPIFFE IDs or trust domains are set the
+// server must present an X.509-SVID that is authorized by its SPIFFE ID in place of verifying its hostname.
+func (b *SecurityBuilder) WithSPIFFEIDs(ids []string) *SecurityBuilder {
+	b.config.SPIFFEIDs = ids
+	return b
+}
+
+// WithSPIFFETrustDomains sets the SPIFFE trust domains whose servers are authorized.
+func (b *SecurityBuilder) WithSPIFFETrustDomains(trustDomains []string) *SecurityBuilder {
+	b.config.SPIFFETrustDomains = trustDomains
+	return b
+}
+
+// WithSPIFFEBundles sets the SPIFFE trust bundles whose X.509-SVID authorities are trusted keyed by trust domain (e.g.,
+// "nautls.com"). The values must be URLs that point to the locations of bundles in the SPIFFE bundle (i.e., JWK set)
+// format. Note that an X.509-SVID is only verified against the bundle of its own trust domain.
+//
+// Note that in addition to those schemes supported by [getter](https://godoc.org/github.com/hashicorp/go-getter) a
+// "base64" scheme is supported for providing the bundle in the path of the URL directly. This is most applicable when
+// the bundle must be provided via an environement variable.
+func (b *SecurityBuilder) WithSPIFFEBundles(bundles map[string]string) *SecurityBuilder {
+	b.config.SPIFFEBundles = bundles
+	return b
+}
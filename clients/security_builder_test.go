@@ -15,9 +15,17 @@
 package clients
 
 import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net/url"
 	"testing"
+	"time"
 
+	"github.com/deciphernow/nautls/identities"
 	"github.com/deciphernow/nautls/internal/tests"
+	"github.com/deciphernow/nautls/revocations"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -74,6 +82,28 @@ func TestSecurityBuilder(t *testing.T) {
 			})
 		})
 
+		Convey(".WithPassphrase is invoked", func() {
+
+			passphrase := tests.MustGenerateString(t)
+
+			builder.WithPassphrase(passphrase)
+
+			Convey("it sets the passphrase", func() {
+				So(builder.config.Passphrase, ShouldEqual, passphrase)
+			})
+		})
+
+		Convey(".WithPKCS12 is invoked", func() {
+
+			pkcs12 := tests.MustGenerateString(t)
+
+			builder.WithPKCS12(pkcs12)
+
+			Convey("it sets the pkcs12", func() {
+				So(builder.config.PKCS12, ShouldEqual, pkcs12)
+			})
+		})
+
 		Convey(".WithServer is invoked", func() {
 
 			server := tests.MustGenerateString(t)
@@ -84,5 +114,178 @@ func TestSecurityBuilder(t *testing.T) {
 				So(builder.config.Server, ShouldEqual, server)
 			})
 		})
+
+		Convey(".WithRevocations is invoked", func() {
+
+			revocations := tests.MustGenerateStrings(t)
+
+			builder.WithRevocations(revocations)
+
+			Convey("it sets the revocations", func() {
+				So(builder.config.Revocations, ShouldResemble, revocations)
+			})
+
+			Convey("with a valid crl and .Build is invoked", func() {
+
+				template, err := identities.RootTemplate(pkix.Name{CommonName: "NauTLS (Root)"})
+				So(err, ShouldBeNil)
+
+				authority, err := identities.Self(template, identities.ECDSA, 256)
+				So(err, ShouldBeNil)
+
+				crl, err := identities.NewRevocationRegistry(authority).CRL(time.Hour)
+				So(err, ShouldBeNil)
+
+				builder.WithRevocations([]string{"base64:///" + url.PathEscape(base64.StdEncoding.EncodeToString(identities.EncodeCRL(crl)))})
+				config, err := builder.Build()
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("it verifies peer certificates", func() {
+					So(config.VerifyPeerCertificate, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey(".WithRevocationPolicy is invoked", func() {
+
+			builder.WithRevocationPolicy(revocations.FailOpen)
+
+			Convey("it sets the revocation policy", func() {
+				So(builder.config.RevocationPolicy, ShouldEqual, revocations.FailOpen)
+			})
+		})
+
+		Convey(".WithOCSP is invoked", func() {
+
+			builder.WithOCSP(revocations.OCSPHardFail)
+
+			Convey("it sets the ocsp mode", func() {
+				So(builder.config.OCSP, ShouldEqual, revocations.OCSPHardFail)
+			})
+
+			Convey(".Build is invoked", func() {
+
+				config, err := builder.Build()
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("it verifies connections", func() {
+					So(config.VerifyConnection, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey(".WithLint is invoked", func() {
+
+			builder.WithLint(true)
+
+			Convey("it sets the lint", func() {
+				So(builder.config.Lint, ShouldBeTrue)
+			})
+
+			Convey("with a weak identity and .Build is invoked", func() {
+
+				template, err := identities.RootTemplate(pkix.Name{CommonName: "NauTLS (Root)"})
+				So(err, ShouldBeNil)
+
+				authority, err := identities.Self(template, identities.ECDSA, 256)
+				So(err, ShouldBeNil)
+
+				template, err = identities.ServerTemplate([]string{"nautls.com"}, nil)
+				So(err, ShouldBeNil)
+
+				template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+
+				identity, err := authority.Issue(template, identities.RSA, 1024)
+				So(err, ShouldBeNil)
+
+				_, err = builder.WithIdentity(identity).Build()
+
+				Convey("it returns a lint error", func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "rsa key size [1024] is less than [2048]")
+				})
+			})
+		})
+
+		Convey(".WithSPIFFEIDs is invoked", func() {
+
+			ids := tests.MustGenerateStrings(t)
+
+			builder.WithSPIFFEIDs(ids)
+
+			Convey("it sets the spiffe ids", func() {
+				So(builder.config.SPIFFEIDs, ShouldResemble, ids)
+			})
+		})
+
+		Convey(".WithSPIFFETrustDomains is invoked", func() {
+
+			trustDomains := tests.MustGenerateStrings(t)
+
+			builder.WithSPIFFETrustDomains(trustDomains)
+
+			Convey("it sets the spiffe trust domains", func() {
+				So(builder.config.SPIFFETrustDomains, ShouldResemble, trustDomains)
+			})
+		})
+
+		Convey(".WithSPIFFEBundles is invoked", func() {
+
+			bundles := map[string]string{tests.MustGenerateString(t): tests.MustGenerateString(t)}
+
+			builder.WithSPIFFEBundles(bundles)
+
+			Convey("it sets the spiffe bundles", func() {
+				So(builder.config.SPIFFEBundles, ShouldResemble, bundles)
+			})
+		})
+
+		Convey(".WithAuthorityCertificates is invoked", func() {
+
+			authorities := []*x509.Certificate{&x509.Certificate{}, &x509.Certificate{}}
+
+			builder.WithAuthorityCertificates(authorities...)
+
+			Convey("it sets the authority certificates", func() {
+				So(builder.materials.authorities, ShouldResemble, authorities)
+			})
+		})
+
+		Convey(".WithIdentity is invoked", func() {
+
+			identity, err := identities.Self(identities.Template{
+				NotAfter:     time.Now().AddDate(0, 1, 0),
+				NotBefore:    time.Now(),
+				SerialNumber: big.NewInt(time.Now().UnixNano()),
+				Subject:      pkix.Name{CommonName: "nautls.com"},
+			}, identities.ECDSA, 256)
+			So(err, ShouldBeNil)
+
+			builder.WithIdentity(identity)
+
+			Convey("it sets the identity", func() {
+				So(builder.materials.identity, ShouldEqual, identity)
+			})
+
+			Convey("and .Build is invoked", func() {
+
+				config, err := builder.Build()
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("it returns the identity as a certificate", func() {
+					So(config.Certificates, ShouldHaveLength, 1)
+					So(config.Certificates[0].Leaf, ShouldEqual, identity.Certificate)
+				})
+			})
+		})
 	})
 }
@@ -16,8 +16,12 @@ package clients
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 
 	"github.com/deciphernow/nautls/builders"
+	"github.com/deciphernow/nautls/identities"
+	"github.com/deciphernow/nautls/lints"
+	"github.com/deciphernow/nautls/revocations"
 	"github.com/pkg/errors"
 )
 
@@ -48,28 +52,172 @@ type SecurityConfig struct {
 	// applicable when the certificate data must be provided via an environement variable.
 	Key string `json:"key" mapstructure:"key" yaml:"key"`
 
+	// Passphrase defines the passphrase used to decrypt the key if it is encrypted and the password of the PKCS #12
+	// bundle. The value must be a URL that points to the location of the passphrase. Both legacy encrypted PEM blocks
+	// and PBES2 encrypted PKCS #8 keys are supported.
+	//
+	// Note that in addition to those schemes supported by [getter](https://godoc.org/github.com/hashicorp/go-getter) a
+	// "base64" scheme is supported for providing the passphrase in the path of the URL directly. This is most applicable
+	// when the passphrase must be provided via an environement variable.
+	Passphrase string `json:"passphrase" mapstructure:"passphrase" yaml:"passphrase"`
+
+	// PKCS12 defines a PKCS #12 (i.e., .p12 or .pfx) bundle containing a certificate, key and certificate chain. The
+	// value must be a URL that points to the location of a DER encoded PKCS #12 bundle whose password is defined by the
+	// passphrase. Note that the bundle may be provided in addition to the certificate and key.
+	//
+	// Note that in addition to those schemes supported by [getter](https://godoc.org/github.com/hashicorp/go-getter) a
+	// "base64" scheme is supported for providing the bundle in the path of the URL directly. This is most applicable
+	// when the bundle must be provided via an environement variable.
+	PKCS12 string `json:"pkcs12" mapstructure:"pkcs12" yaml:"pkcs12"`
+
+	// Revocations defines the certificate revocation lists used to check the server certificate chains. The values must be
+	// URLs that point to the locations of PEM or DER encoded X.509 CRLs. A CRL is only applied to certificates whose
+	// issuer signed the CRL and stale CRLs (i.e., those past their next update) are reloaded in the background when checked.
+	//
+	// Note that in addition to those schemes supported by [getter](https://godoc.org/github.com/hashicorp/go-getter) a
+	// "base64" scheme is supported for providing the CRL in the path of the URL directly. This is most applicable when
+	// the CRL must be provided via an environement variable.
+	Revocations []string `json:"revocations" mapstructure:"revocations" yaml:"revocations"`
+
+	// RevocationPolicy defines whether certificates are rejected (i.e., "FailClosed") or accepted (i.e., "FailOpen") when
+	// the CRL of their issuer is stale. Note that certificates listed as revoked are always rejected.
+	RevocationPolicy revocations.Policy `json:"revocation_policy" mapstructure:"revocation_policy" yaml:"revocation_policy"`
+
+	// OCSP defines how the OCSP status of the server certificate is checked. A stapled response is preferred and, if none
+	// is provided, the OCSP server named in the certificate is queried. Responses are cached until their next update.
+	//
+	// For serialization puposes (i.e., JSON and YAML) the value must be one of "Disabled", "SoftFail" (i.e., only reject
+	// revoked certificates), "HardFail" (i.e., reject certificates that are not known to be good) or "MustStaple" (i.e.,
+	// reject certificates that are not known to be good by a stapled response).
+	OCSP revocations.OCSPMode `json:"ocsp" mapstructure:"ocsp" yaml:"ocsp"`
+
+	// Lint defines whether the client certificates and their chains are linted for weak cryptography and misconfigurations
+	// (e.g., RSA keys of less than 2048 bits, SHA-1 signatures or expired certificates) when the configuration is built.
+	// Certificates with findings of error severity are rejected (see lints.LintTLSCertificate).
+	Lint bool `json:"lint" mapstructure:"lint" yaml:"lint"`
+
+	// SPIFFEIDs defines the SPIFFE IDs (e.g., "spiffe://nautls.com/api") of the servers that are authorized. When either
+	// the SPIFFE IDs or trust domains are defined the server must present an X.509-SVID that chains to the authorities of
+	// its trust domain (see SPIFFEBundles) and is authorized by its SPIFFE ID in place of verifying its hostname.
+	SPIFFEIDs []string `json:"spiffe_ids" mapstructure:"spiffe_ids" yaml:"spiffe_ids"`
+
+	// SPIFFETrustDomains defines the SPIFFE trust domains (e.g., "nautls.com") whose servers are authorized.
+	SPIFFETrustDomains []string `json:"spiffe_trust_domains" mapstructure:"spiffe_trust_domains" yaml:"spiffe_trust_domains"`
+
+	// SPIFFEBundles defines the SPIFFE trust bundles of trust domains (e.g., "nautls.com") whose X.509-SVID authorities
+	// are trusted in addition to the authorities. The values must be URLs that point to the locations of bundles in the
+	// SPIFFE bundle (i.e., JWK set) format. An X.509-SVID is only verified against the bundle of its own trust domain and
+	// against the authorities whose SPIFFE ID belongs to its trust domain, so the SPIFFE IDs and trust domains require a
+	// bundle or such an authority.
+	//
+	// Note that in addition to those schemes supported by [getter](https://godoc.org/github.com/hashicorp/go-getter) a
+	// "base64" scheme is supported for providing the bundle in the path of the URL directly. This is most applicable
+	// when the bundle must be provided via an environement variable.
+	SPIFFEBundles map[string]string `json:"spiffe_bundles" mapstructure:"spiffe_bundles" yaml:"spiffe_bundles"`
+
 	// Server defines the server name used for certificate verification.
 	Server string `json:"server" mapstructure:"server" yaml:"server"`
 }
 
+// materials defines in-memory cryptographic materials that supplement the resources of a SecurityConfig.
+type materials struct {
+	authorities []*x509.Certificate
+	identity    *identities.Identity
+}
+
 // Build creates a tls.Config from the SecurityConfig instance.
 func (c *SecurityConfig) Build() (*tls.Config, error) {
+	return c.build(materials{})
+}
+
+// build creates a tls.Config from the SecurityConfig instance and the in-memory materials.
+func (c *SecurityConfig) build(materials materials) (*tls.Config, error) {
+
+	bundles, err := builders.BuildSPIFFEBundles(c.SPIFFEBundles)
+	if err != nil {
+		return nil, errors.Wrap(err, "error building spiffe bundles")
+	}
 
-	pool, err := builders.BuildCertificatePool(c.Authorities)
+	var authorities []*x509.Certificate
+	for _, bundle := range bundles {
+		authorities = append(authorities, bundle...)
+	}
+
+	pool, err := builders.BuildCertificatePool(c.Authorities, append(authorities, materials.authorities...)...)
 	if err != nil {
 		return nil, errors.Wrap(err, "error building certificate authority pool")
 	}
 
-	certificates, err := builders.BuildCertificates(c.Certificate, c.Key)
+	certificates, err := builders.BuildCertificates(c.Certificate, c.Key, c.Passphrase)
 	if err != nil {
 		return nil, errors.Wrap(err, "error building certificates")
 	}
 
+	bundled, err := builders.BuildPKCS12Certificates(c.PKCS12, c.Passphrase)
+	if err != nil {
+		return nil, errors.Wrap(err, "error building pkcs12 certificates")
+	}
+
+	certificates = append(certificates, bundled...)
+
+	if materials.identity != nil {
+
+		certificate, err := materials.identity.TLSCertificate()
+		if err != nil {
+			return nil, errors.Wrap(err, "error building identity certificate")
+		}
+
+		certificates = append(certificates, certificate)
+	}
+
+	if c.Lint {
+		if err := builders.LintCertificates(certificates, lints.ClientUsage); err != nil {
+			return nil, errors.Wrap(err, "error linting certificates")
+		}
+	}
+
 	configuration := &tls.Config{
 		Certificates: certificates,
 		RootCAs:      pool,
 		ServerName:   c.Server,
 	}
 
+	if len(c.Revocations) > 0 {
+
+		checker, err := revocations.NewCRLChecker(c.Revocations, c.RevocationPolicy)
+		if err != nil {
+			return nil, errors.Wrap(err, "error building revocation checker")
+		}
+
+		configuration.VerifyPeerCertificate = checker.VerifyPeerCertificate
+	}
+
+	if c.OCSP != revocations.OCSPDisabled {
+
+		checker, err := revocations.NewOCSPChecker(c.OCSP)
+		if err != nil {
+			return nil, errors.Wrap(err, "error building ocsp checker")
+		}
+
+		configuration.VerifyConnection = checker.VerifyConnection
+	}
+
+	if len(c.SPIFFEIDs) > 0 || len(c.SPIFFETrustDomains) > 0 {
+
+		roots, err := builders.BuildSPIFFERoots(bundles, c.Authorities, materials.authorities...)
+		if err != nil {
+			return nil, errors.Wrap(err, "error building spiffe roots")
+		}
+
+		verifier, err := builders.BuildSPIFFEVerifier(c.SPIFFEIDs, c.SPIFFETrustDomains, roots, configuration.VerifyPeerCertificate, configuration.VerifyConnection)
+		if err != nil {
+			return nil, errors.Wrap(err, "error building spiffe verifier")
+		}
+
+		configuration.InsecureSkipVerify = true
+		configuration.VerifyConnection = verifier
+		configuration.VerifyPeerCertificate = nil
+	}
+
 	return configuration, nil
 }
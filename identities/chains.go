@@ -0,0 +1,108 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"sort"
+)
+
+const (
+	// maximumChainLength defines the maximum number of certificates in a chain returned by BuildChains.
+	maximumChainLength = 10
+)
+
+// BuildChains returns the paths from a leaf certificate through an unordered collection of certificates (e.g., a vendor
+// bundle that may be out of order, include unrelated roots or miss an intermediate) ordered from the leaf to the root.
+// A certificate is considered the issuer of another if its subject matches the issuer of the other and it verifies the
+// signature of the other. Paths that end in a self signed certificate are returned before paths that end in a
+// certificate whose issuer is not in the collection and shorter paths are returned before longer paths. Note that every
+// path starts with the leaf and that the leaf itself is returned if no issuers are found.
+func BuildChains(leaf *x509.Certificate, certificates []*x509.Certificate) [][]*x509.Certificate {
+
+	var anchored [][]*x509.Certificate
+	var partial [][]*x509.Certificate
+
+	var walk func(chain []*x509.Certificate)
+	walk = func(chain []*x509.Certificate) {
+
+		current := chain[len(chain)-1]
+
+		if IsSelfSigned(current) {
+			anchored = append(anchored, chain)
+			return
+		}
+
+		found := false
+
+		if len(chain) < maximumChainLength {
+			for _, candidate := range certificates {
+				if !containsCertificate(chain, candidate) && IssuedBy(current, candidate) {
+					found = true
+					walk(append(append([]*x509.Certificate{}, chain...), candidate))
+				}
+			}
+		}
+
+		if !found {
+			partial = append(partial, chain)
+		}
+	}
+
+	walk([]*x509.Certificate{leaf})
+
+	sort.SliceStable(anchored, func(i, j int) bool { return len(anchored[i]) < len(anchored[j]) })
+	sort.SliceStable(partial, func(i, j int) bool { return len(partial[i]) < len(partial[j]) })
+
+	return append(anchored, partial...)
+}
+
+// IsSelfSigned returns a value indicating whether a certificate is issued by itself (e.g., a root).
+func IsSelfSigned(certificate *x509.Certificate) bool {
+	return bytes.Equal(certificate.RawIssuer, certificate.RawSubject) && certificate.CheckSignature(certificate.SignatureAlgorithm, certificate.RawTBSCertificate, certificate.Signature) == nil
+}
+
+// FindLeaf returns the first certificate in a collection whose public key matches the provided key or nil if there is
+// no such certificate.
+func FindLeaf(certificates []*x509.Certificate, key crypto.Signer) *x509.Certificate {
+
+	for _, certificate := range certificates {
+		if matches(key, certificate.PublicKey) {
+			return certificate
+		}
+	}
+
+	return nil
+}
+
+// IssuedBy returns a value indicating whether a certificate was issued by a candidate such that the issuer of the
+// certificate is the subject of the candidate and the certificate is signed by the key of the candidate.
+func IssuedBy(certificate *x509.Certificate, candidate *x509.Certificate) bool {
+	return bytes.Equal(certificate.RawIssuer, candidate.RawSubject) && certificate.CheckSignatureFrom(candidate) == nil
+}
+
+// containsCertificate returns a value indicating whether a certificate is in a slice.
+func containsCertificate(certificates []*x509.Certificate, certificate *x509.Certificate) bool {
+
+	for _, candidate := range certificates {
+		if candidate.Equal(certificate) {
+			return true
+		}
+	}
+
+	return false
+}
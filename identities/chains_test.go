@@ -0,0 +1,128 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChains(t *testing.T) {
+
+	Convey("When chaining", t, func() {
+
+		root := MustSelf("NauTLS (Root)", t)
+		other := MustSelf("NauTLS (Other)", t)
+
+		template, err := IntermediateTemplate(pkix.Name{CommonName: "NauTLS (Intermediate)"})
+		So(err, ShouldBeNil)
+
+		intermediate, err := root.Issue(template, ECDSA, 256)
+		So(err, ShouldBeNil)
+
+		leaf := MustIssue(intermediate, "nautls.com", t)
+
+		Convey("#BuildChains is invoked", func() {
+
+			Convey("with an unordered bundle including unrelated roots", func() {
+
+				chains := BuildChains(leaf.Certificate, []*x509.Certificate{other.Certificate, root.Certificate, leaf.Certificate, intermediate.Certificate})
+
+				Convey("it returns the ordered chain", func() {
+					So(chains, ShouldResemble, [][]*x509.Certificate{{leaf.Certificate, intermediate.Certificate, root.Certificate}})
+				})
+			})
+
+			Convey("with a bundle missing the root", func() {
+
+				chains := BuildChains(leaf.Certificate, []*x509.Certificate{intermediate.Certificate})
+
+				Convey("it returns the partial chain", func() {
+					So(chains, ShouldResemble, [][]*x509.Certificate{{leaf.Certificate, intermediate.Certificate}})
+				})
+			})
+
+			Convey("with a bundle missing the intermediate", func() {
+
+				chains := BuildChains(leaf.Certificate, []*x509.Certificate{root.Certificate})
+
+				Convey("it returns the leaf", func() {
+					So(chains, ShouldResemble, [][]*x509.Certificate{{leaf.Certificate}})
+				})
+			})
+
+			Convey("with a bundle including a cross signed root", func() {
+
+				cross, err := root.Renew(other, time.Hour)
+				So(err, ShouldBeNil)
+
+				chains := BuildChains(leaf.Certificate, []*x509.Certificate{other.Certificate, cross.Certificate, intermediate.Certificate, root.Certificate})
+
+				Convey("it returns every chain with the shortest first", func() {
+					So(chains, ShouldResemble, [][]*x509.Certificate{
+						{leaf.Certificate, intermediate.Certificate, root.Certificate},
+						{leaf.Certificate, intermediate.Certificate, cross.Certificate, other.Certificate},
+					})
+				})
+			})
+
+			Convey("with a self signed leaf", func() {
+
+				chains := BuildChains(root.Certificate, []*x509.Certificate{root.Certificate, other.Certificate})
+
+				Convey("it returns the leaf", func() {
+					So(chains, ShouldResemble, [][]*x509.Certificate{{root.Certificate}})
+				})
+			})
+		})
+
+		Convey("#IsSelfSigned is invoked", func() {
+
+			Convey("on a root it returns true", func() {
+				So(IsSelfSigned(root.Certificate), ShouldBeTrue)
+			})
+
+			Convey("on an intermediate it returns false", func() {
+				So(IsSelfSigned(intermediate.Certificate), ShouldBeFalse)
+			})
+		})
+
+		Convey("#IssuedBy is invoked", func() {
+
+			Convey("with the issuer it returns true", func() {
+				So(IssuedBy(leaf.Certificate, intermediate.Certificate), ShouldBeTrue)
+			})
+
+			Convey("with another certificate it returns false", func() {
+				So(IssuedBy(leaf.Certificate, root.Certificate), ShouldBeFalse)
+			})
+		})
+
+		Convey("#FindLeaf is invoked", func() {
+
+			Convey("with a matching certificate it returns the certificate", func() {
+				So(FindLeaf([]*x509.Certificate{root.Certificate, leaf.Certificate}, leaf.Key), ShouldEqual, leaf.Certificate)
+			})
+
+			Convey("without a matching certificate it returns nil", func() {
+				So(FindLeaf([]*x509.Certificate{root.Certificate}, leaf.Key), ShouldBeNil)
+			})
+		})
+	})
+}
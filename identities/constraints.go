@@ -0,0 +1,258 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Constraint identifies a constraint of an issuer that a template may violate.
+type Constraint string
+
+const (
+	// ConstraintBasic identifies the requirement that the issuer is a certificate authority.
+	ConstraintBasic Constraint = "basic_constraints"
+
+	// ConstraintKeyUsage identifies the requirement that the key usage of the issuer permits signing certificates.
+	ConstraintKeyUsage Constraint = "key_usage"
+
+	// ConstraintExtKeyUsage identifies the requirement that the extended key usages of the template are permitted by the
+	// issuer.
+	ConstraintExtKeyUsage Constraint = "ext_key_usage"
+
+	// ConstraintPathLength identifies the maximum path length of the issuer which limits the certificate authorities it
+	// may issue.
+	ConstraintPathLength Constraint = "path_length"
+
+	// ConstraintNames identifies the permitted and excluded names of the issuer.
+	ConstraintNames Constraint = "name_constraints"
+
+	// ConstraintValidity identifies the requirement that the template does not outlive the issuer. Note that templates
+	// may be valid before the issuer as profiles are backdated for clock skew.
+	ConstraintValidity Constraint = "validity"
+)
+
+// Violation describes a constraint of an issuer that is violated by a template.
+type Violation struct {
+	Constraint Constraint
+	Detail     string
+}
+
+// ConstraintError is returned when a template violates one or more constraints of its issuer. Note that the error may be
+// wrapped and should be retrieved with errors.Cause.
+type ConstraintError struct {
+	Issuer     string
+	Subject    string
+	Violations []Violation
+}
+
+// Error returns the details of the violations.
+func (e *ConstraintError) Error() string {
+
+	details := make([]string, len(e.Violations))
+	for index, violation := range e.Violations {
+		details[index] = fmt.Sprintf("%s: %s", violation.Constraint, violation.Detail)
+	}
+
+	return fmt.Sprintf("template for [%s] violates the constraints of issuer [%s] [%s]", e.Subject, e.Issuer, strings.Join(details, "; "))
+}
+
+// CheckTemplate validates a template against the basic constraints, key usages, maximum path length, name constraints
+// and expiration of an issuer and returns a *ConstraintError describing every violation. These are checked before
+// an identity signs a template such that certificates which clients would reject are not issued.
+func CheckTemplate(issuer *x509.Certificate, template Template) error {
+
+	var violations []Violation
+
+	violate := func(constraint Constraint, format string, arguments ...interface{}) {
+		violations = append(violations, Violation{Constraint: constraint, Detail: fmt.Sprintf(format, arguments...)})
+	}
+
+	if !issuer.BasicConstraintsValid || !issuer.IsCA {
+		violate(ConstraintBasic, "issuer is not a certificate authority")
+	}
+
+	if issuer.KeyUsage != 0 && issuer.KeyUsage&x509.KeyUsageCertSign == 0 {
+		violate(ConstraintKeyUsage, "issuer key usage does not permit certificate signing")
+	}
+
+	for _, usage := range template.ExtKeyUsage {
+		if !permitsExtKeyUsage(issuer, usage) {
+			violate(ConstraintExtKeyUsage, "extended key usage [%d] is not permitted by the issuer", usage)
+		}
+	}
+
+	if template.IsCA && issuer.BasicConstraintsValid && issuer.MaxPathLen >= 0 {
+		if issuer.MaxPathLen == 0 {
+			violate(ConstraintPathLength, "issuer does not permit subordinate certificate authorities")
+		} else if (template.MaxPathLen > 0 || template.MaxPathLenZero) && template.MaxPathLen >= issuer.MaxPathLen {
+			violate(ConstraintPathLength, "maximum path length [%d] exceeds [%d] permitted by the issuer", template.MaxPathLen, issuer.MaxPathLen-1)
+		}
+	}
+
+	for _, name := range template.DNSNames {
+		if !permitsName(issuer.PermittedDNSDomains, issuer.ExcludedDNSDomains, name, matchDomain) {
+			violate(ConstraintNames, "dns name [%s] is not permitted by the issuer", name)
+		}
+	}
+
+	for _, address := range template.EmailAddresses {
+		if !permitsName(issuer.PermittedEmailAddresses, issuer.ExcludedEmailAddresses, address, matchEmail) {
+			violate(ConstraintNames, "email address [%s] is not permitted by the issuer", address)
+		}
+	}
+
+	for _, ip := range template.IPAddresses {
+		if !permitsIP(issuer.PermittedIPRanges, issuer.ExcludedIPRanges, ip) {
+			violate(ConstraintNames, "ip address [%s] is not permitted by the issuer", ip)
+		}
+	}
+
+	for _, uri := range template.URIs {
+		if !permitsName(issuer.PermittedURIDomains, issuer.ExcludedURIDomains, uri.Hostname(), matchURIDomain) {
+			violate(ConstraintNames, "uri [%s] is not permitted by the issuer", uri)
+		}
+	}
+
+	if template.NotAfter.Truncate(time.Second).After(issuer.NotAfter) {
+		violate(ConstraintValidity, "not after [%s] is after that of the issuer [%s]", template.NotAfter, issuer.NotAfter)
+	}
+
+	if len(violations) > 0 {
+		return &ConstraintError{Issuer: issuer.Subject.CommonName, Subject: template.Subject.CommonName, Violations: violations}
+	}
+
+	return nil
+}
+
+// permitsExtKeyUsage returns whether the extended key usages of an issuer permit a usage. Note that an issuer without
+// extended key usages permits all usages.
+func permitsExtKeyUsage(issuer *x509.Certificate, usage x509.ExtKeyUsage) bool {
+
+	if len(issuer.ExtKeyUsage) == 0 && len(issuer.UnknownExtKeyUsage) == 0 {
+		return true
+	}
+
+	for _, permitted := range issuer.ExtKeyUsage {
+		if permitted == x509.ExtKeyUsageAny || permitted == usage {
+			return true
+		}
+	}
+
+	return false
+}
+
+// permitsName returns whether a name is within the permitted constraints (if any) and not within the excluded
+// constraints according to a match function.
+func permitsName(permitted []string, excluded []string, name string, match func(string, string) bool) bool {
+
+	for _, constraint := range excluded {
+		if match(name, constraint) {
+			return false
+		}
+	}
+
+	if len(permitted) == 0 {
+		return true
+	}
+
+	for _, constraint := range permitted {
+		if match(name, constraint) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// permitsIP returns whether an IP address is within the permitted ranges (if any) and not within the excluded ranges.
+func permitsIP(permitted []*net.IPNet, excluded []*net.IPNet, ip net.IP) bool {
+
+	contains := func(network *net.IPNet) bool {
+		return len(network.IP) == len(normalizeIP(ip, len(network.IP))) && network.Contains(ip)
+	}
+
+	for _, network := range excluded {
+		if contains(network) {
+			return false
+		}
+	}
+
+	if len(permitted) == 0 {
+		return true
+	}
+
+	for _, network := range permitted {
+		if contains(network) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizeIP returns an IP address in the form (i.e., IPv4 or IPv6) of the provided length if possible.
+func normalizeIP(ip net.IP, length int) net.IP {
+
+	if length == net.IPv4len {
+		if v4 := ip.To4(); v4 != nil {
+			return v4
+		}
+	}
+
+	return ip
+}
+
+// matchDomain returns whether a DNS name matches a domain constraint. A constraint with a leading period matches only
+// subdomains while any other constraint matches the domain and its subdomains (see RFC 5280 section 4.2.1.10).
+func matchDomain(name string, constraint string) bool {
+
+	name, constraint = strings.ToLower(name), strings.ToLower(constraint)
+
+	if constraint == "" {
+		return true
+	}
+
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(name, constraint)
+	}
+
+	return name == constraint || strings.HasSuffix(name, "."+constraint)
+}
+
+// matchEmail returns whether an email address matches a constraint that is either a mailbox or a domain.
+func matchEmail(address string, constraint string) bool {
+
+	if strings.Contains(constraint, "@") {
+		return strings.EqualFold(address, constraint)
+	}
+
+	index := strings.LastIndex(address, "@")
+	if index < 0 {
+		return false
+	}
+
+	return matchDomain(address[index+1:], constraint)
+}
+
+// matchURIDomain returns whether the host of a URI matches a domain constraint. Note that hosts which are IP addresses
+// never match as URI constraints only apply to domains.
+func matchURIDomain(host string, constraint string) bool {
+	return net.ParseIP(host) == nil && matchDomain(host, constraint)
+}
@@ -0,0 +1,235 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConstraints(t *testing.T) {
+
+	Convey("When checking templates", t, func() {
+
+		root := MustSelf("NauTLS (Root)", t)
+
+		template, err := ServerTemplate([]string{"api.nautls.com"}, []net.IP{net.ParseIP("10.0.0.1")})
+		So(err, ShouldBeNil)
+
+		constrained, err := IntermediateTemplate(pkix.Name{CommonName: "NauTLS (Constrained)"})
+		So(err, ShouldBeNil)
+
+		constrained.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		constrained.ExcludedDNSDomains = []string{"internal.nautls.com"}
+		constrained.PermittedDNSDomains = []string{"nautls.com"}
+		constrained.PermittedEmailAddresses = []string{"nautls.com"}
+		constrained.PermittedIPRanges = []*net.IPNet{{IP: net.IPv4(10, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)}}
+		constrained.PermittedURIDomains = []string{".nautls.com"}
+
+		authority, err := root.Issue(constrained, ECDSA, 256)
+		So(err, ShouldBeNil)
+
+		violations := func(err error) []Violation {
+			cause, ok := errors.Cause(err).(*ConstraintError)
+			So(ok, ShouldBeTrue)
+			return cause.Violations
+		}
+
+		Convey("#CheckTemplate is invoked", func() {
+
+			Convey("with a valid template", func() {
+
+				err := CheckTemplate(authority.Certificate, template)
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("with an issuer that is not an authority", func() {
+
+				issuer := MustIssue(root, "nautls.com", t)
+				template.NotAfter = issuer.Certificate.NotAfter
+
+				err := CheckTemplate(issuer.Certificate, template)
+
+				Convey("it returns the basic constraints and key usage violations", func() {
+					So(violations(err), ShouldHaveLength, 2)
+					So(violations(err)[0].Constraint, ShouldEqual, ConstraintBasic)
+					So(violations(err)[1].Constraint, ShouldEqual, ConstraintKeyUsage)
+				})
+			})
+
+			Convey("with an extended key usage the issuer does not permit", func() {
+
+				template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+
+				err := CheckTemplate(authority.Certificate, template)
+
+				Convey("it returns an extended key usage violation", func() {
+					So(violations(err), ShouldResemble, []Violation{{Constraint: ConstraintExtKeyUsage, Detail: "extended key usage [2] is not permitted by the issuer"}})
+				})
+			})
+
+			Convey("with an authority below an issuer with a zero path length", func() {
+
+				template, err := IntermediateTemplate(pkix.Name{CommonName: "NauTLS (Subordinate)"})
+				So(err, ShouldBeNil)
+
+				issuer, err := root.Issue(template, ECDSA, 256)
+				So(err, ShouldBeNil)
+
+				err = CheckTemplate(issuer.Certificate, template)
+
+				Convey("it returns a path length violation", func() {
+					So(violations(err), ShouldHaveLength, 1)
+					So(violations(err)[0].Constraint, ShouldEqual, ConstraintPathLength)
+				})
+			})
+
+			Convey("with a path length exceeding that of the issuer", func() {
+
+				issuer := *root.Certificate
+				issuer.MaxPathLen = 1
+
+				template, err := IntermediateTemplate(pkix.Name{CommonName: "NauTLS (Subordinate)"})
+				So(err, ShouldBeNil)
+
+				template.MaxPathLen = 1
+				template.MaxPathLenZero = false
+
+				err = CheckTemplate(&issuer, template)
+
+				Convey("it returns a path length violation", func() {
+					So(violations(err), ShouldHaveLength, 1)
+					So(violations(err)[0].Constraint, ShouldEqual, ConstraintPathLength)
+				})
+			})
+
+			Convey("with names outside the name constraints", func() {
+
+				template.DNSNames = []string{"nautls.org", "db.internal.nautls.com"}
+				template.EmailAddresses = []string{"ops@nautls.org"}
+				template.IPAddresses = []net.IP{net.ParseIP("192.168.0.1")}
+				template.URIs = []*url.URL{{Scheme: "spiffe", Host: "nautls.com", Path: "/api"}}
+
+				err := CheckTemplate(authority.Certificate, template)
+
+				Convey("it returns a name constraints violation for each name", func() {
+					So(violations(err), ShouldHaveLength, 5)
+					for _, violation := range violations(err) {
+						So(violation.Constraint, ShouldEqual, ConstraintNames)
+					}
+				})
+			})
+
+			Convey("with names within the name constraints", func() {
+
+				template.DNSNames = []string{"nautls.com", "API.nautls.com"}
+				template.EmailAddresses = []string{"ops@nautls.com"}
+				template.URIs = []*url.URL{{Scheme: "spiffe", Host: "api.nautls.com", Path: "/api"}}
+
+				err := CheckTemplate(authority.Certificate, template)
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("with a template that outlives the issuer", func() {
+
+				template.NotAfter = authority.Certificate.NotAfter.Add(time.Second)
+
+				err := CheckTemplate(authority.Certificate, template)
+
+				Convey("it returns a validity violation", func() {
+					So(violations(err), ShouldHaveLength, 1)
+					So(violations(err)[0].Constraint, ShouldEqual, ConstraintValidity)
+				})
+			})
+		})
+
+		Convey(".Issue is invoked", func() {
+
+			Convey("with a template that violates the constraints", func() {
+
+				template.DNSNames = []string{"nautls.org"}
+
+				_, err := authority.Issue(template, ECDSA, 256)
+
+				Convey("it returns a constraint error", func() {
+					So(err, ShouldNotBeNil)
+					So(violations(err), ShouldHaveLength, 1)
+					So(err.Error(), ShouldContainSubstring, "dns name [nautls.org] is not permitted by the issuer")
+				})
+			})
+		})
+
+		Convey(".IssueUnchecked is invoked", func() {
+
+			Convey("with a template that violates the constraints", func() {
+
+				template.DNSNames = []string{"nautls.org"}
+
+				identity, err := authority.IssueUnchecked(template, ECDSA, 256)
+
+				Convey("it issues the certificate", func() {
+					So(err, ShouldBeNil)
+					So(identity.Certificate.DNSNames, ShouldResemble, []string{"nautls.org"})
+					So(identity.Certificate.CheckSignatureFrom(authority.Certificate), ShouldBeNil)
+				})
+
+				Convey("it issues a certificate that peers reject", func() {
+
+					roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+					roots.AddCert(root.Certificate)
+					intermediates.AddCert(authority.Certificate)
+
+					_, err := identity.Certificate.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey(".SignRequest is invoked", func() {
+
+			Convey("with a request for names that violate the constraints", func() {
+
+				key, err := GenerateKey(ECDSA, 256)
+				So(err, ShouldBeNil)
+
+				request, err := NewRequest(Template{Subject: pkix.Name{CommonName: "nautls.org"}, DNSNames: []string{"nautls.org"}}, key)
+				So(err, ShouldBeNil)
+
+				template.DNSNames = []string{"nautls.org"}
+
+				_, err = authority.SignRequest(request, template)
+
+				Convey("it returns a constraint error", func() {
+					So(err, ShouldNotBeNil)
+					So(violations(err), ShouldHaveLength, 1)
+				})
+			})
+		})
+	})
+}
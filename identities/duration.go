@@ -0,0 +1,118 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+// Duration subtypes time.Duration to provide serialization support. Durations are represented as strings in the format
+// accepted by time.ParseDuration (e.g., "2160h") or as a whole number of days (e.g., "90d").
+type Duration time.Duration
+
+// MarshalJSON implements the json.Marshaler interface for Duration instances.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.ToString())
+}
+
+// MarshalYAML implements the yaml.Marshaler interface for Duration instances.
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.ToString(), nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for Duration instances.
+func (d *Duration) UnmarshalJSON(bytes []byte) error {
+
+	var value string
+
+	err := json.Unmarshal(bytes, &value)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling duration from json")
+	}
+
+	return d.FromString(value)
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for Duration instances.
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+
+	var value string
+
+	err := unmarshal(&value)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling duration from yaml")
+	}
+
+	return d.FromString(value)
+}
+
+// FromString sets the value of a duration to the value represented by a string or errors.
+func (d *Duration) FromString(value string) error {
+
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil {
+			return fmt.Errorf("error unmarshalling invalid duration value [%s]", value)
+		}
+		*d = Duration(time.Duration(days) * 24 * time.Hour)
+		return nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("error unmarshalling invalid duration value [%s]", value)
+	}
+
+	*d = Duration(duration)
+
+	return nil
+}
+
+// ToString returns the string representation of the duration.
+func (d Duration) ToString() string {
+	return time.Duration(d).String()
+}
+
+// StringToDuration returns a mapstructure.DecodeHookFunc that converts a string to a duration.
+func StringToDuration() mapstructure.DecodeHookFunc {
+
+	return func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+
+		if from != reflect.TypeOf("") {
+			return data, nil
+		}
+
+		if to != reflect.TypeOf(Duration(0)) {
+			return data, nil
+		}
+
+		var duration Duration
+
+		err := duration.FromString(data.(string))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error decoding string as duration")
+		}
+
+		return duration, nil
+	}
+}
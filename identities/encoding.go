@@ -0,0 +1,206 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// EncodeCertificates encodes X.509 certificates as concatenated PEM blocks in the order provided.
+func EncodeCertificates(certificates []*x509.Certificate) []byte {
+
+	var result []byte
+
+	for _, certificate := range certificates {
+		result = append(result, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})...)
+	}
+
+	return result
+}
+
+// EncodeKey encodes a private key as an unencrypted PKCS #8 ("PRIVATE KEY") PEM block.
+func EncodeKey(key crypto.Signer) ([]byte, error) {
+
+	bytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshalling pkcs #8 private key")
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: bytes}), nil
+}
+
+// EncodeEncryptedKey encodes a private key as a PKCS #8 ("ENCRYPTED PRIVATE KEY") PEM block encrypted with a passphrase
+// using PBES2 (i.e., PBKDF2 with HMAC-SHA256 and AES-256-CBC).
+func EncodeEncryptedKey(key crypto.Signer, passphrase []byte) ([]byte, error) {
+
+	if len(passphrase) == 0 {
+		return nil, errors.New("error encrypting pkcs #8 private key without a passphrase")
+	}
+
+	bytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshalling pkcs #8 private key")
+	}
+
+	encrypted, err := encryptPKCS8(bytes, passphrase)
+	if err != nil {
+		return nil, errors.Wrap(err, "error encrypting pkcs #8 private key")
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encrypted}), nil
+}
+
+// EncodeCertificate returns the certificate of the identity as a PEM block.
+func (i *Identity) EncodeCertificate() []byte {
+	return EncodeCertificates([]*x509.Certificate{i.Certificate})
+}
+
+// EncodeAuthorities returns the authorities of the identity as PEM blocks.
+func (i *Identity) EncodeAuthorities() []byte {
+	return EncodeCertificates(i.Authorities)
+}
+
+// EncodeChain returns the certificate followed by the authorities of the identity (i.e., leaf first) as PEM blocks.
+func (i *Identity) EncodeChain() []byte {
+	return EncodeCertificates(append([]*x509.Certificate{i.Certificate}, i.Authorities...))
+}
+
+// EncodeKey returns the key of the identity as an unencrypted PKCS #8 PEM block.
+func (i *Identity) EncodeKey() ([]byte, error) {
+	return EncodeKey(i.Key)
+}
+
+// EncodeEncryptedKey returns the key of the identity as a PKCS #8 PEM block encrypted with a passphrase (see
+// EncodeEncryptedKey).
+func (i *Identity) EncodeEncryptedKey(passphrase []byte) ([]byte, error) {
+	return EncodeEncryptedKey(i.Key, passphrase)
+}
+
+// Write persists the certificate, key and authorities of the identity as PEM encoded files and returns an
+// IdentityConfig that references them. Parent directories are created as needed and the key is written with
+// permissions that restrict access to the owner. Note that the authorities file is written even if it is empty so that
+// the returned configuration is always buildable.
+func (i *Identity) Write(certificatePath string, keyPath string, authoritiesPath string) (*IdentityConfig, error) {
+
+	key, err := i.EncodeKey()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error encoding key for [%s]", i.Certificate.Subject.CommonName)
+	}
+
+	return i.write(certificatePath, keyPath, authoritiesPath, key)
+}
+
+// WriteEncrypted persists the identity as Write does with the key encrypted with the passphrase (see
+// EncodeEncryptedKey) and returns an IdentityConfig that references the files and the passphrase. The passphrase must be
+// a URL (see IdentityConfig.Passphrase) that points to a non-empty passphrase.
+func (i *Identity) WriteEncrypted(certificatePath string, keyPath string, authoritiesPath string, passphrase string) (*IdentityConfig, error) {
+
+	loaded, err := LoadPassphrase(passphrase)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading passphrase for [%s]", i.Certificate.Subject.CommonName)
+	}
+
+	key, err := i.EncodeEncryptedKey(loaded)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error encoding key for [%s]", i.Certificate.Subject.CommonName)
+	}
+
+	config, err := i.write(certificatePath, keyPath, authoritiesPath, key)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Passphrase = passphrase
+
+	return config, nil
+}
+
+// write persists the certificate and authorities of the identity and an encoded key as PEM encoded files and returns an
+// IdentityConfig that references them.
+func (i *Identity) write(certificatePath string, keyPath string, authoritiesPath string, key []byte) (*IdentityConfig, error) {
+
+	certificate, err := writeFile(certificatePath, i.EncodeCertificate(), 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error writing certificate for [%s]", i.Certificate.Subject.CommonName)
+	}
+
+	authorities, err := writeFile(authoritiesPath, i.EncodeAuthorities(), 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error writing authorities for [%s]", i.Certificate.Subject.CommonName)
+	}
+
+	keyFile, err := writeFile(keyPath, key, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error writing key for [%s]", i.Certificate.Subject.CommonName)
+	}
+
+	config := &IdentityConfig{
+		Authorities: fmt.Sprintf("file://%s", authorities),
+		Certificate: fmt.Sprintf("file://%s", certificate),
+		Key:         fmt.Sprintf("file://%s", keyFile),
+	}
+
+	return config, nil
+}
+
+// writeFile writes content to a path creating parent directories as necessary and returns the absolute path. The content
+// is written to a temporary file (created with permissions that restrict access to the owner) that is given the
+// permissions and renamed over the path such that the permissions of an existing file are replaced and its content is
+// never readable with the permissions of the existing file.
+func writeFile(path string, content []byte, permission os.FileMode) (string, error) {
+
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "error resolving absolute path [%s]", path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(absolute), 0755); err != nil {
+		return "", errors.Wrapf(err, "error creating parent directories [%s]", absolute)
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(absolute), filepath.Base(absolute)+".tmp")
+	if err != nil {
+		return "", errors.Wrapf(err, "error creating temporary file for [%s]", absolute)
+	}
+
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return "", errors.Wrapf(err, "error writing file [%s]", absolute)
+	}
+
+	if err := file.Close(); err != nil {
+		return "", errors.Wrapf(err, "error closing temporary file for [%s]", absolute)
+	}
+
+	if err := os.Chmod(file.Name(), permission); err != nil {
+		return "", errors.Wrapf(err, "error setting permissions of [%s]", absolute)
+	}
+
+	if err := os.Rename(file.Name(), absolute); err != nil {
+		return "", errors.Wrapf(err, "error renaming temporary file to [%s]", absolute)
+	}
+
+	return absolute, nil
+}
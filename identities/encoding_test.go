@@ -0,0 +1,208 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/deciphernow/nautls/internal/temporary"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEncoding(t *testing.T) {
+
+	Convey("When Identity", t, func() {
+
+		root := MustSelf("NauTLS (Root)", t)
+		intermediate := MustIntermediate(root, "NauTLS (Intermediate)", t)
+		identity := MustIssue(intermediate, "nautls.com", t)
+
+		Convey(".EncodeCertificate is invoked", func() {
+
+			certificates, err := DecodeCertificates(identity.EncodeCertificate())
+
+			Convey("it returns the certificate", func() {
+				So(certificates, ShouldResemble, []*x509.Certificate{identity.Certificate})
+			})
+
+			Convey("it returns decodable content", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey(".EncodeChain is invoked", func() {
+
+			certificates, err := DecodeCertificates(identity.EncodeChain())
+
+			Convey("it returns the chain leaf first", func() {
+				So(certificates, ShouldResemble, []*x509.Certificate{identity.Certificate, intermediate.Certificate, root.Certificate})
+			})
+
+			Convey("it returns decodable content", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey(".EncodeKey is invoked", func() {
+
+			bytes, err := identity.EncodeKey()
+			block, _ := pem.Decode(bytes)
+			keys, _ := DecodeKeys(bytes, nil)
+
+			Convey("it returns a pkcs #8 block", func() {
+				So(block.Type, ShouldEqual, "PRIVATE KEY")
+			})
+
+			Convey("it returns the key", func() {
+				So(keys, ShouldResemble, []crypto.Signer{identity.Key})
+			})
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey(".EncodeEncryptedKey is invoked", func() {
+
+			bytes, err := identity.EncodeEncryptedKey([]byte("passphrase"))
+			So(err, ShouldBeNil)
+
+			block, _ := pem.Decode(bytes)
+
+			Convey("it returns an encrypted pkcs #8 block", func() {
+				So(block.Type, ShouldEqual, "ENCRYPTED PRIVATE KEY")
+			})
+
+			Convey("it returns the key for the passphrase", func() {
+				keys, err := DecodeKeys(bytes, []byte("passphrase"))
+				So(err, ShouldBeNil)
+				So(keys, ShouldResemble, []crypto.Signer{identity.Key})
+			})
+
+			Convey("it returns a key that another passphrase does not decrypt", func() {
+				_, err := DecodeKeys(bytes, []byte("other"))
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("without a passphrase", func() {
+
+				_, err := identity.EncodeEncryptedKey(nil)
+
+				Convey("it returns an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey(".WriteEncrypted is invoked", func() {
+
+			var config *IdentityConfig
+			var loaded *Identity
+			var writeErr, loadErr error
+			var encrypted bool
+
+			temporary.WithDirectory(func(directory string) (interface{}, error) {
+				config, writeErr = identity.WriteEncrypted(
+					filepath.Join(directory, "identity.crt"),
+					filepath.Join(directory, "identity.key"),
+					filepath.Join(directory, "authorities.crt"),
+					"base64:///cGFzc3BocmFzZQ==")
+				if writeErr == nil {
+					bytes, _ := ioutil.ReadFile(filepath.Join(directory, "identity.key"))
+					block, _ := pem.Decode(bytes)
+					encrypted = block != nil && block.Type == "ENCRYPTED PRIVATE KEY"
+					loaded, loadErr = config.Build()
+				}
+				return nil, nil
+			})
+
+			Convey("it writes an encrypted key", func() {
+				So(writeErr, ShouldBeNil)
+				So(encrypted, ShouldBeTrue)
+			})
+
+			Convey("it returns a configuration that builds the identity with the passphrase", func() {
+				So(loadErr, ShouldBeNil)
+				So(config.Passphrase, ShouldEqual, "base64:///cGFzc3BocmFzZQ==")
+				So(loaded.Key, ShouldResemble, identity.Key)
+			})
+		})
+
+		Convey(".Write is invoked", func() {
+
+			var config *IdentityConfig
+			var loaded *Identity
+			var writeErr, loadErr error
+			var permission os.FileMode
+
+			temporary.WithDirectory(func(directory string) (interface{}, error) {
+				config, writeErr = identity.Write(
+					filepath.Join(directory, "tls", "identity.crt"),
+					filepath.Join(directory, "tls", "identity.key"),
+					filepath.Join(directory, "tls", "authorities.crt"))
+				if writeErr == nil {
+					info, _ := os.Stat(filepath.Join(directory, "tls", "identity.key"))
+					permission = info.Mode().Perm()
+					loaded, loadErr = config.Build()
+				}
+				return nil, nil
+			})
+
+			Convey("it returns a nil error", func() {
+				So(writeErr, ShouldBeNil)
+			})
+
+			Convey("it restricts access to the key", func() {
+				So(permission, ShouldEqual, os.FileMode(0600))
+			})
+
+			Convey("over an existing key readable by others", func() {
+
+				var overwritten os.FileMode
+
+				temporary.WithDirectory(func(directory string) (interface{}, error) {
+					path := filepath.Join(directory, "identity.key")
+					if err := ioutil.WriteFile(path, []byte("existing"), 0644); err != nil {
+						return nil, err
+					}
+					os.Chmod(path, 0644)
+					_, writeErr = identity.Write(filepath.Join(directory, "identity.crt"), path, filepath.Join(directory, "authorities.crt"))
+					info, _ := os.Stat(path)
+					overwritten = info.Mode().Perm()
+					return nil, nil
+				})
+
+				Convey("it restricts access to the key", func() {
+					So(writeErr, ShouldBeNil)
+					So(overwritten, ShouldEqual, os.FileMode(0600))
+				})
+			})
+
+			Convey("it returns a configuration that builds the identity", func() {
+				So(loadErr, ShouldBeNil)
+				So(loaded.Certificate, ShouldResemble, identity.Certificate)
+				So(loaded.Authorities, ShouldResemble, identity.Authorities)
+				So(loaded.Key, ShouldResemble, identity.Key)
+			})
+		})
+	})
+}
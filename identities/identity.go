@@ -15,22 +15,25 @@
 package identities
 
 import (
+	"crypto"
 	"crypto/rand"
-	"crypto/rsa"
+	"crypto/tls"
 	"crypto/x509"
+	"fmt"
 
 	"github.com/pkg/errors"
 )
 
-// Identity represents an X.509 identity.
+// Identity represents an X.509 identity. Note that the certificates revoked by an issuing identity are tracked by a
+// RevocationRegistry.
 type Identity struct {
 	Authorities []*x509.Certificate
 	Certificate *x509.Certificate
-	Key         *rsa.PrivateKey
+	Key         crypto.Signer
 }
 
 // NewIdentity returns a new identity.
-func NewIdentity(authorities []*x509.Certificate, certificate *x509.Certificate, key *rsa.PrivateKey) *Identity {
+func NewIdentity(authorities []*x509.Certificate, certificate *x509.Certificate, key crypto.Signer) *Identity {
 	return &Identity{
 		Authorities: authorities,
 		Certificate: certificate,
@@ -38,15 +41,15 @@ func NewIdentity(authorities []*x509.Certificate, certificate *x509.Certificate,
 	}
 }
 
-// Self generates a self signed identity (e.g., a root).
-func Self(template Template) (*Identity, error) {
+// Self generates a self signed identity (e.g., a root) with a key of the provided algorithm and size.
+func Self(template Template, algorithm KeyAlgorithm, size int) (*Identity, error) {
 
-	key, err := rsa.GenerateKey(rand.Reader, 4096)
+	key, err := GenerateKey(algorithm, size)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error generating private key for [%s]", template.Subject.CommonName)
 	}
 
-	certificate, err := sign(template.certificate(), template.certificate(), &key.PublicKey, key)
+	certificate, err := sign(template.certificate(), template.certificate(), key.Public(), key)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error signing certificate for [%s]", template.Subject.CommonName)
 	}
@@ -54,15 +57,29 @@ func Self(template Template) (*Identity, error) {
 	return NewIdentity([]*x509.Certificate{}, certificate, key), nil
 }
 
-// Issue returns a new identity signed by this identity based upon a template.
-func (i *Identity) Issue(template Template) (*Identity, error) {
+// Issue returns a new identity signed by this identity based upon a template with a key of the provided algorithm and
+// size. A *ConstraintError is returned if the template violates the constraints of this identity (see CheckTemplate)
+// and IssueUnchecked must be used to issue deliberately invalid certificates.
+func (i *Identity) Issue(template Template, algorithm KeyAlgorithm, size int) (*Identity, error) {
 
-	key, err := rsa.GenerateKey(rand.Reader, 4096)
+	if err := CheckTemplate(i.Certificate, template); err != nil {
+		return nil, errors.Wrapf(err, "error issuing certificate for [%s]", template.Subject.CommonName)
+	}
+
+	return i.IssueUnchecked(template, algorithm, size)
+}
+
+// IssueUnchecked returns a new identity signed by this identity based upon a template without checking the template
+// against the constraints of this identity. It is intended for deliberately invalid certificates (e.g., in tests of
+// peers that must reject them) and Issue should be used otherwise.
+func (i *Identity) IssueUnchecked(template Template, algorithm KeyAlgorithm, size int) (*Identity, error) {
+
+	key, err := GenerateKey(algorithm, size)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error generating private key for [%s]", template.Subject.CommonName)
 	}
 
-	certificate, err := sign(template.certificate(), i.Certificate, &key.PublicKey, i.Key)
+	certificate, err := sign(template.certificate(), i.Certificate, key.Public(), i.Key)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error signing certificate for [%s]", template.Subject.CommonName)
 	}
@@ -70,8 +87,108 @@ func (i *Identity) Issue(template Template) (*Identity, error) {
 	return NewIdentity(append([]*x509.Certificate{i.Certificate}, i.Authorities...), certificate, key), nil
 }
 
-// sign returns a signed certificate for the provided template.
-func sign(template, parent *x509.Certificate, public *rsa.PublicKey, private *rsa.PrivateKey) (*x509.Certificate, error) {
+// Verify confirms that the key of the identity matches the public key of the certificate and that the certificate
+// chains to the authorities of the identity. The roots and intermediates of the options are replaced with pools built
+// from the authorities such that authorities which are not issued by another authority are trusted as roots. All other
+// options (e.g., the extended key usages and the current time) are honored. Note that an identity without authorities
+// must be self signed.
+func (i *Identity) Verify(options x509.VerifyOptions) error {
+
+	if i.Key == nil || !matches(i.Key, i.Certificate.PublicKey) {
+		return fmt.Errorf("key does not match the public key of the certificate for [%s]", i.Certificate.Subject.CommonName)
+	}
+
+	options.Roots, options.Intermediates = i.pools()
+
+	if _, err := i.Certificate.Verify(options); err != nil {
+		return errors.Wrapf(err, "certificate for [%s] does not chain to the authorities", i.Certificate.Subject.CommonName)
+	}
+
+	return nil
+}
+
+// TLSCertificate returns the identity as a tls.Certificate with the authorities attached as the certificate chain in the
+// order they are defined. Self signed authorities are omitted as they are trust anchors that peers must already hold.
+// An error is returned if the key does not match the public key of the certificate.
+func (i *Identity) TLSCertificate() (tls.Certificate, error) {
+
+	if i.Key == nil || !matches(i.Key, i.Certificate.PublicKey) {
+		return tls.Certificate{}, fmt.Errorf("key does not match the public key of the certificate for [%s]", i.Certificate.Subject.CommonName)
+	}
+
+	certificate := tls.Certificate{
+		Certificate: [][]byte{i.Certificate.Raw},
+		Leaf:        i.Certificate,
+		PrivateKey:  i.Key,
+	}
+
+	for _, authority := range i.Authorities {
+		if !IsSelfSigned(authority) {
+			certificate.Certificate = append(certificate.Certificate, authority.Raw)
+		}
+	}
+
+	return certificate, nil
+}
+
+// TrustPool returns a certificate pool containing the roots of the identity (i.e., those authorities that were not
+// issued by another authority) suitable for verifying peers issued by the same authorities. Note that the pool
+// contains the certificate itself if the identity has no authorities.
+func (i *Identity) TrustPool() *x509.CertPool {
+	roots, _ := i.pools()
+	return roots
+}
+
+// pools returns certificate pools of the roots and intermediates of the identity.
+func (i *Identity) pools() (*x509.CertPool, *x509.CertPool) {
+
+	authorities := i.Authorities
+	if len(authorities) == 0 {
+		authorities = []*x509.Certificate{i.Certificate}
+	}
+
+	roots := x509.NewCertPool()
+	intermediates := x509.NewCertPool()
+
+	for _, authority := range authorities {
+		if issued(authority, authorities) {
+			intermediates.AddCert(authority)
+		} else {
+			roots.AddCert(authority)
+		}
+	}
+
+	return roots, intermediates
+}
+
+// issued returns a value indicating whether a certificate was issued by any other certificate in a slice.
+func issued(certificate *x509.Certificate, certificates []*x509.Certificate) bool {
+
+	for _, candidate := range certificates {
+		if !candidate.Equal(certificate) && IssuedBy(certificate, candidate) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sign returns a signed certificate for the provided template. Note that the template must define a serial number and
+// that the subject key identifier is computed from the public key if it is not defined by the template. The authority
+// key identifier is taken from the subject key identifier of the parent.
+func sign(template, parent *x509.Certificate, public crypto.PublicKey, private crypto.Signer) (*x509.Certificate, error) {
+
+	if template.SerialNumber == nil {
+		return nil, fmt.Errorf("error signing certificate for [%s] without a serial number", template.Subject.CommonName)
+	}
+
+	if len(template.SubjectKeyId) == 0 {
+		id, err := SubjectKeyID(public)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error computing subject key identifier for [%s]", template.Subject.CommonName)
+		}
+		template.SubjectKeyId = id
+	}
 
 	bytes, err := x509.CreateCertificate(rand.Reader, template, parent, public, private)
 	if err != nil {
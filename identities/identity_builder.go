@@ -51,7 +51,8 @@ func (b *IdentityBuilder) WithCertificate(certificate string) *IdentityBuilder {
 	return b
 }
 
-// WithKey sets the key for the identity. The value must be a URL that points to the location of a PEM encoded RSA key.
+// WithKey sets the key for the identity. The value must be a URL that points to the location of a PEM encoded private
+// key in PKCS #1, PKCS #8 or SEC 1 format.
 //
 // Note that in addition to those schemes supported by [getter](https://godoc.org/github.com/hashicorp/go-getter) a
 // "base64" scheme is supported for providing the PEM encoded certifiate in the path of the URL directly. This is most
@@ -60,3 +61,33 @@ func (b *IdentityBuilder) WithKey(key string) *IdentityBuilder {
 	b.config.Key = key
 	return b
 }
+
+// WithPassphrase sets the passphrase used to decrypt an encrypted key or the password of a PKCS #12 bundle. The value
+// must be a URL that points to the location of the passphrase.
+//
+// Note that in addition to those schemes supported by [getter](https://godoc.org/github.com/hashicorp/go-getter) a
+// "base64" scheme is supported for providing the passphrase in the path of the URL directly. This is most applicable
+// when the passphrase must be provided via an environement variable.
+func (b *IdentityBuilder) WithPassphrase(passphrase string) *IdentityBuilder {
+	b.config.Passphrase = passphrase
+	return b
+}
+
+// WithPKCS12 sets a PKCS #12 bundle containing the certificate, key and authorities for the identity. The value must be
+// a URL that points to the location of a DER encoded PKCS #12 bundle and may not be combined with the authorities,
+// certificate or key.
+//
+// Note that in addition to those schemes supported by [getter](https://godoc.org/github.com/hashicorp/go-getter) a
+// "base64" scheme is supported for providing the bundle in the path of the URL directly. This is most applicable when
+// the bundle must be provided via an environement variable.
+func (b *IdentityBuilder) WithPKCS12(pkcs12 string) *IdentityBuilder {
+	b.config.PKCS12 = pkcs12
+	return b
+}
+
+// WithVerify sets whether the identity is verified when built. When enabled the key must match the certificate and the
+// certificate must chain to the authorities.
+func (b *IdentityBuilder) WithVerify(verify bool) *IdentityBuilder {
+	b.config.Verify = verify
+	return b
+}
@@ -15,11 +15,12 @@
 package identities
 
 import (
-	"crypto/rsa"
+	"crypto"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 	"net/url"
+	"strings"
 
 	"github.com/deciphernow/nautls/internal/urls"
 	"github.com/pkg/errors"
@@ -30,11 +31,51 @@ type IdentityConfig struct {
 	Authorities string `json:"authorities" mapstructure:"authorities" yaml:"authorities"`
 	Certificate string `json:"certificate" mapstructure:"certificate" yaml:"certificate"`
 	Key         string `json:"key" mapstructure:"key" yaml:"key"`
+
+	// Passphrase defines the passphrase used to decrypt an encrypted key or, if PKCS12 is defined, the password of the
+	// PKCS #12 bundle. The value must be a URL that points to the location of the passphrase. Note that trailing line
+	// breaks are removed from the passphrase.
+	Passphrase string `json:"passphrase" mapstructure:"passphrase" yaml:"passphrase"`
+
+	// PKCS12 defines a PKCS #12 (i.e., .p12 or .pfx) bundle containing the certificate, key and authorities of the
+	// identity. The value must be a URL that points to the location of a DER encoded PKCS #12 bundle and may not be
+	// combined with the authorities, certificate and key.
+	PKCS12 string `json:"pkcs12" mapstructure:"pkcs12" yaml:"pkcs12"`
+
+	// Verify defines whether the identity is verified when built. When enabled the key must match the certificate and
+	// the certificate must chain to the authorities (see Identity.Verify) for any extended key usage at the current time.
+	Verify bool `json:"verify" mapstructure:"verify" yaml:"verify"`
 }
 
 // Build creates an Identity from the IdentityConfig instance.
 func (c *IdentityConfig) Build() (*Identity, error) {
 
+	identity, err := c.build()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Verify {
+		if err := identity.Verify(x509.VerifyOptions{KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+			return nil, errors.Wrap(err, "error verifying identity")
+		}
+	}
+
+	return identity, nil
+}
+
+// build loads the Identity from either the PEM encoded resources or the PKCS #12 bundle of the IdentityConfig instance.
+func (c *IdentityConfig) build() (*Identity, error) {
+
+	passphrase, err := LoadPassphrase(c.Passphrase)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading passphrase from [%s]", c.Passphrase)
+	}
+
+	if c.PKCS12 != "" {
+		return c.buildPKCS12(passphrase)
+	}
+
 	authorities, err := loadCertificates(c.Authorities)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error loading authorities from [%s]", c.Authorities)
@@ -45,7 +86,7 @@ func (c *IdentityConfig) Build() (*Identity, error) {
 		return nil, errors.Wrapf(err, "error loading certificate from [%s]", c.Certificate)
 	}
 
-	key, err := loadKey(c.Key)
+	key, err := loadKey(c.Key, passphrase)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error loading key from [%s]", c.Key)
 	}
@@ -55,6 +96,26 @@ func (c *IdentityConfig) Build() (*Identity, error) {
 	return identity, nil
 }
 
+// buildPKCS12 creates an Identity from the PKCS #12 bundle of the IdentityConfig instance.
+func (c *IdentityConfig) buildPKCS12(password []byte) (*Identity, error) {
+
+	if c.Authorities != "" || c.Certificate != "" || c.Key != "" {
+		return nil, fmt.Errorf("pkcs12 [%s] may not be combined with authorities, certificate or key", c.PKCS12)
+	}
+
+	bytes, err := loadResource(c.PKCS12)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading pkcs12 from [%s]", c.PKCS12)
+	}
+
+	identity, err := DecodePKCS12(bytes, string(password))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error decoding pkcs12 from [%s]", c.PKCS12)
+	}
+
+	return identity, nil
+}
+
 // loadCertificate loads a single PEM encoded X.509 certificate from a URL. Note that an error is thrown if the number
 // of certificates decoded is not one.
 func loadCertificate(resource string) (*x509.Certificate, error) {
@@ -82,7 +143,7 @@ func loadCertificates(resource string) ([]*x509.Certificate, error) {
 		return nil, errors.Wrapf(err, "error loading certificates from [%s]", resource)
 	}
 
-	certificates, err := decodeCertificates(bytes)
+	certificates, err := DecodeCertificates(bytes)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error decoding certificates from [%s]", resource)
 	}
@@ -90,11 +151,11 @@ func loadCertificates(resource string) ([]*x509.Certificate, error) {
 	return certificates, nil
 }
 
-// loadKey loads a single PEM encoded RSA key from a URL. Note that an error is thrown if the number
+// loadKey loads a single PEM encoded private key from a URL. Note that an error is thrown if the number
 // of keys decoded is not one.
-func loadKey(resource string) (*rsa.PrivateKey, error) {
+func loadKey(resource string, passphrase []byte) (crypto.Signer, error) {
 
-	keys, err := loadKeys(resource)
+	keys, err := loadKeys(resource, passphrase)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error loading key from [%s]", resource)
 	}
@@ -109,26 +170,25 @@ func loadKey(resource string) (*rsa.PrivateKey, error) {
 	}
 }
 
-// loadCertificates loads PEM encoded RSA Keys from a URL.
-func loadKeys(resource string) ([]*rsa.PrivateKey, error) {
+// loadKeys loads PEM encoded private keys from a URL decrypting them with the passphrase if necessary.
+func loadKeys(resource string, passphrase []byte) ([]crypto.Signer, error) {
 
 	bytes, err := loadResource(resource)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error loading keys from [%s]", resource)
 	}
 
-	keys, err := decodeKeys(bytes)
+	keys, err := DecodeKeys(bytes, passphrase)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error decoding keys from [%s]", resource)
 	}
 
 	return keys, nil
-
 }
 
-// decodeCertificates decodes PEM encoded X.509 certificates. Note that unparsable values outside a PEM block are
+// DecodeCertificates decodes PEM encoded X.509 certificates. Note that unparsable values outside a PEM block are
 // ignored while unparsable values inside a PEM block will result in an error.
-func decodeCertificates(bytes []byte) ([]*x509.Certificate, error) {
+func DecodeCertificates(bytes []byte) ([]*x509.Certificate, error) {
 
 	var result []*x509.Certificate
 
@@ -148,26 +208,20 @@ func decodeCertificates(bytes []byte) ([]*x509.Certificate, error) {
 	return result, nil
 }
 
-// decodeKeys decodes PEM encoded RSA keys. Note that unparsable values outside a PEM block are ignored while unparsable
-// values inside a PEM block will result in an error.
-func decodeKeys(bytes []byte) ([]*rsa.PrivateKey, error) {
-
-	var result []*rsa.PrivateKey
-
-	decoded, tail := pem.Decode(bytes)
-	for decoded != nil {
-
-		parsed, err := x509.ParsePKCS1PrivateKey(decoded.Bytes)
-		if err != nil {
-			return nil, errors.Wrap(err, "error parsing keys")
-		}
+// LoadPassphrase loads a passphrase from a URL removing any trailing line breaks. Note that a nil passphrase is returned
+// if the URL is empty.
+func LoadPassphrase(resource string) ([]byte, error) {
 
-		result = append(result, parsed)
+	if resource == "" {
+		return nil, nil
+	}
 
-		decoded, tail = pem.Decode(tail)
+	bytes, err := loadResource(resource)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading passphrase from [%s]", resource)
 	}
 
-	return result, nil
+	return []byte(strings.TrimRight(string(bytes), "\r\n")), nil
 }
 
 // loadResource loads a resource URL into a byte array.
@@ -15,16 +15,38 @@
 package identities
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"net/url"
+	"path/filepath"
 	"testing"
 
+	"github.com/deciphernow/nautls/internal/temporary"
 	"github.com/deciphernow/nautls/internal/tests"
 	"gopkg.in/yaml.v2"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
 
+// mustKeyURL returns a base64 URL of a PEM encoded key marshalled with a function or fails the test.
+func mustKeyURL(key crypto.Signer, kind string, marshal func(crypto.Signer) ([]byte, error), t *testing.T) string {
+
+	bytes, err := marshal(key)
+	if err != nil {
+		t.Fatalf("error marshalling key [%s]", err.Error())
+	}
+
+	encoded := pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: bytes})
+
+	return fmt.Sprintf("base64:///%s", url.PathEscape(base64.StdEncoding.EncodeToString(encoded)))
+}
+
 func TestIdentityConfig(t *testing.T) {
 
 	Convey("When IdentityConfig", t, func() {
@@ -135,6 +157,66 @@ func TestIdentityConfig(t *testing.T) {
 				})
 			})
 
+			Convey("with a sec 1 key and ec parameters", func() {
+
+				config.Key = fmt.Sprintf("file://%s", tests.MustAbsolutePath("testdata/sec1.key", t))
+				identity, err := config.Build()
+
+				Convey("it should return an ecdsa key", func() {
+					So(identity.Key, ShouldHaveSameTypeAs, &ecdsa.PrivateKey{})
+				})
+
+				Convey("it should return a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("with a pkcs #8 key", func() {
+
+				config.Key = fmt.Sprintf("file://%s", tests.MustAbsolutePath("testdata/pkcs8.key", t))
+				identity, err := config.Build()
+
+				Convey("it should return an ed25519 key", func() {
+					So(identity.Key, ShouldHaveSameTypeAs, ed25519.PrivateKey{})
+				})
+
+				Convey("it should return a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("with an encrypted key", func() {
+
+				config.Key = fmt.Sprintf("file://%s", tests.MustAbsolutePath("testdata/pkcs8-encrypted.key", t))
+
+				Convey("and a passphrase", func() {
+
+					config.Passphrase = "base64:///" + base64.StdEncoding.EncodeToString([]byte("nautls\n"))
+					identity, err := config.Build()
+
+					Convey("it should return an ecdsa key", func() {
+						So(identity.Key, ShouldHaveSameTypeAs, &ecdsa.PrivateKey{})
+					})
+
+					Convey("it should return a nil error", func() {
+						So(err, ShouldBeNil)
+					})
+				})
+
+				Convey("and no passphrase", func() {
+
+					identity, err := config.Build()
+
+					Convey("it should return a nil identity", func() {
+						So(identity, ShouldBeNil)
+					})
+
+					Convey("it should return a non-nil error", func() {
+						So(err, ShouldNotBeNil)
+					})
+				})
+			})
+
 			Convey("with multiple keys", func() {
 
 				config.Key = fmt.Sprintf("file://%s", tests.MustAbsolutePath("testdata/multiple.key", t))
@@ -148,6 +230,166 @@ func TestIdentityConfig(t *testing.T) {
 					So(err, ShouldNotBeNil)
 				})
 			})
+
+			Convey("with an ecdsa key", func() {
+
+				key, err := GenerateKey(ECDSA, 256)
+				So(err, ShouldBeNil)
+
+				Convey("encoded as pkcs #8", func() {
+
+					config.Key = mustKeyURL(key, "PRIVATE KEY", func(key crypto.Signer) ([]byte, error) {
+						return x509.MarshalPKCS8PrivateKey(key)
+					}, t)
+
+					identity, err := config.Build()
+
+					Convey("it should return the ecdsa key", func() {
+						So(identity.Key, ShouldHaveSameTypeAs, &ecdsa.PrivateKey{})
+					})
+
+					Convey("it should return a nil error", func() {
+						So(err, ShouldBeNil)
+					})
+				})
+
+				Convey("encoded as sec 1", func() {
+
+					config.Key = mustKeyURL(key, "EC PRIVATE KEY", func(key crypto.Signer) ([]byte, error) {
+						return x509.MarshalECPrivateKey(key.(*ecdsa.PrivateKey))
+					}, t)
+
+					identity, err := config.Build()
+
+					Convey("it should return the ecdsa key", func() {
+						So(identity.Key, ShouldHaveSameTypeAs, &ecdsa.PrivateKey{})
+					})
+
+					Convey("it should return a nil error", func() {
+						So(err, ShouldBeNil)
+					})
+				})
+			})
+
+			Convey("with an ed25519 key encoded as pkcs #8", func() {
+
+				key, err := GenerateKey(Ed25519, 0)
+				So(err, ShouldBeNil)
+
+				config.Key = mustKeyURL(key, "PRIVATE KEY", func(key crypto.Signer) ([]byte, error) {
+					return x509.MarshalPKCS8PrivateKey(key)
+				}, t)
+
+				identity, err := config.Build()
+
+				Convey("it should return the ed25519 key", func() {
+					So(identity.Key, ShouldHaveSameTypeAs, ed25519.PrivateKey{})
+				})
+
+				Convey("it should return a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+		})
+
+		Convey(".Build is invoked with a pkcs12 bundle", func() {
+
+			config := &IdentityConfig{
+				PKCS12:     fmt.Sprintf("file://%s", tests.MustAbsolutePath("testdata/bundle.p12", t)),
+				Passphrase: "base64:///" + base64.StdEncoding.EncodeToString([]byte("nautls")),
+			}
+
+			Convey("alone", func() {
+
+				identity, err := config.Build()
+
+				Convey("it should return the certificate", func() {
+					So(identity.Certificate.Subject.CommonName, ShouldEqual, "nautls.com")
+				})
+
+				Convey("it should return the authorities", func() {
+					So(identity.Authorities, ShouldHaveLength, 1)
+				})
+
+				Convey("it should return a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("with a certificate", func() {
+
+				config.Certificate = fmt.Sprintf("file://%s", tests.MustAbsolutePath("testdata/single.crt", t))
+				identity, err := config.Build()
+
+				Convey("it should return a nil identity", func() {
+					So(identity, ShouldBeNil)
+				})
+
+				Convey("it should return a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey(".Build is invoked with verification", func() {
+
+			root := MustSelf("NauTLS (Root)", t)
+			identity := MustIssue(root, "nautls.com", t)
+
+			var config *IdentityConfig
+
+			temporary.WithDirectory(func(directory string) (interface{}, error) {
+
+				config, _ = identity.Write(
+					filepath.Join(directory, "identity.crt"),
+					filepath.Join(directory, "identity.key"),
+					filepath.Join(directory, "authorities.crt"))
+				config.Verify = true
+
+				Convey("with a valid identity", func() {
+
+					built, err := config.Build()
+
+					Convey("it should return a non-nil identity", func() {
+						So(built, ShouldNotBeNil)
+					})
+
+					Convey("it should return a nil error", func() {
+						So(err, ShouldBeNil)
+					})
+				})
+
+				Convey("with a mismatched key", func() {
+
+					key, _ := EncodeKey(root.Key)
+					config.Key = "base64:///" + url.PathEscape(base64.StdEncoding.EncodeToString(key))
+					built, err := config.Build()
+
+					Convey("it should return a nil identity", func() {
+						So(built, ShouldBeNil)
+					})
+
+					Convey("it should return a non-nil error", func() {
+						So(err, ShouldNotBeNil)
+					})
+				})
+
+				Convey("with unrelated authorities", func() {
+
+					config.Authorities = "base64:///" + url.PathEscape(base64.StdEncoding.EncodeToString(MustSelf("NauTLS (Unrelated)", t).EncodeCertificate()))
+					built, err := config.Build()
+
+					Convey("it should return a nil identity", func() {
+						So(built, ShouldBeNil)
+					})
+
+					Convey("it should return a non-nil error", func() {
+						So(err, ShouldNotBeNil)
+					})
+				})
+
+				return nil, nil
+			})
 		})
 
 		Convey(" is deserialized", func() {
@@ -158,6 +400,9 @@ func TestIdentityConfig(t *testing.T) {
 				"authorities": "authorities",
 				"certificate": "certificate",
 				"key":         "key",
+				"passphrase":  "passphrase",
+				"pkcs12":      "pkcs12",
+				"verify":      "true",
 			}
 
 			Convey("from JSON", func() {
@@ -176,6 +421,18 @@ func TestIdentityConfig(t *testing.T) {
 					So(actual.Key, ShouldEqual, expected["key"])
 				})
 
+				Convey("it should populate the passphrase", func() {
+					So(actual.Passphrase, ShouldEqual, expected["passphrase"])
+				})
+
+				Convey("it should populate the pkcs12", func() {
+					So(actual.PKCS12, ShouldEqual, expected["pkcs12"])
+				})
+
+				Convey("it should populate the verify", func() {
+					So(actual.Verify, ShouldBeTrue)
+				})
+
 				Convey("it should return a nil error", func() {
 					So(err, ShouldBeNil)
 				})
@@ -197,6 +454,18 @@ func TestIdentityConfig(t *testing.T) {
 					So(actual.Key, ShouldEqual, expected["key"])
 				})
 
+				Convey("it should populate the passphrase", func() {
+					So(actual.Passphrase, ShouldEqual, expected["passphrase"])
+				})
+
+				Convey("it should populate the pkcs12", func() {
+					So(actual.PKCS12, ShouldEqual, expected["pkcs12"])
+				})
+
+				Convey("it should populate the verify", func() {
+					So(actual.Verify, ShouldBeTrue)
+				})
+
 				Convey("it should return a nil error", func() {
 					So(err, ShouldBeNil)
 				})
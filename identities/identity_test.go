@@ -15,6 +15,8 @@
 package identities
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
@@ -25,6 +27,58 @@ import (
 	. "github.com/smartystreets/goconvey/convey"
 )
 
+// MustSelf generates a self signed certificate authority valid for ten years with an ECDSA key or fails the test.
+func MustSelf(name string, t *testing.T) *Identity {
+	identity, err := Self(Template{
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		NotBefore:             time.Now().Add(-time.Minute),
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+	}, ECDSA, 256)
+	if err != nil {
+		t.Fatalf("error generating authority [%s]", err.Error())
+	}
+	return identity
+}
+
+// MustIntermediate issues an intermediate certificate authority with an ECDSA key from an authority or fails the test.
+func MustIntermediate(authority *Identity, name string, t *testing.T) *Identity {
+	identity, err := authority.Issue(Template{
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		NotBefore:             time.Now().Add(-time.Minute),
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+	}, ECDSA, 256)
+	if err != nil {
+		t.Fatalf("error issuing intermediate [%s]", err.Error())
+	}
+	return identity
+}
+
+// MustIssue issues a leaf identity for a DNS name with an ECDSA key from an authority or fails the test.
+func MustIssue(authority *Identity, name string, t *testing.T) *Identity {
+	identity, err := authority.Issue(Template{
+		BasicConstraintsValid: true,
+		DNSNames:              []string{name},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		NotAfter:              time.Now().AddDate(0, 1, 0),
+		NotBefore:             time.Now().Add(-time.Minute),
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+	}, ECDSA, 256)
+	if err != nil {
+		t.Fatalf("error issuing identity [%s]", err.Error())
+	}
+	return identity
+}
+
 func TestIdentity(t *testing.T) {
 
 	Convey("When IdentityConfig", t, func() {
@@ -57,7 +111,7 @@ func TestIdentity(t *testing.T) {
 			Convey("with an unauthorative template", func() {
 
 				template := Template{}
-				identity, err := Self(template)
+				identity, err := Self(template, ECDSA, 256)
 
 				Convey("it returns a nil identity", func() {
 					So(identity, ShouldBeNil)
@@ -90,14 +144,68 @@ func TestIdentity(t *testing.T) {
 					},
 				}
 
-				identity, err := Self(template)
+				Convey("and an rsa key", func() {
 
-				Convey("it returns a non-nil identity", func() {
-					So(identity, ShouldNotBeNil)
+					identity, err := Self(template, RSA, 2048)
+
+					Convey("it returns a non-nil identity", func() {
+						So(identity, ShouldNotBeNil)
+					})
+
+					Convey("it returns an rsa key", func() {
+						So(identity.Key, ShouldHaveSameTypeAs, &rsa.PrivateKey{})
+					})
+
+					Convey("it returns a nil error", func() {
+						So(err, ShouldBeNil)
+					})
 				})
 
-				Convey("it returns a nil error", func() {
-					So(err, ShouldBeNil)
+				Convey("and an ecdsa key", func() {
+
+					identity, err := Self(template, ECDSA, 256)
+
+					Convey("it returns a non-nil identity", func() {
+						So(identity, ShouldNotBeNil)
+					})
+
+					Convey("it returns an ecdsa key", func() {
+						So(identity.Key, ShouldHaveSameTypeAs, &ecdsa.PrivateKey{})
+					})
+
+					Convey("it returns a nil error", func() {
+						So(err, ShouldBeNil)
+					})
+				})
+
+				Convey("and an ed25519 key", func() {
+
+					identity, err := Self(template, Ed25519, 0)
+
+					Convey("it returns a non-nil identity", func() {
+						So(identity, ShouldNotBeNil)
+					})
+
+					Convey("it returns an ed25519 key", func() {
+						So(identity.Key, ShouldHaveSameTypeAs, ed25519.PrivateKey{})
+					})
+
+					Convey("it returns a nil error", func() {
+						So(err, ShouldBeNil)
+					})
+				})
+
+				Convey("and an unsupported key algorithm", func() {
+
+					identity, err := Self(template, KeyAlgorithm("dsa"), 1024)
+
+					Convey("it returns a nil identity", func() {
+						So(identity, ShouldBeNil)
+					})
+
+					Convey("it returns a non-nil error", func() {
+						So(err, ShouldNotBeNil)
+					})
 				})
 			})
 		})
@@ -122,7 +230,7 @@ func TestIdentity(t *testing.T) {
 					PostalCode:         []string{"22314"},
 					StreetAddress:      []string{"110 S. Union St, Floor 2"},
 				},
-			})
+			}, ECDSA, 384)
 
 			intermediate, _ := root.Issue(Template{
 				BasicConstraintsValid: true,
@@ -142,10 +250,11 @@ func TestIdentity(t *testing.T) {
 					PostalCode:         []string{"22314"},
 					StreetAddress:      []string{"110 S. Union St, Floor 2"},
 				},
-			})
+			}, ECDSA, 256)
 
 			identity, err := intermediate.Issue(Template{
 				BasicConstraintsValid: true,
+				DNSNames:              []string{"nautls.com"},
 				ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
 				IsCA:                  false,
 				KeyUsage:              x509.KeyUsageDigitalSignature,
@@ -162,7 +271,7 @@ func TestIdentity(t *testing.T) {
 					PostalCode:         []string{"22314"},
 					StreetAddress:      []string{"110 S. Union St, Floor 2"},
 				},
-			})
+			}, Ed25519, 0)
 
 			roots := x509.NewCertPool()
 			roots.AddCert(root.Certificate)
@@ -185,5 +294,116 @@ func TestIdentity(t *testing.T) {
 				So(err, ShouldBeNil)
 			})
 		})
+
+		Convey(".Verify is invoked", func() {
+
+			root := MustSelf("NauTLS (Root)", t)
+			identity := MustIssue(root, "nautls.com", t)
+			options := x509.VerifyOptions{KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}
+
+			Convey("on a valid identity", func() {
+
+				err := identity.Verify(options)
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("on a self signed identity", func() {
+
+				err := root.Verify(x509.VerifyOptions{})
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("on an identity with a mismatched key", func() {
+
+				identity.Key = root.Key
+				err := identity.Verify(options)
+
+				Convey("it returns an error describing the key mismatch", func() {
+					So(err.Error(), ShouldContainSubstring, "key does not match")
+				})
+			})
+
+			Convey("on an identity with unrelated authorities", func() {
+
+				identity.Authorities = []*x509.Certificate{MustSelf("NauTLS (Unrelated)", t).Certificate}
+				err := identity.Verify(options)
+
+				Convey("it returns an error describing the chain failure", func() {
+					So(err.Error(), ShouldContainSubstring, "does not chain")
+				})
+			})
+
+			Convey("with an unpermitted extended key usage", func() {
+
+				options.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+				err := identity.Verify(options)
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("at a time after expiration", func() {
+
+				options.CurrentTime = time.Now().AddDate(2, 0, 0)
+				err := identity.Verify(options)
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey(".TLSCertificate is invoked", func() {
+
+			root := MustSelf("NauTLS (Root)", t)
+			intermediate := MustIntermediate(root, "NauTLS (Intermediate)", t)
+			identity := MustIssue(intermediate, "nautls.com", t)
+
+			Convey("on a valid identity", func() {
+
+				certificate, err := identity.TLSCertificate()
+
+				Convey("it returns the certificate followed by the authorities without the root", func() {
+					So(certificate.Certificate, ShouldResemble, [][]byte{identity.Certificate.Raw, intermediate.Certificate.Raw})
+				})
+
+				Convey("it returns the key", func() {
+					So(certificate.PrivateKey, ShouldEqual, identity.Key)
+				})
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("on an identity with a mismatched key", func() {
+
+				identity.Key = root.Key
+				_, err := identity.TLSCertificate()
+
+				Convey("it returns an error describing the key mismatch", func() {
+					So(err.Error(), ShouldContainSubstring, "key does not match")
+				})
+			})
+		})
+
+		Convey(".TrustPool is invoked", func() {
+
+			root := MustSelf("NauTLS (Root)", t)
+			intermediate := MustIssue(root, "NauTLS (Intermediate)", t)
+			identity := NewIdentity([]*x509.Certificate{intermediate.Certificate, root.Certificate}, MustSelf("nautls.com", t).Certificate, nil)
+			pool := identity.TrustPool()
+
+			Convey("it returns a pool containing only the roots", func() {
+				So(pool.Equal(root.TrustPool()), ShouldBeTrue)
+			})
+		})
 	})
 }
@@ -0,0 +1,235 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// KeyAlgorithm defines the public key algorithms that may be used when generating keys for identities.
+type KeyAlgorithm string
+
+const (
+
+	// RSA generates RSA keys where the size is the modulus length in bits (e.g., 2048, 3072 or 4096).
+	RSA KeyAlgorithm = "rsa"
+
+	// ECDSA generates ECDSA keys where the size is the bit size of the NIST curve (i.e., 224, 256, 384 or 521).
+	ECDSA KeyAlgorithm = "ecdsa"
+
+	// Ed25519 generates Ed25519 keys. The size is ignored as the curve defines a fixed key size.
+	Ed25519 KeyAlgorithm = "ed25519"
+)
+
+// GenerateKey generates a new private key of the provided algorithm and size.
+func GenerateKey(algorithm KeyAlgorithm, size int) (crypto.Signer, error) {
+
+	switch algorithm {
+	case RSA:
+		key, err := rsa.GenerateKey(rand.Reader, size)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error generating rsa key of size [%d]", size)
+		}
+		return key, nil
+	case ECDSA:
+		curve, err := curve(size)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error generating ecdsa key of size [%d]", size)
+		}
+		return key, nil
+	case Ed25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "error generating ed25519 key")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key algorithm [%s]", algorithm)
+	}
+}
+
+// matches returns a value indicating whether the public key of the private key equals the provided public key.
+func matches(key crypto.Signer, public crypto.PublicKey) bool {
+
+	comparable, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return false
+	}
+
+	return comparable.Equal(public)
+}
+
+// SubjectKeyID returns the key identifier of a public key computed as the SHA-1 hash of the subject public key bit
+// string (i.e., method 1 of RFC 5280 section 4.2.1.2).
+func SubjectKeyID(public crypto.PublicKey) ([]byte, error) {
+	return SubjectKeyHash(public, crypto.SHA1)
+}
+
+// SubjectKeyHash returns the hash of the subject public key bit string of a public key using a hash algorithm (e.g., the
+// issuer key hash of an OCSP request).
+func SubjectKeyHash(public crypto.PublicKey, algorithm crypto.Hash) ([]byte, error) {
+
+	if !algorithm.Available() {
+		return nil, fmt.Errorf("error hashing public key with unavailable hash algorithm [%d]", algorithm)
+	}
+
+	bytes, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshalling public key")
+	}
+
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+
+	if _, err := asn1.Unmarshal(bytes, &info); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling public key")
+	}
+
+	hash := algorithm.New()
+	hash.Write(info.PublicKey.Bytes)
+
+	return hash.Sum(nil), nil
+}
+
+// curve returns the NIST elliptic curve for a bit size.
+func curve(size int) (elliptic.Curve, error) {
+
+	switch size {
+	case 224:
+		return elliptic.P224(), nil
+	case 256:
+		return elliptic.P256(), nil
+	case 384:
+		return elliptic.P384(), nil
+	case 521:
+		return elliptic.P521(), nil
+	default:
+		return nil, fmt.Errorf("unsupported ecdsa key size [%d]", size)
+	}
+}
+
+// DecodeKeys decodes PEM encoded private keys. The format of each key is detected from the PEM block type and may be
+// PKCS #1 ("RSA PRIVATE KEY"), PKCS #8 ("PRIVATE KEY"), encrypted PKCS #8 ("ENCRYPTED PRIVATE KEY") or SEC 1 ("EC
+// PRIVATE KEY"). Encrypted keys, whether PBES2 encrypted PKCS #8 or legacy "Proc-Type: 4,ENCRYPTED" blocks, are
+// decrypted with the passphrase which may be nil for unencrypted keys. Note that unparsable values outside a PEM block
+// and PEM blocks that do not contain private keys (e.g., "EC PARAMETERS") are ignored while unparsable values inside a
+// private key PEM block will result in an error.
+func DecodeKeys(bytes []byte, passphrase []byte) ([]crypto.Signer, error) {
+
+	var result []crypto.Signer
+
+	decoded, tail := pem.Decode(bytes)
+	for decoded != nil {
+
+		if strings.HasSuffix(decoded.Type, "PRIVATE KEY") {
+
+			parsed, err := decodeKey(decoded, passphrase)
+			if err != nil {
+				return nil, errors.Wrap(err, "error parsing keys")
+			}
+
+			result = append(result, parsed)
+		}
+
+		decoded, tail = pem.Decode(tail)
+	}
+
+	return result, nil
+}
+
+// decodeKey parses the private key contained within a PEM block based upon the block type decrypting it with the
+// passphrase if necessary.
+func decodeKey(block *pem.Block, passphrase []byte) (crypto.Signer, error) {
+
+	bytes := block.Bytes
+
+	// Note that legacy encrypted PEM blocks are insecure by modern standards but are still produced by many tools.
+	if x509.IsEncryptedPEMBlock(block) {
+
+		if passphrase == nil {
+			return nil, fmt.Errorf("error decrypting [%s] block without a passphrase", block.Type)
+		}
+
+		decrypted, err := x509.DecryptPEMBlock(block, passphrase)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error decrypting [%s] block", block.Type)
+		}
+
+		bytes = decrypted
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing pkcs #1 private key")
+		}
+		return key, nil
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing sec 1 private key")
+		}
+		return key, nil
+	case "ENCRYPTED PRIVATE KEY":
+		if passphrase == nil {
+			return nil, fmt.Errorf("error decrypting [%s] block without a passphrase", block.Type)
+		}
+		decrypted, err := decryptPKCS8(bytes, passphrase)
+		if err != nil {
+			return nil, errors.Wrap(err, "error decrypting pkcs #8 private key")
+		}
+		return parsePKCS8(decrypted)
+	case "PRIVATE KEY":
+		return parsePKCS8(bytes)
+	default:
+		return nil, fmt.Errorf("unsupported private key block type [%s]", block.Type)
+	}
+}
+
+// parsePKCS8 parses a DER encoded PKCS #8 private key.
+func parsePKCS8(bytes []byte) (crypto.Signer, error) {
+
+	key, err := x509.ParsePKCS8PrivateKey(bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing pkcs #8 private key")
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported pkcs #8 private key type [%T]", key)
+	}
+
+	return signer, nil
+}
@@ -0,0 +1,392 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"testing"
+
+	"github.com/deciphernow/nautls/internal/tests"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// MustIterations re-encodes a PEM encoded PBES2 encrypted PKCS #8 key with a PBKDF2 iteration count or fails the test.
+func MustIterations(encoded []byte, iterations int, t *testing.T) []byte {
+
+	block, _ := pem.Decode(encoded)
+
+	var info encryptedPrivateKeyInfo
+	var parameters pbes2Parameters
+	var kdf pbkdf2Parameters
+
+	if _, err := asn1.Unmarshal(block.Bytes, &info); err != nil {
+		t.Fatalf("error parsing encrypted private key info [%s]", err.Error())
+	}
+
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &parameters); err != nil {
+		t.Fatalf("error parsing pbes2 parameters [%s]", err.Error())
+	}
+
+	if _, err := asn1.Unmarshal(parameters.KeyDerivation.Parameters.FullBytes, &kdf); err != nil {
+		t.Fatalf("error parsing pbkdf2 parameters [%s]", err.Error())
+	}
+
+	kdf.Iterations = iterations
+
+	var err error
+	if parameters.KeyDerivation.Parameters.FullBytes, err = asn1.Marshal(kdf); err != nil {
+		t.Fatalf("error encoding pbkdf2 parameters [%s]", err.Error())
+	}
+
+	if info.Algorithm.Parameters.FullBytes, err = asn1.Marshal(parameters); err != nil {
+		t.Fatalf("error encoding pbes2 parameters [%s]", err.Error())
+	}
+
+	if block.Bytes, err = asn1.Marshal(info); err != nil {
+		t.Fatalf("error encoding encrypted private key info [%s]", err.Error())
+	}
+
+	return pem.EncodeToMemory(block)
+}
+
+func TestKeys(t *testing.T) {
+
+	Convey("When .GenerateKey is invoked", t, func() {
+
+		Convey("with rsa", func() {
+
+			key, err := GenerateKey(RSA, 2048)
+
+			Convey("it returns a key of the requested size", func() {
+				So(key.(*rsa.PrivateKey).N.BitLen(), ShouldEqual, 2048)
+			})
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("with ecdsa", func() {
+
+			Convey("and a supported size", func() {
+
+				key, err := GenerateKey(ECDSA, 384)
+
+				Convey("it returns a key on the requested curve", func() {
+					So(key.(*ecdsa.PrivateKey).Curve.Params().BitSize, ShouldEqual, 384)
+				})
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("and an unsupported size", func() {
+
+				key, err := GenerateKey(ECDSA, 128)
+
+				Convey("it returns a nil key", func() {
+					So(key, ShouldBeNil)
+				})
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey("with ed25519", func() {
+
+			key, err := GenerateKey(Ed25519, 0)
+
+			Convey("it returns an ed25519 key", func() {
+				So(key, ShouldHaveSameTypeAs, ed25519.PrivateKey{})
+			})
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("with an unsupported algorithm", func() {
+
+			key, err := GenerateKey(KeyAlgorithm("dsa"), 1024)
+
+			Convey("it returns a nil key", func() {
+				So(key, ShouldBeNil)
+			})
+
+			Convey("it returns a non-nil error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("When .DecodeKeys is invoked", t, func() {
+
+		rsaKey, _ := GenerateKey(RSA, 2048)
+		ecdsaKey, _ := GenerateKey(ECDSA, 256)
+		ed25519Key, _ := GenerateKey(Ed25519, 0)
+
+		Convey("with a pkcs #1 key", func() {
+
+			keys, err := DecodeKeys(pem.EncodeToMemory(&pem.Block{
+				Type:  "RSA PRIVATE KEY",
+				Bytes: x509.MarshalPKCS1PrivateKey(rsaKey.(*rsa.PrivateKey)),
+			}), nil)
+
+			Convey("it returns the key", func() {
+				So(keys, ShouldResemble, []crypto.Signer{rsaKey})
+			})
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("with a sec 1 key", func() {
+
+			bytes, _ := x509.MarshalECPrivateKey(ecdsaKey.(*ecdsa.PrivateKey))
+			keys, err := DecodeKeys(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: bytes}), nil)
+
+			Convey("it returns the key", func() {
+				So(keys, ShouldResemble, []crypto.Signer{ecdsaKey})
+			})
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("with pkcs #8 keys", func() {
+
+			var encoded []byte
+			for _, key := range []crypto.Signer{rsaKey, ecdsaKey, ed25519Key} {
+				bytes, _ := x509.MarshalPKCS8PrivateKey(key)
+				encoded = append(encoded, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: bytes})...)
+			}
+
+			keys, err := DecodeKeys(encoded, nil)
+
+			Convey("it returns the keys", func() {
+				So(keys, ShouldResemble, []crypto.Signer{rsaKey, ecdsaKey, ed25519Key})
+			})
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("with non-key blocks", func() {
+
+			encoded := pem.EncodeToMemory(&pem.Block{Type: "EC PARAMETERS", Bytes: []byte{0x06, 0x00}})
+			keys, err := DecodeKeys(encoded, nil)
+
+			Convey("it returns no keys", func() {
+				So(keys, ShouldBeEmpty)
+			})
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("with a malformed key", func() {
+
+			keys, err := DecodeKeys(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte{0x00}}), nil)
+
+			Convey("it returns nil keys", func() {
+				So(keys, ShouldBeNil)
+			})
+
+			Convey("it returns an error naming the format", func() {
+				So(err.Error(), ShouldContainSubstring, "pkcs #8")
+			})
+		})
+
+		Convey("with a legacy encrypted key", func() {
+
+			encoded := tests.MustRead("testdata/pkcs1-encrypted.key", t)
+
+			Convey("and the correct passphrase", func() {
+
+				keys, err := DecodeKeys(encoded, []byte("nautls"))
+
+				Convey("it returns the key", func() {
+					So(keys, ShouldHaveLength, 1)
+					So(keys[0], ShouldHaveSameTypeAs, &rsa.PrivateKey{})
+				})
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("and an incorrect passphrase", func() {
+
+				keys, err := DecodeKeys(encoded, []byte("incorrect"))
+
+				Convey("it returns nil keys", func() {
+					So(keys, ShouldBeNil)
+				})
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("and no passphrase", func() {
+
+				keys, err := DecodeKeys(encoded, nil)
+
+				Convey("it returns nil keys", func() {
+					So(keys, ShouldBeNil)
+				})
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey("with a pbes2 encrypted pkcs #8 key", func() {
+
+			encoded := tests.MustRead("testdata/pkcs8-encrypted.key", t)
+
+			Convey("and the correct passphrase", func() {
+
+				keys, err := DecodeKeys(encoded, []byte("nautls"))
+
+				Convey("it returns the key", func() {
+					So(keys, ShouldHaveLength, 1)
+					So(keys[0], ShouldHaveSameTypeAs, &ecdsa.PrivateKey{})
+				})
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("and an incorrect passphrase", func() {
+
+				keys, err := DecodeKeys(encoded, []byte("incorrect"))
+
+				Convey("it returns nil keys", func() {
+					So(keys, ShouldBeNil)
+				})
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("and no passphrase", func() {
+
+				keys, err := DecodeKeys(encoded, nil)
+
+				Convey("it returns nil keys", func() {
+					So(keys, ShouldBeNil)
+				})
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("and an excessive iteration count", func() {
+
+				keys, err := DecodeKeys(MustIterations(encoded, maxPBKDF2Iterations+1, t), []byte("nautls"))
+
+				Convey("it returns nil keys", func() {
+					So(keys, ShouldBeNil)
+				})
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "invalid pbkdf2 iteration count")
+				})
+			})
+		})
+
+		Convey("with an unsupported key block", func() {
+
+			keys, err := DecodeKeys(pem.EncodeToMemory(&pem.Block{Type: "DSA PRIVATE KEY", Bytes: []byte{0x00}}), nil)
+
+			Convey("it returns nil keys", func() {
+				So(keys, ShouldBeNil)
+			})
+
+			Convey("it returns a non-nil error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestSubjectKeyHash(t *testing.T) {
+
+	Convey("When .SubjectKeyHash is invoked", t, func() {
+
+		key, err := GenerateKey(ECDSA, 256)
+		So(err, ShouldBeNil)
+
+		Convey("with SHA-1", func() {
+
+			hash, err := SubjectKeyHash(key.Public(), crypto.SHA1)
+
+			Convey("it returns the subject key identifier", func() {
+				id, _ := SubjectKeyID(key.Public())
+				So(hash, ShouldResemble, id)
+			})
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("with SHA-256", func() {
+
+			hash, err := SubjectKeyHash(key.Public(), crypto.SHA256)
+
+			Convey("it returns a SHA-256 hash", func() {
+				So(hash, ShouldHaveLength, 32)
+			})
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("with an unavailable hash algorithm", func() {
+
+			hash, err := SubjectKeyHash(key.Public(), crypto.Hash(0))
+
+			Convey("it returns a nil hash", func() {
+				So(hash, ShouldBeNil)
+			})
+
+			Convey("it returns a non-nil error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
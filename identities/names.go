@@ -0,0 +1,227 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// attributeTypes maps the attribute type names of RFC 4514 (and those emitted by pkix.Name.String) to their OIDs.
+	attributeTypes = map[string]asn1.ObjectIdentifier{
+		"C":            {2, 5, 4, 6},
+		"CN":           {2, 5, 4, 3},
+		"DC":           {0, 9, 2342, 19200300, 100, 1, 25},
+		"L":            {2, 5, 4, 7},
+		"O":            {2, 5, 4, 10},
+		"OU":           {2, 5, 4, 11},
+		"POSTALCODE":   {2, 5, 4, 17},
+		"SERIALNUMBER": {2, 5, 4, 5},
+		"ST":           {2, 5, 4, 8},
+		"STREET":       {2, 5, 4, 9},
+		"UID":          {0, 9, 2342, 19200300, 100, 1, 1},
+	}
+
+	// nameAttributeTypes defines the OIDs represented by the fields of pkix.Name.
+	nameAttributeTypes = []asn1.ObjectIdentifier{
+		{2, 5, 4, 3},
+		{2, 5, 4, 5},
+		{2, 5, 4, 6},
+		{2, 5, 4, 7},
+		{2, 5, 4, 8},
+		{2, 5, 4, 9},
+		{2, 5, 4, 10},
+		{2, 5, 4, 11},
+		{2, 5, 4, 17},
+	}
+)
+
+// ParseDistinguishedName parses the RFC 4514 string representation of a distinguished name (e.g.,
+// "CN=nautls.com,O=Decipher Technology Studios,C=US") into a pkix.Name. Attributes are identified by name or dotted OID
+// and values may be escaped or hex encoded (e.g., "#0c066e6175746c73"). Attributes that are not represented by the
+// fields of pkix.Name (e.g., DC and UID) are added to the ExtraNames of the name.
+func ParseDistinguishedName(value string) (pkix.Name, error) {
+
+	var name pkix.Name
+
+	if strings.TrimSpace(value) == "" {
+		return name, errors.New("error parsing empty distinguished name")
+	}
+
+	var sequence pkix.RDNSequence
+	var set pkix.RelativeDistinguishedNameSET
+
+	for remaining := value; ; {
+
+		attribute, rest, separator, err := parseAttribute(remaining)
+		if err != nil {
+			return name, errors.Wrapf(err, "error parsing distinguished name [%s]", value)
+		}
+
+		set = append(set, attribute)
+
+		if separator != '+' {
+			sequence = append(pkix.RDNSequence{set}, sequence...)
+			set = nil
+		}
+
+		if separator == 0 {
+			break
+		}
+
+		remaining = rest
+	}
+
+	name.FillFromRDNSequence(&sequence)
+
+	for _, set := range sequence {
+		for _, attribute := range set {
+			if !containsOID(nameAttributeTypes, attribute.Type) {
+				name.ExtraNames = append(name.ExtraNames, attribute)
+			}
+		}
+	}
+
+	return name, nil
+}
+
+// parseAttribute parses the first attribute type and value from a string returning the attribute, the remainder of the
+// string following the separator and the separator (i.e., ',' or '+') or zero if the string was exhausted.
+func parseAttribute(value string) (pkix.AttributeTypeAndValue, string, byte, error) {
+
+	var attribute pkix.AttributeTypeAndValue
+
+	index := strings.IndexByte(value, '=')
+	if index < 0 {
+		return attribute, "", 0, fmt.Errorf("attribute [%s] is missing a value", strings.TrimSpace(value))
+	}
+
+	tipe, err := parseAttributeType(strings.TrimSpace(value[:index]))
+	if err != nil {
+		return attribute, "", 0, err
+	}
+
+	attribute.Type = tipe
+
+	raw := strings.TrimLeft(value[index+1:], " ")
+
+	if strings.HasPrefix(raw, "#") {
+
+		end := strings.IndexAny(raw, ",+")
+		if end < 0 {
+			end = len(raw)
+		}
+
+		bytes, err := hex.DecodeString(strings.TrimRight(raw[1:end], " "))
+		if err != nil {
+			return attribute, "", 0, errors.Wrapf(err, "error decoding hex value of attribute [%s]", tipe)
+		}
+
+		rest, err := asn1.Unmarshal(bytes, &attribute.Value)
+		if err != nil || len(rest) != 0 {
+			return attribute, "", 0, fmt.Errorf("invalid ber encoded value of attribute [%s]", tipe)
+		}
+
+		if end == len(raw) {
+			return attribute, "", 0, nil
+		}
+
+		return attribute, raw[end+1:], raw[end], nil
+	}
+
+	var builder strings.Builder
+	length := 0
+
+	for index := 0; index < len(raw); index++ {
+
+		character := raw[index]
+
+		switch character {
+		case ',', '+':
+			attribute.Value = builder.String()[:length]
+			return attribute, raw[index+1:], character, nil
+		case '\\':
+			if index+1 >= len(raw) {
+				return attribute, "", 0, fmt.Errorf("invalid trailing escape in value of attribute [%s]", tipe)
+			}
+			if strings.IndexByte("\"+,;<>\\=# ", raw[index+1]) >= 0 {
+				builder.WriteByte(raw[index+1])
+				index++
+			} else if index+2 < len(raw) {
+				decoded, err := strconv.ParseUint(raw[index+1:index+3], 16, 8)
+				if err != nil {
+					return attribute, "", 0, fmt.Errorf("invalid escape in value of attribute [%s]", tipe)
+				}
+				builder.WriteByte(byte(decoded))
+				index += 2
+			} else {
+				return attribute, "", 0, fmt.Errorf("invalid escape in value of attribute [%s]", tipe)
+			}
+			length = builder.Len()
+		default:
+			builder.WriteByte(character)
+			if character != ' ' {
+				length = builder.Len()
+			}
+		}
+	}
+
+	attribute.Value = builder.String()[:length]
+
+	return attribute, "", 0, nil
+}
+
+// parseAttributeType returns the OID of an attribute type given by name (e.g., "CN") or in dotted form.
+func parseAttributeType(value string) (asn1.ObjectIdentifier, error) {
+
+	if tipe, ok := attributeTypes[strings.ToUpper(value)]; ok {
+		return tipe, nil
+	}
+
+	var tipe asn1.ObjectIdentifier
+
+	for _, component := range strings.Split(strings.TrimPrefix(strings.ToUpper(value), "OID."), ".") {
+		number, err := strconv.Atoi(component)
+		if err != nil || number < 0 {
+			return nil, fmt.Errorf("unknown attribute type [%s]", value)
+		}
+		tipe = append(tipe, number)
+	}
+
+	if len(tipe) < 2 {
+		return nil, fmt.Errorf("unknown attribute type [%s]", value)
+	}
+
+	return tipe, nil
+}
+
+// containsOID returns a value indicating whether a slice of OIDs contains an OID.
+func containsOID(oids []asn1.ObjectIdentifier, oid asn1.ObjectIdentifier) bool {
+
+	for _, candidate := range oids {
+		if candidate.Equal(oid) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNames(t *testing.T) {
+
+	Convey("When #ParseDistinguishedName is invoked", t, func() {
+
+		Convey("with a simple distinguished name", func() {
+
+			name, err := ParseDistinguishedName("CN=nautls.com,OU=Engineering,O=Decipher Technology Studios,L=Alexandria,ST=Virginia,C=US")
+
+			Convey("it returns the name", func() {
+				So(name.CommonName, ShouldEqual, "nautls.com")
+				So(name.OrganizationalUnit, ShouldResemble, []string{"Engineering"})
+				So(name.Organization, ShouldResemble, []string{"Decipher Technology Studios"})
+				So(name.Locality, ShouldResemble, []string{"Alexandria"})
+				So(name.Province, ShouldResemble, []string{"Virginia"})
+				So(name.Country, ShouldResemble, []string{"US"})
+			})
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("with escaped characters", func() {
+
+			name, err := ParseDistinguishedName(`CN=Doe\, John \2b Co\ ,O=\#1 Corp`)
+
+			Convey("it returns the unescaped values", func() {
+				So(name.CommonName, ShouldEqual, "Doe, John + Co ")
+				So(name.Organization, ShouldResemble, []string{"#1 Corp"})
+			})
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("with multi-valued, hex encoded and extra attributes", func() {
+
+			name, err := ParseDistinguishedName("CN=nautls+SERIALNUMBER=1234,DC=nautls,1.2.840.113549.1.9.1=#160c6e61757440746c732e636f6d")
+
+			Convey("it returns the name", func() {
+				So(name.CommonName, ShouldEqual, "nautls")
+				So(name.SerialNumber, ShouldEqual, "1234")
+				So(name.ExtraNames, ShouldResemble, []pkix.AttributeTypeAndValue{
+					{Type: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}, Value: "naut@tls.com"},
+					{Type: asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 25}, Value: "nautls"},
+				})
+			})
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("with the output of pkix.Name.String", func() {
+
+			expected := pkix.Name{
+				CommonName:         "nautls.com",
+				Country:            []string{"US"},
+				Locality:           []string{"Alexandria"},
+				Organization:       []string{"Decipher Technology Studios"},
+				OrganizationalUnit: []string{"Engineering"},
+				PostalCode:         []string{"22314"},
+				Province:           []string{"Virginia"},
+				StreetAddress:      []string{"110 S. Union St, Floor 2"},
+			}
+
+			name, err := ParseDistinguishedName(expected.String())
+
+			Convey("it returns an equivalent name", func() {
+				So(name.String(), ShouldEqual, expected.String())
+			})
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("with invalid distinguished names", func() {
+
+			for _, value := range []string{"", "CN", "XX=nautls", "CN=nautls\\", "CN=#zz", "CN=nautls,,O=nautls"} {
+				_, err := ParseDistinguishedName(value)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
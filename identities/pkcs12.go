@@ -0,0 +1,63 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// DecodePKCS12 decodes a DER encoded PKCS #12 (i.e., .p12 or .pfx) bundle into an identity. The bundle must contain
+// exactly one private key and the certificate whose public key matches it. Any other certificates in the bundle are
+// treated as the authorities of the identity.
+func DecodePKCS12(bytes []byte, password string) (*Identity, error) {
+
+	decoded, certificate, authorities, err := pkcs12.DecodeChain(bytes, password)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding pkcs #12 bundle")
+	}
+
+	key, ok := decoded.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported pkcs #12 private key type [%T]", decoded)
+	}
+
+	certificates := append([]*x509.Certificate{certificate}, authorities...)
+	for index, candidate := range certificates {
+		if matches(key, candidate.PublicKey) {
+			authorities = append(append([]*x509.Certificate{}, certificates[:index]...), certificates[index+1:]...)
+			return NewIdentity(authorities, candidate, key), nil
+		}
+	}
+
+	return nil, errors.New("no certificate in the pkcs #12 bundle matches the private key")
+}
+
+// EncodePKCS12 encodes the identity, including the authorities, into a DER encoded PKCS #12 bundle protected with the
+// password. Note that the encryption used by PKCS #12 is weak and the bundle should be protected by other means.
+func (i *Identity) EncodePKCS12(password string) ([]byte, error) {
+
+	bytes, err := pkcs12.Encode(rand.Reader, i.Key, i.Certificate, i.Authorities, password)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error encoding pkcs #12 bundle for [%s]", i.Certificate.Subject.CommonName)
+	}
+
+	return bytes, nil
+}
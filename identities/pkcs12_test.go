@@ -0,0 +1,91 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/deciphernow/nautls/internal/tests"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPKCS12(t *testing.T) {
+
+	Convey("When .DecodePKCS12 is invoked", t, func() {
+
+		bytes := tests.MustRead("testdata/bundle.p12", t)
+
+		Convey("with the correct password", func() {
+
+			identity, err := DecodePKCS12(bytes, "nautls")
+
+			Convey("it returns the certificate", func() {
+				So(identity.Certificate.Subject.CommonName, ShouldEqual, "nautls.com")
+			})
+
+			Convey("it returns the key", func() {
+				So(identity.Key, ShouldHaveSameTypeAs, &ecdsa.PrivateKey{})
+			})
+
+			Convey("it returns the authorities", func() {
+				So(identity.Authorities, ShouldHaveLength, 1)
+				So(identity.Authorities[0].Subject.CommonName, ShouldEqual, "NauTLS (Root)")
+			})
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("with an incorrect password", func() {
+
+			identity, err := DecodePKCS12(bytes, "incorrect")
+
+			Convey("it returns a nil identity", func() {
+				So(identity, ShouldBeNil)
+			})
+
+			Convey("it returns a non-nil error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("When Identity.EncodePKCS12 is invoked", t, func() {
+
+		identity := MustIssue(MustSelf("NauTLS (Root)", t), "nautls.com", t)
+
+		bytes, err := identity.EncodePKCS12("nautls")
+		decoded, _ := DecodePKCS12(bytes, "nautls")
+
+		Convey("it returns a bundle with the certificate", func() {
+			So(decoded.Certificate, ShouldResemble, identity.Certificate)
+		})
+
+		Convey("it returns a bundle with the key", func() {
+			So(decoded.Key, ShouldResemble, identity.Key)
+		})
+
+		Convey("it returns a bundle with the authorities", func() {
+			So(decoded.Authorities, ShouldResemble, identity.Authorities)
+		})
+
+		Convey("it returns a nil error", func() {
+			So(err, ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,277 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"hash"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// maxPBKDF2Iterations limits the iteration count accepted from an encrypted key such that a crafted key cannot
+	// consume unbounded CPU time. The limit is well above the iteration counts recommended for PBKDF2 with any of its
+	// hashes.
+	maxPBKDF2Iterations = 10000000
+
+	// pbkdf2Iterations defines the iteration count used when encrypting keys (i.e., that recommended by OWASP for PBKDF2
+	// with HMAC-SHA256).
+	pbkdf2Iterations = 600000
+)
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+// encryptedPrivateKeyInfo represents the PKCS #8 EncryptedPrivateKeyInfo structure.
+type encryptedPrivateKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Data      []byte
+}
+
+// pbes2Parameters represents the PBES2-params structure from PKCS #5.
+type pbes2Parameters struct {
+	KeyDerivation pkix.AlgorithmIdentifier
+	Encryption    pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Parameters represents the PBKDF2-params structure from PKCS #5.
+type pbkdf2Parameters struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPKCS8 decrypts a DER encoded PKCS #8 EncryptedPrivateKeyInfo structure and returns the DER encoded PKCS #8
+// PrivateKeyInfo structure. Note that only PBES2 with PBKDF2 is supported as the PKCS #5 v1.5 schemes are obsolete.
+func decryptPKCS8(bytes []byte, passphrase []byte) ([]byte, error) {
+
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(bytes, &info); err != nil {
+		return nil, errors.Wrap(err, "error parsing encrypted private key info")
+	}
+
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported encryption scheme [%s]", info.Algorithm.Algorithm)
+	}
+
+	var parameters pbes2Parameters
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &parameters); err != nil {
+		return nil, errors.Wrap(err, "error parsing pbes2 parameters")
+	}
+
+	block, err := pbes2Cipher(parameters, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(parameters.Encryption.Parameters.FullBytes, &iv); err != nil {
+		return nil, errors.Wrap(err, "error parsing initialization vector")
+	}
+
+	if len(iv) != block.BlockSize() {
+		return nil, fmt.Errorf("invalid initialization vector length [%d]", len(iv))
+	}
+
+	if len(info.Data) == 0 || len(info.Data)%block.BlockSize() != 0 {
+		return nil, errors.New("invalid encrypted data length")
+	}
+
+	decrypted := make([]byte, len(info.Data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, info.Data)
+
+	return unpad(decrypted, block.BlockSize())
+}
+
+// encryptPKCS8 encrypts a DER encoded PKCS #8 PrivateKeyInfo structure with PBES2 using PBKDF2 with HMAC-SHA256 and
+// AES-256-CBC and returns the DER encoded PKCS #8 EncryptedPrivateKeyInfo structure.
+func encryptPKCS8(bytes []byte, passphrase []byte) ([]byte, error) {
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.Wrap(err, "error generating salt")
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, errors.Wrap(err, "error generating initialization vector")
+	}
+
+	kdf, err := asn1.Marshal(pbkdf2Parameters{
+		Salt:       salt,
+		Iterations: pbkdf2Iterations,
+		PRF:        pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshalling pbkdf2 parameters")
+	}
+
+	encodedIV, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshalling initialization vector")
+	}
+
+	parameters := pbes2Parameters{
+		KeyDerivation: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdf}},
+		Encryption:    pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: encodedIV}},
+	}
+
+	block, err := pbes2Cipher(parameters, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted := pad(bytes, block.BlockSize())
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	encodedParameters, err := asn1.Marshal(parameters)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshalling pbes2 parameters")
+	}
+
+	info := encryptedPrivateKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: encodedParameters}},
+		Data:      encrypted,
+	}
+
+	encoded, err := asn1.Marshal(info)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshalling encrypted private key info")
+	}
+
+	return encoded, nil
+}
+
+// pbes2Cipher derives the key with PBKDF2 and returns the block cipher defined by the PBES2 parameters.
+func pbes2Cipher(parameters pbes2Parameters, passphrase []byte) (cipher.Block, error) {
+
+	if !parameters.KeyDerivation.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function [%s]", parameters.KeyDerivation.Algorithm)
+	}
+
+	var kdf pbkdf2Parameters
+	if _, err := asn1.Unmarshal(parameters.KeyDerivation.Parameters.FullBytes, &kdf); err != nil {
+		return nil, errors.Wrap(err, "error parsing pbkdf2 parameters")
+	}
+
+	if kdf.Iterations < 1 || kdf.Iterations > maxPBKDF2Iterations {
+		return nil, fmt.Errorf("invalid pbkdf2 iteration count [%d]", kdf.Iterations)
+	}
+
+	prf, err := pseudorandomFunction(kdf.PRF)
+	if err != nil {
+		return nil, err
+	}
+
+	var size int
+	var create func([]byte) (cipher.Block, error)
+
+	switch {
+	case parameters.Encryption.Algorithm.Equal(oidAES128CBC):
+		size, create = 16, aes.NewCipher
+	case parameters.Encryption.Algorithm.Equal(oidAES192CBC):
+		size, create = 24, aes.NewCipher
+	case parameters.Encryption.Algorithm.Equal(oidAES256CBC):
+		size, create = 32, aes.NewCipher
+	case parameters.Encryption.Algorithm.Equal(oidDESEDE3CBC):
+		size, create = 24, des.NewTripleDESCipher
+	default:
+		return nil, fmt.Errorf("unsupported encryption algorithm [%s]", parameters.Encryption.Algorithm)
+	}
+
+	if kdf.KeyLength != 0 && kdf.KeyLength != size {
+		return nil, fmt.Errorf("invalid key length [%d] for encryption algorithm [%s]", kdf.KeyLength, parameters.Encryption.Algorithm)
+	}
+
+	return create(pbkdf2.Key(passphrase, kdf.Salt, kdf.Iterations, size, prf))
+}
+
+// pseudorandomFunction returns the hash for the HMAC pseudorandom function used by PBKDF2. Note that the default
+// is HMAC with SHA-1 when the algorithm is omitted.
+func pseudorandomFunction(algorithm pkix.AlgorithmIdentifier) (func() hash.Hash, error) {
+
+	switch {
+	case len(algorithm.Algorithm) == 0, algorithm.Algorithm.Equal(oidHMACWithSHA1):
+		return sha1.New, nil
+	case algorithm.Algorithm.Equal(oidHMACWithSHA224):
+		return sha256.New224, nil
+	case algorithm.Algorithm.Equal(oidHMACWithSHA256):
+		return sha256.New, nil
+	case algorithm.Algorithm.Equal(oidHMACWithSHA384):
+		return sha512.New384, nil
+	case algorithm.Algorithm.Equal(oidHMACWithSHA512):
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("unsupported pseudorandom function [%s]", algorithm.Algorithm)
+	}
+}
+
+// pad returns a copy of data with PKCS #7 padding to a multiple of the block size.
+func pad(data []byte, size int) []byte {
+
+	length := size - len(data)%size
+
+	padded := make([]byte, len(data), len(data)+length)
+	copy(padded, data)
+
+	for index := 0; index < length; index++ {
+		padded = append(padded, byte(length))
+	}
+
+	return padded
+}
+
+// unpad removes PKCS #7 padding from decrypted data. Note that an invalid padding is almost always the result of an
+// incorrect passphrase.
+func unpad(data []byte, size int) ([]byte, error) {
+
+	length := int(data[len(data)-1])
+	if length == 0 || length > size || length > len(data) {
+		return nil, errors.New("invalid padding (incorrect passphrase?)")
+	}
+
+	for _, b := range data[len(data)-length:] {
+		if int(b) != length {
+			return nil, errors.New("invalid padding (incorrect passphrase?)")
+		}
+	}
+
+	return data[:len(data)-length], nil
+}
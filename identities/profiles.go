@@ -0,0 +1,160 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+
+	// Backdate defines how far before the current time the templates are valid to allow for clock skew between peers.
+	Backdate = 5 * time.Minute
+
+	// RootValidity defines the validity of templates returned by RootTemplate.
+	RootValidity = 10 * 365 * 24 * time.Hour
+
+	// IntermediateValidity defines the validity of templates returned by IntermediateTemplate.
+	IntermediateValidity = 5 * 365 * 24 * time.Hour
+
+	// LeafValidity defines the validity of templates returned by ServerTemplate and ClientTemplate.
+	LeafValidity = 90 * 24 * time.Hour
+)
+
+var (
+	// oidOCSPNoCheck defines the id-pkix-ocsp-nocheck extension of RFC 6960 section 4.2.2.2.1.
+	oidOCSPNoCheck = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 5}
+)
+
+// RootTemplate returns a template for a root certificate authority with the provided subject. The template is valid for
+// the RootValidity and may issue intermediates of any depth.
+func RootTemplate(subject pkix.Name) (Template, error) {
+
+	template, err := profile(subject, RootValidity)
+	if err != nil {
+		return Template{}, errors.Wrapf(err, "error creating root template for [%s]", subject.CommonName)
+	}
+
+	template.IsCA = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+
+	return template, nil
+}
+
+// IntermediateTemplate returns a template for an intermediate certificate authority with the provided subject. The
+// template is valid for the IntermediateValidity and may only issue leaf certificates (i.e., a maximum path length of
+// zero).
+func IntermediateTemplate(subject pkix.Name) (Template, error) {
+
+	template, err := profile(subject, IntermediateValidity)
+	if err != nil {
+		return Template{}, errors.Wrapf(err, "error creating intermediate template for [%s]", subject.CommonName)
+	}
+
+	template.IsCA = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	template.MaxPathLen = 0
+	template.MaxPathLenZero = true
+
+	return template, nil
+}
+
+// ServerTemplate returns a template for a server certificate with the provided DNS names and IP addresses as subject
+// alternative names. The common name of the subject is the first DNS name or, if there are none, the first IP address.
+// The template is valid for the LeafValidity.
+func ServerTemplate(dnsNames []string, ips []net.IP) (Template, error) {
+
+	var subject pkix.Name
+
+	switch {
+	case len(dnsNames) > 0:
+		subject.CommonName = dnsNames[0]
+	case len(ips) > 0:
+		subject.CommonName = ips[0].String()
+	default:
+		return Template{}, errors.New("error creating server template without dns names or ip addresses")
+	}
+
+	template, err := profile(subject, LeafValidity)
+	if err != nil {
+		return Template{}, errors.Wrapf(err, "error creating server template for [%s]", subject.CommonName)
+	}
+
+	template.DNSNames = dnsNames
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	template.IPAddresses = ips
+	template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+
+	return template, nil
+}
+
+// ClientTemplate returns a template for a client certificate with the provided common name. The template is valid for
+// the LeafValidity.
+func ClientTemplate(commonName string) (Template, error) {
+
+	template, err := profile(pkix.Name{CommonName: commonName}, LeafValidity)
+	if err != nil {
+		return Template{}, errors.Wrapf(err, "error creating client template for [%s]", commonName)
+	}
+
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+
+	return template, nil
+}
+
+// OCSPTemplate returns a template for a delegated OCSP signing certificate with the provided common name. The template
+// includes the id-pkix-ocsp-nocheck extension such that clients do not check the revocation status of the signer and is
+// valid for the LeafValidity.
+func OCSPTemplate(commonName string) (Template, error) {
+
+	template, err := profile(pkix.Name{CommonName: commonName}, LeafValidity)
+	if err != nil {
+		return Template{}, errors.Wrapf(err, "error creating ocsp template for [%s]", commonName)
+	}
+
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning}
+	template.ExtraExtensions = []pkix.Extension{{Id: oidOCSPNoCheck, Value: asn1.NullBytes}}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+
+	return template, nil
+}
+
+// profile returns a template with the defaults common to all profiles (i.e., valid basic constraints, a random serial
+// number and a validity period backdated for clock skew). Note that the subject and authority key identifiers are
+// computed from the public keys of the subject and issuer when the template is signed.
+func profile(subject pkix.Name, validity time.Duration) (Template, error) {
+
+	serial, err := RandomSerialNumber()
+	if err != nil {
+		return Template{}, errors.Wrap(err, "error generating serial number")
+	}
+
+	now := time.Now()
+
+	return Template{
+		BasicConstraintsValid: true,
+		NotAfter:              now.Add(validity),
+		NotBefore:             now.Add(-Backdate),
+		SerialNumber:          serial,
+		Subject:               subject,
+	}, nil
+}
@@ -0,0 +1,210 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProfiles(t *testing.T) {
+
+	Convey("When profiles", t, func() {
+
+		template, err := RootTemplate(pkix.Name{CommonName: "NauTLS (Root)"})
+		So(err, ShouldBeNil)
+
+		root, err := Self(template, ECDSA, 256)
+		So(err, ShouldBeNil)
+
+		template, err = IntermediateTemplate(pkix.Name{CommonName: "NauTLS (Intermediate)"})
+		So(err, ShouldBeNil)
+
+		intermediate, err := root.Issue(template, ECDSA, 256)
+		So(err, ShouldBeNil)
+
+		template, err = ServerTemplate([]string{"nautls.com"}, []net.IP{net.ParseIP("127.0.0.1")})
+		So(err, ShouldBeNil)
+
+		server, err := intermediate.Issue(template, RSA, 2048)
+		So(err, ShouldBeNil)
+
+		template, err = ClientTemplate("nautls")
+		So(err, ShouldBeNil)
+
+		client, err := intermediate.Issue(template, Ed25519, 0)
+		So(err, ShouldBeNil)
+
+		roots := x509.NewCertPool()
+		roots.AddCert(root.Certificate)
+
+		intermediates := x509.NewCertPool()
+		intermediates.AddCert(intermediate.Certificate)
+
+		Convey(".RootTemplate is invoked", func() {
+
+			Convey("it returns a certificate authority", func() {
+				So(root.Certificate.IsCA, ShouldBeTrue)
+				So(root.Certificate.KeyUsage&x509.KeyUsageCertSign, ShouldNotEqual, 0)
+			})
+
+			Convey("it returns a 128-bit random serial number", func() {
+				So(root.Certificate.SerialNumber.BitLen(), ShouldBeLessThanOrEqualTo, 128)
+				So(root.Certificate.SerialNumber.Sign(), ShouldEqual, 1)
+			})
+
+			Convey("it returns a backdated validity", func() {
+				So(root.Certificate.NotBefore, ShouldHappenBefore, time.Now().Add(-Backdate+time.Minute))
+				So(root.Certificate.NotAfter, ShouldHappenAfter, time.Now().Add(RootValidity-time.Minute))
+			})
+
+			Convey("it returns a computed subject key identifier", func() {
+				id, err := SubjectKeyID(root.Key.Public())
+				So(err, ShouldBeNil)
+				So(root.Certificate.SubjectKeyId, ShouldResemble, id)
+			})
+		})
+
+		Convey(".IntermediateTemplate is invoked", func() {
+
+			Convey("it returns a certificate authority restricted to issuing leaves", func() {
+				So(intermediate.Certificate.IsCA, ShouldBeTrue)
+				So(intermediate.Certificate.MaxPathLen, ShouldEqual, 0)
+				So(intermediate.Certificate.MaxPathLenZero, ShouldBeTrue)
+			})
+
+			Convey("it returns the authority key identifier of the root", func() {
+				So(intermediate.Certificate.AuthorityKeyId, ShouldResemble, root.Certificate.SubjectKeyId)
+			})
+
+			Convey("it refuses to issue subordinate authorities", func() {
+
+				template, err := IntermediateTemplate(pkix.Name{CommonName: "NauTLS (Subordinate)"})
+				So(err, ShouldBeNil)
+
+				_, err = intermediate.Issue(template, ECDSA, 256)
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("it rejects chains through subordinate authorities", func() {
+
+				template, err := IntermediateTemplate(pkix.Name{CommonName: "NauTLS (Subordinate)"})
+				So(err, ShouldBeNil)
+
+				subordinate, err := intermediate.IssueUnchecked(template, ECDSA, 256)
+				So(err, ShouldBeNil)
+
+				template, err = ServerTemplate([]string{"nautls.com"}, nil)
+				So(err, ShouldBeNil)
+
+				leaf, err := subordinate.Issue(template, ECDSA, 256)
+				So(err, ShouldBeNil)
+
+				intermediates.AddCert(subordinate.Certificate)
+
+				_, err = leaf.Certificate.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey(".ServerTemplate is invoked", func() {
+
+			Convey("with dns names and ip addresses", func() {
+
+				Convey("it returns a certificate verifiable for server authentication", func() {
+					_, err := server.Certificate.Verify(x509.VerifyOptions{
+						DNSName:       "127.0.0.1",
+						Intermediates: intermediates,
+						KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+						Roots:         roots,
+					})
+					So(err, ShouldBeNil)
+				})
+
+				Convey("it returns the first dns name as the common name", func() {
+					So(server.Certificate.Subject.CommonName, ShouldEqual, "nautls.com")
+				})
+
+				Convey("it returns a leaf certificate", func() {
+					So(server.Certificate.IsCA, ShouldBeFalse)
+					So(server.Certificate.BasicConstraintsValid, ShouldBeTrue)
+				})
+			})
+
+			Convey("with only ip addresses", func() {
+
+				template, err := ServerTemplate(nil, []net.IP{net.ParseIP("::1")})
+
+				Convey("it returns the first ip address as the common name", func() {
+					So(template.Subject.CommonName, ShouldEqual, "::1")
+				})
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("without dns names or ip addresses", func() {
+
+				_, err := ServerTemplate(nil, nil)
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey(".ClientTemplate is invoked", func() {
+
+			Convey("it returns a certificate verifiable for client authentication", func() {
+				_, err := client.Certificate.Verify(x509.VerifyOptions{
+					Intermediates: intermediates,
+					KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+					Roots:         roots,
+				})
+				So(err, ShouldBeNil)
+			})
+
+			Convey("it returns a certificate usable for tls", func() {
+				certificate, err := client.TLSCertificate()
+				So(err, ShouldBeNil)
+				So(certificate.Certificate, ShouldHaveLength, 2)
+			})
+		})
+
+		Convey(".OCSPTemplate is invoked", func() {
+
+			template, err := OCSPTemplate("NauTLS (OCSP)")
+			So(err, ShouldBeNil)
+
+			signer, err := intermediate.Issue(template, ECDSA, 256)
+			So(err, ShouldBeNil)
+
+			Convey("it returns a certificate for ocsp signing", func() {
+				So(signer.Certificate.ExtKeyUsage, ShouldResemble, []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning})
+				So(signer.Certificate.IsCA, ShouldBeFalse)
+			})
+
+			Convey("it returns the ocsp no check extension", func() {
+				So(signer.Certificate.Extensions, ShouldContain, pkix.Extension{Id: oidOCSPNoCheck, Value: []byte{5, 0}})
+			})
+		})
+	})
+}
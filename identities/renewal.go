@@ -0,0 +1,168 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// generatedExtensions defines the OIDs of the extensions that are generated by x509.CreateCertificate from the fields
+	// of a certificate and therefore must not be copied into the extra extensions of a template.
+	generatedExtensions = []asn1.ObjectIdentifier{
+		{2, 5, 29, 14},
+		{2, 5, 29, 15},
+		{2, 5, 29, 17},
+		{2, 5, 29, 19},
+		{2, 5, 29, 30},
+		{2, 5, 29, 31},
+		{2, 5, 29, 32},
+		{2, 5, 29, 35},
+		{2, 5, 29, 37},
+		{1, 3, 6, 1, 5, 5, 7, 1, 1},
+	}
+)
+
+// TemplateFromCertificate returns a template that reproduces the subject, subject alternative names, constraints,
+// usages, distribution points and extensions of a certificate. The serial number, validity and subject key identifier
+// are copied as well and should be replaced as appropriate (e.g., by Renew). The authority key identifier and signature
+// algorithm are not copied as they depend upon the issuer.
+func TemplateFromCertificate(certificate *x509.Certificate) Template {
+
+	template := Template{
+		BasicConstraintsValid:       certificate.BasicConstraintsValid,
+		CRLDistributionPoints:       certificate.CRLDistributionPoints,
+		DNSNames:                    certificate.DNSNames,
+		EmailAddresses:              certificate.EmailAddresses,
+		ExcludedDNSDomains:          certificate.ExcludedDNSDomains,
+		ExcludedEmailAddresses:      certificate.ExcludedEmailAddresses,
+		ExcludedIPRanges:            certificate.ExcludedIPRanges,
+		ExcludedURIDomains:          certificate.ExcludedURIDomains,
+		ExtKeyUsage:                 certificate.ExtKeyUsage,
+		IPAddresses:                 certificate.IPAddresses,
+		IsCA:                        certificate.IsCA,
+		IssuingCertificateURL:       certificate.IssuingCertificateURL,
+		KeyUsage:                    certificate.KeyUsage,
+		MaxPathLen:                  certificate.MaxPathLen,
+		MaxPathLenZero:              certificate.MaxPathLenZero,
+		NotAfter:                    certificate.NotAfter,
+		NotBefore:                   certificate.NotBefore,
+		OCSPServer:                  certificate.OCSPServer,
+		PermittedDNSDomains:         certificate.PermittedDNSDomains,
+		PermittedDNSDomainsCritical: certificate.PermittedDNSDomainsCritical,
+		PermittedEmailAddresses:     certificate.PermittedEmailAddresses,
+		PermittedIPRanges:           certificate.PermittedIPRanges,
+		PermittedURIDomains:         certificate.PermittedURIDomains,
+		PolicyIdentifiers:           certificate.PolicyIdentifiers,
+		SerialNumber:                certificate.SerialNumber,
+		Subject:                     subject(certificate.Subject),
+		SubjectKeyID:                certificate.SubjectKeyId,
+		URIs:                        certificate.URIs,
+		UnknownExtKeyUsage:          certificate.UnknownExtKeyUsage,
+	}
+
+	for _, extension := range certificate.Extensions {
+		if !containsOID(generatedExtensions, extension.Id) {
+			template.ExtraExtensions = append(template.ExtraExtensions, extension)
+		}
+	}
+
+	return template
+}
+
+// Renew returns a new identity with the key of this identity and a certificate issued by the issuer that reproduces
+// the existing certificate (see TemplateFromCertificate) with a new serial number and the provided validity. A nil
+// issuer renews a self signed certificate with its own key. Note that the revocations of an issuing identity are not
+// carried over to the renewed identity.
+func (i *Identity) Renew(issuer *Identity, validity time.Duration) (*Identity, error) {
+
+	if i.Key == nil || !matches(i.Key, i.Certificate.PublicKey) {
+		return nil, fmt.Errorf("key does not match the public key of the certificate for [%s]", i.Certificate.Subject.CommonName)
+	}
+
+	return i.renew(issuer, validity, i.Key, i.Certificate.SubjectKeyId)
+}
+
+// Rekey returns a new identity with a new key of the provided algorithm and size and a certificate issued by the issuer
+// that reproduces the existing certificate (see TemplateFromCertificate) with a new serial number, subject key
+// identifier and the provided validity. A nil issuer creates a self signed certificate with the new key.
+func (i *Identity) Rekey(issuer *Identity, validity time.Duration, algorithm KeyAlgorithm, size int) (*Identity, error) {
+
+	key, err := GenerateKey(algorithm, size)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error generating private key for [%s]", i.Certificate.Subject.CommonName)
+	}
+
+	return i.renew(issuer, validity, key, nil)
+}
+
+// renew returns a new identity with the provided key and subject key identifier and a certificate reproducing the
+// existing certificate issued by the issuer (or self signed if the issuer is nil).
+func (i *Identity) renew(issuer *Identity, validity time.Duration, key crypto.Signer, id []byte) (*Identity, error) {
+
+	serial, err := RandomSerialNumber()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error generating serial number for [%s]", i.Certificate.Subject.CommonName)
+	}
+
+	now := time.Now()
+
+	template := TemplateFromCertificate(i.Certificate)
+	template.NotAfter = now.Add(validity)
+	template.NotBefore = now.Add(-Backdate)
+	template.SerialNumber = serial
+	template.SubjectKeyID = id
+
+	parent, signer, authorities := template.certificate(), key, []*x509.Certificate{}
+	if issuer != nil {
+
+		if err := CheckTemplate(issuer.Certificate, template); err != nil {
+			return nil, errors.Wrapf(err, "error renewing certificate for [%s]", i.Certificate.Subject.CommonName)
+		}
+
+		parent, signer, authorities = issuer.Certificate, issuer.Key, append([]*x509.Certificate{issuer.Certificate}, issuer.Authorities...)
+	}
+
+	certificate, err := sign(template.certificate(), parent, key.Public(), signer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error renewing certificate for [%s]", i.Certificate.Subject.CommonName)
+	}
+
+	return NewIdentity(authorities, certificate, key), nil
+}
+
+// subject returns a copy of a parsed name with the attributes that are not represented by the fields of pkix.Name
+// (e.g., DC and UID) moved to the ExtraNames such that they are retained when the name is marshalled.
+func subject(name pkix.Name) pkix.Name {
+
+	result := name
+	result.ExtraNames = nil
+	result.Names = nil
+
+	for _, attribute := range name.Names {
+		if !containsOID(nameAttributeTypes, attribute.Type) {
+			result.ExtraNames = append(result.ExtraNames, attribute)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,177 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRenewal(t *testing.T) {
+
+	Convey("When renewing", t, func() {
+
+		authority := MustSelf("NauTLS (Root)", t)
+
+		name, err := ParseDistinguishedName("CN=nautls.com,DC=nautls,DC=com,O=Decipher Technology Studios")
+		So(err, ShouldBeNil)
+
+		template, err := ServerTemplate([]string{"nautls.com"}, nil)
+		So(err, ShouldBeNil)
+
+		template.Subject = name
+		template.ExtraExtensions = []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: []byte{0x05, 0x00}}}
+		template.OCSPServer = []string{"http://ocsp.nautls.com"}
+
+		leaf, err := authority.Issue(template, ECDSA, 256)
+		So(err, ShouldBeNil)
+
+		Convey("#TemplateFromCertificate is invoked", func() {
+
+			actual := TemplateFromCertificate(leaf.Certificate)
+
+			Convey("it returns a template", func() {
+
+				Convey("with the subject and extra names", func() {
+					So(actual.Subject.CommonName, ShouldEqual, "nautls.com")
+					So(actual.Subject.Organization, ShouldResemble, []string{"Decipher Technology Studios"})
+					So(actual.Subject.ExtraNames, ShouldHaveLength, 2)
+				})
+
+				Convey("with the subject alternative names", func() {
+					So(actual.DNSNames, ShouldResemble, []string{"nautls.com"})
+				})
+
+				Convey("with the usages", func() {
+					So(actual.KeyUsage, ShouldEqual, leaf.Certificate.KeyUsage)
+					So(actual.ExtKeyUsage, ShouldResemble, leaf.Certificate.ExtKeyUsage)
+				})
+
+				Convey("with the ocsp server", func() {
+					So(actual.OCSPServer, ShouldResemble, []string{"http://ocsp.nautls.com"})
+				})
+
+				Convey("with only the extensions that are not generated", func() {
+					So(actual.ExtraExtensions, ShouldHaveLength, 1)
+					So(actual.ExtraExtensions[0].Id.Equal(asn1.ObjectIdentifier{1, 2, 3, 4}), ShouldBeTrue)
+				})
+			})
+		})
+
+		Convey(".Renew is invoked", func() {
+
+			renewed, err := leaf.Renew(authority, time.Hour)
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("it returns an identity", func() {
+
+				Convey("with the same key", func() {
+					So(renewed.Key, ShouldEqual, leaf.Key)
+					So(renewed.Certificate.SubjectKeyId, ShouldResemble, leaf.Certificate.SubjectKeyId)
+				})
+
+				Convey("with a new serial number", func() {
+					So(renewed.Certificate.SerialNumber.Cmp(leaf.Certificate.SerialNumber), ShouldNotEqual, 0)
+				})
+
+				Convey("with the provided validity", func() {
+					So(renewed.Certificate.NotAfter, ShouldHappenWithin, time.Minute, time.Now().Add(time.Hour))
+				})
+
+				Convey("with the same subject", func() {
+					So(renewed.Certificate.RawSubject, ShouldResemble, leaf.Certificate.RawSubject)
+				})
+
+				Convey("with the same extensions", func() {
+					So(len(renewed.Certificate.Extensions), ShouldEqual, len(leaf.Certificate.Extensions))
+				})
+
+				Convey("that verifies", func() {
+					So(renewed.Verify(x509.VerifyOptions{DNSName: "nautls.com"}), ShouldBeNil)
+				})
+			})
+		})
+
+		Convey(".Renew is invoked on a self signed identity without an issuer", func() {
+
+			renewed, err := authority.Renew(nil, time.Hour)
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("it returns a self signed identity that verifies", func() {
+				So(renewed.Authorities, ShouldBeEmpty)
+				So(renewed.Certificate.IsCA, ShouldBeTrue)
+				So(renewed.Verify(x509.VerifyOptions{}), ShouldBeNil)
+			})
+		})
+
+		Convey(".Renew is invoked on an identity without a key", func() {
+
+			_, err := NewIdentity(leaf.Authorities, leaf.Certificate, nil).Renew(authority, time.Hour)
+
+			Convey("it returns a non-nil error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey(".Rekey is invoked", func() {
+
+			rekeyed, err := leaf.Rekey(authority, time.Hour, RSA, 2048)
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("it returns an identity", func() {
+
+				Convey("with a new key", func() {
+					So(rekeyed.Key, ShouldNotEqual, leaf.Key)
+					So(rekeyed.Certificate.PublicKeyAlgorithm, ShouldEqual, x509.RSA)
+				})
+
+				Convey("with a new subject key identifier", func() {
+					So(rekeyed.Certificate.SubjectKeyId, ShouldNotResemble, leaf.Certificate.SubjectKeyId)
+				})
+
+				Convey("with the same subject alternative names", func() {
+					So(rekeyed.Certificate.DNSNames, ShouldResemble, leaf.Certificate.DNSNames)
+				})
+
+				Convey("that verifies", func() {
+					So(rekeyed.Verify(x509.VerifyOptions{DNSName: "nautls.com"}), ShouldBeNil)
+				})
+			})
+		})
+
+		Convey(".Rekey is invoked with an invalid key size", func() {
+
+			_, err := leaf.Rekey(authority, time.Hour, ECDSA, 42)
+
+			Convey("it returns a non-nil error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,246 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// NewRequest creates a certificate signing request for the subject and subject alternative names of the template
+// signed by the key. Note that all other fields of the template are ignored as they are controlled by the issuer.
+func NewRequest(template Template, key crypto.Signer) (*x509.CertificateRequest, error) {
+
+	request := &x509.CertificateRequest{
+		DNSNames:       template.DNSNames,
+		EmailAddresses: template.EmailAddresses,
+		IPAddresses:    template.IPAddresses,
+		Subject:        template.Subject,
+		URIs:           template.URIs,
+	}
+
+	bytes, err := x509.CreateCertificateRequest(rand.Reader, request, key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating certificate request for [%s]", template.Subject.CommonName)
+	}
+
+	parsed, err := x509.ParseCertificateRequest(bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing certificate request for [%s]", template.Subject.CommonName)
+	}
+
+	return parsed, nil
+}
+
+// LoadRequest loads a single PEM encoded certificate signing request from a URL. Note that an error is thrown if the
+// number of requests decoded is not one.
+func LoadRequest(resource string) (*x509.CertificateRequest, error) {
+
+	bytes, err := loadResource(resource)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading request from [%s]", resource)
+	}
+
+	requests, err := DecodeRequests(bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error decoding requests from [%s]", resource)
+	}
+
+	switch len(requests) {
+	case 0:
+		return nil, fmt.Errorf("no requests defined in [%s]", resource)
+	case 1:
+		return requests[0], nil
+	default:
+		return nil, fmt.Errorf("multiple requests defined in [%s]", resource)
+	}
+}
+
+// DecodeRequests decodes PEM encoded certificate signing requests. Note that unparsable values outside a PEM block and
+// PEM blocks that do not contain requests are ignored while unparsable values inside a request PEM block will result
+// in an error.
+func DecodeRequests(bytes []byte) ([]*x509.CertificateRequest, error) {
+
+	var result []*x509.CertificateRequest
+
+	decoded, tail := pem.Decode(bytes)
+	for decoded != nil {
+
+		if decoded.Type == "CERTIFICATE REQUEST" || decoded.Type == "NEW CERTIFICATE REQUEST" {
+
+			parsed, err := x509.ParseCertificateRequest(decoded.Bytes)
+			if err != nil {
+				return nil, errors.Wrap(err, "error parsing requests")
+			}
+
+			result = append(result, parsed)
+		}
+
+		decoded, tail = pem.Decode(tail)
+	}
+
+	return result, nil
+}
+
+// EncodeRequest encodes a certificate signing request as a PEM block.
+func EncodeRequest(request *x509.CertificateRequest) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: request.Raw})
+}
+
+// SignRequest returns a certificate signed by this identity for the public key of a certificate signing request. The
+// signature of the request is verified before signing and the certificate is issued for the template returned by
+// RequestTemplate. A *ConstraintError is returned if that template violates the constraints of this identity (see
+// CheckTemplate).
+func (i *Identity) SignRequest(request *x509.CertificateRequest, template Template) (*x509.Certificate, error) {
+
+	if err := request.CheckSignature(); err != nil {
+		return nil, errors.Wrapf(err, "error verifying certificate request for [%s]", request.Subject.CommonName)
+	}
+
+	template, err := RequestTemplate(request, template)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error signing certificate request for [%s]", request.Subject.CommonName)
+	}
+
+	if err := CheckTemplate(i.Certificate, template); err != nil {
+		return nil, errors.Wrapf(err, "error signing certificate request for [%s]", template.Subject.CommonName)
+	}
+
+	certificate, err := sign(template.certificate(), i.Certificate, request.PublicKey, i.Key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error signing certificate request for [%s]", template.Subject.CommonName)
+	}
+
+	return certificate, nil
+}
+
+// RequestTemplate returns the template used to sign a certificate signing request. The template controls the issued
+// certificate: its subject is used unless it is empty, in which case the requested subject is used, and its subject
+// alternative names are an allowlist such that only the requested subject alternative names it includes are issued. The
+// requested common name is treated as a requested DNS name when the template includes it as ACME clients may request a
+// name only in the subject. An error is returned if the request includes subject alternative names and the template
+// includes none of them. All other requested attributes and extensions are ignored.
+func RequestTemplate(request *x509.CertificateRequest, template Template) (Template, error) {
+
+	permitted := template
+	permitted.DNSNames = nil
+	permitted.EmailAddresses = nil
+	permitted.IPAddresses = nil
+	permitted.URIs = nil
+
+	var denied []string
+
+	if name := request.Subject.CommonName; containsFold(template.DNSNames, name) && !containsFold(request.DNSNames, name) {
+		permitted.DNSNames = append(permitted.DNSNames, name)
+	}
+
+	for _, name := range request.DNSNames {
+		if containsFold(template.DNSNames, name) {
+			permitted.DNSNames = append(permitted.DNSNames, name)
+		} else {
+			denied = append(denied, name)
+		}
+	}
+
+	for _, address := range request.EmailAddresses {
+		if containsString(template.EmailAddresses, address) {
+			permitted.EmailAddresses = append(permitted.EmailAddresses, address)
+		} else {
+			denied = append(denied, address)
+		}
+	}
+
+	for _, ip := range request.IPAddresses {
+		if containsIP(template.IPAddresses, ip) {
+			permitted.IPAddresses = append(permitted.IPAddresses, ip)
+		} else {
+			denied = append(denied, ip.String())
+		}
+	}
+
+	for _, uri := range request.URIs {
+		if containsURL(template.URIs, uri) {
+			permitted.URIs = append(permitted.URIs, uri)
+		} else {
+			denied = append(denied, uri.String())
+		}
+	}
+
+	if len(denied) > 0 && len(permitted.DNSNames)+len(permitted.EmailAddresses)+len(permitted.IPAddresses)+len(permitted.URIs) == 0 {
+		return Template{}, fmt.Errorf("requested subject alternative names [%s] are not included in the template", strings.Join(denied, ", "))
+	}
+
+	if len(permitted.Subject.ToRDNSequence()) == 0 {
+		permitted.Subject = request.Subject
+	}
+
+	return permitted, nil
+}
+
+// containsFold returns a value indicating whether a slice contains a string ignoring case.
+func containsFold(values []string, value string) bool {
+
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsIP returns a value indicating whether a slice contains an IP address.
+func containsIP(values []net.IP, value net.IP) bool {
+
+	for _, v := range values {
+		if v.Equal(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsURL returns a value indicating whether a slice contains a URL.
+func containsURL(values []*url.URL, value *url.URL) bool {
+
+	for _, v := range values {
+		if v.String() == value.String() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsString returns a value indicating whether a slice contains a string.
+func containsString(values []string, value string) bool {
+
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,189 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRequest(t *testing.T) {
+
+	Convey("When a request", t, func() {
+
+		authority := MustSelf("NauTLS (Root)", t)
+		key, _ := GenerateKey(ECDSA, 256)
+
+		request, err := NewRequest(Template{
+			DNSNames:    []string{"nautls.com", "www.nautls.com"},
+			IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+			Subject:     pkix.Name{CommonName: "nautls.com"},
+		}, key)
+
+		Convey("is created with .NewRequest", func() {
+
+			Convey("it returns a request for the key", func() {
+				So(matches(key, request.PublicKey), ShouldBeTrue)
+			})
+
+			Convey("it returns a request for the subject alternative names", func() {
+				So(request.DNSNames, ShouldResemble, []string{"nautls.com", "www.nautls.com"})
+			})
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("is loaded with .LoadRequest", func() {
+
+			loaded, err := LoadRequest("base64:///" + url.PathEscape(base64.StdEncoding.EncodeToString(EncodeRequest(request))))
+
+			Convey("it returns the request", func() {
+				So(loaded.Raw, ShouldResemble, request.Raw)
+			})
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("is signed with Identity.SignRequest", func() {
+
+			template := Template{
+				BasicConstraintsValid: true,
+				DNSNames:              []string{"api.nautls.com", "nautls.com", "www.nautls.com"},
+				ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+				IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+				KeyUsage:              x509.KeyUsageDigitalSignature,
+				NotAfter:              time.Now().AddDate(0, 1, 0),
+				NotBefore:             time.Now().Add(-time.Minute),
+				SerialNumber:          big.NewInt(time.Now().UnixNano()),
+			}
+
+			Convey("with a valid signature", func() {
+
+				certificate, err := authority.SignRequest(request, template)
+
+				Convey("it returns a certificate for the requested key", func() {
+					So(matches(key, certificate.PublicKey), ShouldBeTrue)
+				})
+
+				Convey("it returns a certificate with the requested subject", func() {
+					So(certificate.Subject.CommonName, ShouldEqual, "nautls.com")
+				})
+
+				Convey("it returns a certificate with the requested subject alternative names", func() {
+					So(certificate.DNSNames, ShouldResemble, []string{"nautls.com", "www.nautls.com"})
+					So(certificate.IPAddresses, ShouldHaveLength, 1)
+				})
+
+				Convey("it returns a certificate signed by the identity", func() {
+					So(certificate.CheckSignatureFrom(authority.Certificate), ShouldBeNil)
+				})
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("with a template subject", func() {
+
+				template.Subject = pkix.Name{CommonName: "override.nautls.com"}
+				certificate, _ := authority.SignRequest(request, template)
+
+				Convey("it returns a certificate with the template subject", func() {
+					So(certificate.Subject.CommonName, ShouldEqual, "override.nautls.com")
+				})
+			})
+
+			Convey("with a request for names the template does not include", func() {
+
+				template.DNSNames = []string{"nautls.com"}
+				template.IPAddresses = nil
+
+				certificate, err := authority.SignRequest(request, template)
+
+				Convey("it returns a certificate with only the requested names the template includes", func() {
+					So(certificate.DNSNames, ShouldResemble, []string{"nautls.com"})
+					So(certificate.IPAddresses, ShouldBeEmpty)
+				})
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("with a request for only names the template does not include", func() {
+
+				template.DNSNames = []string{"api.nautls.com"}
+				template.IPAddresses = nil
+
+				certificate, err := authority.SignRequest(request, template)
+
+				Convey("it returns a nil certificate", func() {
+					So(certificate, ShouldBeNil)
+				})
+
+				Convey("it returns an error naming the requested names", func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "requested subject alternative names [nautls.com, www.nautls.com, 127.0.0.1] are not included in the template")
+				})
+			})
+
+			Convey("with a request for a name only in its subject", func() {
+
+				request, err := NewRequest(Template{Subject: pkix.Name{CommonName: "www.nautls.com"}}, key)
+				So(err, ShouldBeNil)
+
+				certificate, err := authority.SignRequest(request, template)
+
+				Convey("it returns a certificate with the requested common name as a dns name", func() {
+					So(certificate.DNSNames, ShouldResemble, []string{"www.nautls.com"})
+					So(certificate.IPAddresses, ShouldBeEmpty)
+				})
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("with an invalid signature", func() {
+
+				tampered := *request
+				tampered.Signature = append([]byte{}, request.Signature...)
+				tampered.Signature[len(tampered.Signature)-1] ^= 0xff
+
+				certificate, err := authority.SignRequest(&tampered, template)
+
+				Convey("it returns a nil certificate", func() {
+					So(certificate, ShouldBeNil)
+				})
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+	})
+}
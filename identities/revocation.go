@@ -0,0 +1,221 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RevocationReason defines the reason codes of RFC 5280 section 5.3.1 for revoking a certificate.
+type RevocationReason int
+
+const (
+	Unspecified          RevocationReason = 0
+	KeyCompromise        RevocationReason = 1
+	CACompromise         RevocationReason = 2
+	AffiliationChanged   RevocationReason = 3
+	Superseded           RevocationReason = 4
+	CessationOfOperation RevocationReason = 5
+	CertificateHold      RevocationReason = 6
+	PrivilegeWithdrawn   RevocationReason = 9
+	AACompromise         RevocationReason = 10
+)
+
+// Revocation represents the revocation of a certificate issued by an identity.
+type Revocation struct {
+	SerialNumber *big.Int
+	RevokedAt    time.Time
+	Reason       RevocationReason
+}
+
+// RevocationRegistry tracks the certificates revoked by an issuing identity and creates certificate revocation lists
+// signed by the identity. A registry is safe for concurrent use.
+type RevocationRegistry struct {
+	crlNumber   *big.Int
+	issuer      *Identity
+	mutex       sync.Mutex
+	revocations []Revocation
+}
+
+// NewRevocationRegistry returns a new registry without revocations for an issuing identity.
+func NewRevocationRegistry(issuer *Identity) *RevocationRegistry {
+	return &RevocationRegistry{issuer: issuer}
+}
+
+// Issuer returns the issuing identity of the registry.
+func (r *RevocationRegistry) Issuer() *Identity {
+	return r.issuer
+}
+
+// Revoke adds a certificate to the revocation list of the registry. The revocation time defaults to the current time if
+// it is not defined and an error is returned if the serial number is missing or has already been revoked.
+func (r *RevocationRegistry) Revoke(revocation Revocation) error {
+
+	if revocation.SerialNumber == nil {
+		return fmt.Errorf("error revoking certificate issued by [%s] without a serial number", r.issuer.Certificate.Subject.CommonName)
+	}
+
+	if revocation.RevokedAt.IsZero() {
+		revocation.RevokedAt = time.Now()
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, existing := range r.revocations {
+		if existing.SerialNumber.Cmp(revocation.SerialNumber) == 0 {
+			return fmt.Errorf("certificate [%s] issued by [%s] has already been revoked", revocation.SerialNumber, r.issuer.Certificate.Subject.CommonName)
+		}
+	}
+
+	r.revocations = append(r.revocations, revocation)
+
+	return nil
+}
+
+// RevokeCertificate adds a certificate issued by the issuing identity to the revocation list of the registry at the
+// current time. An error is returned if the certificate was not issued by the identity.
+func (r *RevocationRegistry) RevokeCertificate(certificate *x509.Certificate, reason RevocationReason) error {
+
+	if err := certificate.CheckSignatureFrom(r.issuer.Certificate); err != nil {
+		return errors.Wrapf(err, "certificate [%s] was not issued by [%s]", certificate.Subject.CommonName, r.issuer.Certificate.Subject.CommonName)
+	}
+
+	return r.Revoke(Revocation{SerialNumber: certificate.SerialNumber, Reason: reason})
+}
+
+// Revocations returns a copy of the revocation list of the registry in the order the certificates were revoked.
+func (r *RevocationRegistry) Revocations() []Revocation {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]Revocation{}, r.revocations...)
+}
+
+// CRL returns an X.509 certificate revocation list of the revocations of the registry signed by the issuing identity.
+// The CRL is valid from the current time until the next update and is assigned a CRL number greater than any
+// previously created by the registry. Note that the certificate of the identity must permit CRL signing.
+func (r *RevocationRegistry) CRL(nextUpdate time.Duration) (*x509.RevocationList, error) {
+
+	if nextUpdate <= 0 {
+		return nil, fmt.Errorf("error creating crl for [%s] with invalid next update [%s]", r.issuer.Certificate.Subject.CommonName, nextUpdate)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+
+	number := big.NewInt(now.UnixNano())
+	if r.crlNumber != nil && number.Cmp(r.crlNumber) <= 0 {
+		number = new(big.Int).Add(r.crlNumber, big.NewInt(1))
+	}
+
+	template := &x509.RevocationList{
+		NextUpdate: now.Add(nextUpdate),
+		Number:     number,
+		ThisUpdate: now,
+	}
+
+	for _, revocation := range r.revocations {
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			ReasonCode:     int(revocation.Reason),
+			RevocationTime: revocation.RevokedAt,
+			SerialNumber:   revocation.SerialNumber,
+		})
+	}
+
+	bytes, err := x509.CreateRevocationList(rand.Reader, template, r.issuer.Certificate, r.issuer.Key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error signing crl for [%s]", r.issuer.Certificate.Subject.CommonName)
+	}
+
+	crl, err := x509.ParseRevocationList(bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing crl for [%s]", r.issuer.Certificate.Subject.CommonName)
+	}
+
+	r.crlNumber = number
+
+	return crl, nil
+}
+
+// WriteCRL creates a certificate revocation list for the registry (see CRL) and persists it as a PEM encoded file
+// returning a URL that references it. Parent directories are created as needed.
+func (r *RevocationRegistry) WriteCRL(path string, nextUpdate time.Duration) (string, error) {
+
+	crl, err := r.CRL(nextUpdate)
+	if err != nil {
+		return "", errors.Wrapf(err, "error creating crl for [%s]", r.issuer.Certificate.Subject.CommonName)
+	}
+
+	absolute, err := writeFile(path, EncodeCRL(crl), 0644)
+	if err != nil {
+		return "", errors.Wrapf(err, "error writing crl for [%s]", r.issuer.Certificate.Subject.CommonName)
+	}
+
+	return fmt.Sprintf("file://%s", absolute), nil
+}
+
+// EncodeCRL encodes an X.509 certificate revocation list as a PEM block.
+func EncodeCRL(crl *x509.RevocationList) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl.Raw})
+}
+
+// DecodeCRL decodes an X.509 certificate revocation list from either a PEM block or DER encoded bytes.
+func DecodeCRL(bytes []byte) (*x509.RevocationList, error) {
+
+	if block, _ := pem.Decode(bytes); block != nil {
+
+		if block.Type != "X509 CRL" {
+			return nil, fmt.Errorf("unexpected pem block type [%s] for crl", block.Type)
+		}
+
+		bytes = block.Bytes
+	}
+
+	crl, err := x509.ParseRevocationList(bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing crl")
+	}
+
+	return crl, nil
+}
+
+// LoadCRL loads an X.509 certificate revocation list from a URL that points to the location of a PEM or DER encoded
+// CRL.
+func LoadCRL(resource string) (*x509.RevocationList, error) {
+
+	bytes, err := loadResource(resource)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading crl from [%s]", resource)
+	}
+
+	crl, err := DecodeCRL(bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error decoding crl from [%s]", resource)
+	}
+
+	return crl, nil
+}
@@ -0,0 +1,187 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deciphernow/nautls/internal/temporary"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRevocation(t *testing.T) {
+
+	Convey("When RevocationRegistry", t, func() {
+
+		root := MustSelf("NauTLS (Root)", t)
+		identity := MustIssue(root, "nautls.com", t)
+		registry := NewRevocationRegistry(root)
+
+		Convey(".Revoke is invoked", func() {
+
+			Convey("with a serial number", func() {
+
+				err := registry.Revoke(Revocation{SerialNumber: big.NewInt(42), Reason: KeyCompromise})
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("it records the revocation at the current time", func() {
+					revocations := registry.Revocations()
+					So(revocations, ShouldHaveLength, 1)
+					So(revocations[0].SerialNumber, ShouldResemble, big.NewInt(42))
+					So(revocations[0].Reason, ShouldEqual, KeyCompromise)
+					So(revocations[0].RevokedAt, ShouldHappenWithin, time.Minute, time.Now())
+				})
+
+				Convey("and again with the same serial number", func() {
+
+					err := registry.Revoke(Revocation{SerialNumber: big.NewInt(42)})
+
+					Convey("it returns a non-nil error", func() {
+						So(err, ShouldNotBeNil)
+					})
+				})
+			})
+
+			Convey("without a serial number", func() {
+
+				err := registry.Revoke(Revocation{})
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey(".RevokeCertificate is invoked", func() {
+
+			Convey("with an issued certificate", func() {
+
+				err := registry.RevokeCertificate(identity.Certificate, Superseded)
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("it records the serial number of the certificate", func() {
+					So(registry.Revocations()[0].SerialNumber, ShouldResemble, identity.Certificate.SerialNumber)
+				})
+			})
+
+			Convey("with a certificate issued by another identity", func() {
+
+				err := registry.RevokeCertificate(MustIssue(MustSelf("NauTLS (Unrelated)", t), "nautls.com", t).Certificate, Superseded)
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey(".CRL is invoked", func() {
+
+			if err := registry.RevokeCertificate(identity.Certificate, KeyCompromise); err != nil {
+				t.Fatalf("error revoking certificate [%s]", err.Error())
+			}
+
+			Convey("with a valid next update", func() {
+
+				crl, err := registry.CRL(time.Hour)
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("it returns a crl signed by the identity", func() {
+					So(crl.CheckSignatureFrom(root.Certificate), ShouldBeNil)
+				})
+
+				Convey("it returns the revoked certificates", func() {
+					So(crl.RevokedCertificateEntries, ShouldHaveLength, 1)
+					So(crl.RevokedCertificateEntries[0].SerialNumber, ShouldResemble, identity.Certificate.SerialNumber)
+					So(crl.RevokedCertificateEntries[0].ReasonCode, ShouldEqual, int(KeyCompromise))
+				})
+
+				Convey("it returns the next update", func() {
+					So(crl.NextUpdate.Sub(crl.ThisUpdate), ShouldEqual, time.Hour)
+				})
+
+				Convey("and again", func() {
+
+					next, err := registry.CRL(time.Hour)
+					So(err, ShouldBeNil)
+
+					Convey("it returns an increasing crl number", func() {
+						So(next.Number.Cmp(crl.Number), ShouldEqual, 1)
+					})
+				})
+			})
+
+			Convey("with an invalid next update", func() {
+
+				_, err := registry.CRL(0)
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("for an identity that may not sign crls", func() {
+
+				_, err := NewRevocationRegistry(identity).CRL(time.Hour)
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey(".WriteCRL is invoked", func() {
+
+			var crl *x509.RevocationList
+			var writeErr, readErr error
+
+			temporary.WithDirectory(func(directory string) (interface{}, error) {
+				var resource string
+				resource, writeErr = registry.WriteCRL(filepath.Join(directory, "crl", "root.crl"), time.Hour)
+				if writeErr == nil {
+					bytes, _ := ioutil.ReadFile(strings.TrimPrefix(resource, "file://"))
+					block, _ := pem.Decode(bytes)
+					crl, readErr = x509.ParseRevocationList(block.Bytes)
+				}
+				return nil, nil
+			})
+
+			Convey("it returns a nil error", func() {
+				So(writeErr, ShouldBeNil)
+			})
+
+			Convey("it writes a pem encoded crl signed by the identity", func() {
+				So(readErr, ShouldBeNil)
+				So(crl.CheckSignatureFrom(root.Certificate), ShouldBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,121 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Rollover defines the certificates of a root certificate authority key rollover (see RFC 4210 section 4.4). During the
+// rollover relying parties that trust only the old root validate chains from the new root through the NewWithOld link
+// certificate while those that trust only the new root validate chains from the old root through OldWithNew.
+type Rollover struct {
+
+	// NewWithNew defines the new root identity (i.e., the new public key signed with the new private key).
+	NewWithNew *Identity
+
+	// NewWithOld defines the link certificate with the new public key signed with the old private key.
+	NewWithOld *x509.Certificate
+
+	// OldWithNew defines the link certificate with the old public key signed with the new private key.
+	OldWithNew *x509.Certificate
+}
+
+// CrossSign returns a certificate issued by this identity that reproduces the certificate of another certificate
+// authority (see TemplateFromCertificate) with the same subject, public key and subject key identifier but a new
+// serial number, issuer and the provided validity. The validity is limited to that of this identity and the
+// distribution points and OCSP servers are omitted as they belong to the original issuer.
+func (i *Identity) CrossSign(certificate *x509.Certificate, validity time.Duration) (*x509.Certificate, error) {
+
+	if i.Key == nil || !i.Certificate.IsCA {
+		return nil, fmt.Errorf("error cross signing [%s] as [%s] is not a certificate authority", certificate.Subject.CommonName, i.Certificate.Subject.CommonName)
+	}
+
+	if !certificate.IsCA {
+		return nil, fmt.Errorf("error cross signing [%s] as it is not a certificate authority", certificate.Subject.CommonName)
+	}
+
+	serial, err := RandomSerialNumber()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error generating serial number for [%s]", certificate.Subject.CommonName)
+	}
+
+	now := time.Now()
+
+	template := TemplateFromCertificate(certificate)
+	template.CRLDistributionPoints = nil
+	template.IssuingCertificateURL = nil
+	template.NotAfter = now.Add(validity)
+	template.NotBefore = now.Add(-Backdate)
+	template.OCSPServer = nil
+	template.SerialNumber = serial
+
+	if template.NotAfter.After(i.Certificate.NotAfter) {
+		template.NotAfter = i.Certificate.NotAfter
+	}
+
+	if err := CheckTemplate(i.Certificate, template); err != nil {
+		return nil, errors.Wrapf(err, "error cross signing certificate for [%s]", certificate.Subject.CommonName)
+	}
+
+	crossed, err := sign(template.certificate(), i.Certificate, certificate.PublicKey, i.Key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error cross signing certificate for [%s]", certificate.Subject.CommonName)
+	}
+
+	return crossed, nil
+}
+
+// Rollover returns the certificates of a key rollover from this root identity to a new self signed root with the same
+// subject, a new key of the provided algorithm and size and the provided validity (see NewRollover).
+func (i *Identity) Rollover(validity time.Duration, algorithm KeyAlgorithm, size int) (*Rollover, error) {
+
+	next, err := i.Rekey(nil, validity, algorithm, size)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating new root for [%s]", i.Certificate.Subject.CommonName)
+	}
+
+	return NewRollover(i, next)
+}
+
+// NewRollover returns the certificates of a key rollover from a previous root identity to the next root identity. The
+// OldWithNew link certificate is valid until the previous root expires and the NewWithOld link certificate until the
+// next root expires. Note that, as with CrossSign, neither is valid beyond the expiration of its issuer.
+func NewRollover(previous *Identity, next *Identity) (*Rollover, error) {
+
+	if previous.Key == nil || next.Key == nil {
+		return nil, fmt.Errorf("error rolling over [%s] without both keys", previous.Certificate.Subject.CommonName)
+	}
+
+	if matches(previous.Key, next.Certificate.PublicKey) {
+		return nil, fmt.Errorf("error rolling over [%s] to the same key", previous.Certificate.Subject.CommonName)
+	}
+
+	oldWithNew, err := next.CrossSign(previous.Certificate, time.Until(previous.Certificate.NotAfter))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating old with new certificate for [%s]", previous.Certificate.Subject.CommonName)
+	}
+
+	newWithOld, err := previous.CrossSign(next.Certificate, time.Until(next.Certificate.NotAfter))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating new with old certificate for [%s]", next.Certificate.Subject.CommonName)
+	}
+
+	return &Rollover{NewWithNew: next, NewWithOld: newWithOld, OldWithNew: oldWithNew}, nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRollover(t *testing.T) {
+
+	Convey("When rolling over", t, func() {
+
+		root := MustSelf("NauTLS (Root)", t)
+		other := MustSelf("NauTLS (Other)", t)
+
+		Convey(".CrossSign is invoked", func() {
+
+			crossed, err := other.CrossSign(root.Certificate, time.Hour)
+			So(err, ShouldBeNil)
+
+			Convey("it returns a certificate with the same subject and key", func() {
+				So(crossed.RawSubject, ShouldResemble, root.Certificate.RawSubject)
+				So(crossed.PublicKey, ShouldResemble, root.Certificate.PublicKey)
+				So(crossed.SubjectKeyId, ShouldResemble, root.Certificate.SubjectKeyId)
+				So(crossed.IsCA, ShouldBeTrue)
+			})
+
+			Convey("it returns a certificate with a new issuer", func() {
+				So(crossed.RawIssuer, ShouldResemble, other.Certificate.RawSubject)
+				So(crossed.AuthorityKeyId, ShouldResemble, other.Certificate.SubjectKeyId)
+				So(crossed.CheckSignatureFrom(other.Certificate), ShouldBeNil)
+				So(crossed.SerialNumber, ShouldNotResemble, root.Certificate.SerialNumber)
+			})
+
+			Convey("it chains certificates issued by the authority to the issuer", func() {
+
+				leaf := MustIssue(root, "nautls.com", t)
+
+				roots := x509.NewCertPool()
+				roots.AddCert(other.Certificate)
+
+				intermediates := x509.NewCertPool()
+				intermediates.AddCert(crossed)
+
+				_, err := leaf.Certificate.Verify(x509.VerifyOptions{Intermediates: intermediates, Roots: roots})
+				So(err, ShouldBeNil)
+			})
+
+			Convey("with a validity exceeding the issuer", func() {
+
+				crossed, err := other.CrossSign(root.Certificate, 100*365*24*time.Hour)
+				So(err, ShouldBeNil)
+
+				Convey("it limits the validity to the issuer", func() {
+					So(crossed.NotAfter, ShouldEqual, other.Certificate.NotAfter)
+				})
+			})
+
+			Convey("with a certificate that is not an authority", func() {
+
+				_, err := other.CrossSign(MustIssue(root, "nautls.com", t).Certificate, time.Hour)
+
+				Convey("it returns an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("by an identity that is not an authority", func() {
+
+				_, err := MustIssue(other, "nautls.com", t).CrossSign(root.Certificate, time.Hour)
+
+				Convey("it returns an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey(".Rollover is invoked", func() {
+
+			rollover, err := root.Rollover(20*365*24*time.Hour, ECDSA, 384)
+			So(err, ShouldBeNil)
+
+			Convey("it returns a new root with the same subject and a new key", func() {
+				So(rollover.NewWithNew.Certificate.RawSubject, ShouldResemble, root.Certificate.RawSubject)
+				So(rollover.NewWithNew.Certificate.SubjectKeyId, ShouldNotResemble, root.Certificate.SubjectKeyId)
+				So(rollover.NewWithNew.Certificate.CheckSignatureFrom(rollover.NewWithNew.Certificate), ShouldBeNil)
+			})
+
+			Convey("it returns the new with old certificate", func() {
+				So(rollover.NewWithOld.PublicKey, ShouldResemble, rollover.NewWithNew.Certificate.PublicKey)
+				So(rollover.NewWithOld.CheckSignatureFrom(root.Certificate), ShouldBeNil)
+				So(rollover.NewWithOld.NotAfter.After(root.Certificate.NotAfter), ShouldBeFalse)
+			})
+
+			Convey("it returns the old with new certificate", func() {
+				So(rollover.OldWithNew.PublicKey, ShouldResemble, root.Certificate.PublicKey)
+				So(rollover.OldWithNew.CheckSignatureFrom(rollover.NewWithNew.Certificate), ShouldBeNil)
+				So(rollover.OldWithNew.NotAfter, ShouldEqual, root.Certificate.NotAfter)
+			})
+
+			Convey("it chains certificates issued by the new root to the old root", func() {
+
+				leaf := MustIssue(rollover.NewWithNew, "nautls.com", t)
+
+				roots := x509.NewCertPool()
+				roots.AddCert(root.Certificate)
+
+				intermediates := x509.NewCertPool()
+				intermediates.AddCert(rollover.NewWithOld)
+
+				_, err := leaf.Certificate.Verify(x509.VerifyOptions{Intermediates: intermediates, Roots: roots})
+				So(err, ShouldBeNil)
+			})
+
+			Convey("it chains certificates issued by the old root to the new root", func() {
+
+				leaf := MustIssue(root, "nautls.com", t)
+
+				roots := x509.NewCertPool()
+				roots.AddCert(rollover.NewWithNew.Certificate)
+
+				intermediates := x509.NewCertPool()
+				intermediates.AddCert(rollover.OldWithNew)
+
+				_, err := leaf.Certificate.Verify(x509.VerifyOptions{Intermediates: intermediates, Roots: roots})
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("#NewRollover is invoked with the same key", func() {
+
+			renewed, err := root.Renew(nil, time.Hour)
+			So(err, ShouldBeNil)
+
+			_, err = NewRollover(root, renewed)
+
+			Convey("it returns an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,377 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// spiffeScheme defines the URI scheme of SPIFFE IDs.
+	spiffeScheme = "spiffe"
+
+	// x509SVIDUse defines the use of the keys of a SPIFFE bundle that are X.509-SVID authorities.
+	x509SVIDUse = "x509-svid"
+)
+
+// ParseSPIFFEID parses and validates a SPIFFE ID (e.g., "spiffe://nautls.com/api") as defined by the SPIFFE ID
+// specification. The trust domain must be lower case and the path, if any, must consist of non-empty segments other than
+// "." and "..". Ports, user information, queries and fragments are not permitted.
+func ParseSPIFFEID(value string) (*url.URL, error) {
+
+	if !strings.HasPrefix(value, spiffeScheme+"://") {
+		return nil, fmt.Errorf("spiffe id [%s] does not use the spiffe scheme", value)
+	}
+
+	remainder := strings.TrimPrefix(value, spiffeScheme+"://")
+
+	trustDomain, path := remainder, ""
+	if index := strings.Index(remainder, "/"); index >= 0 {
+		trustDomain, path = remainder[:index], remainder[index:]
+	}
+
+	if err := validateTrustDomain(trustDomain); err != nil {
+		return nil, errors.Wrapf(err, "invalid spiffe id [%s]", value)
+	}
+
+	if path != "" {
+		for _, segment := range strings.Split(path[1:], "/") {
+			if err := validatePathSegment(segment); err != nil {
+				return nil, errors.Wrapf(err, "invalid spiffe id [%s]", value)
+			}
+		}
+	}
+
+	return &url.URL{Scheme: spiffeScheme, Host: trustDomain, Path: path}, nil
+}
+
+// ParseSPIFFETrustDomain parses and validates a SPIFFE trust domain (e.g., "nautls.com") optionally prefixed by the
+// spiffe scheme (e.g., "spiffe://nautls.com") and returns it without the scheme.
+func ParseSPIFFETrustDomain(value string) (string, error) {
+
+	trustDomain := strings.TrimPrefix(value, spiffeScheme+"://")
+
+	if err := validateTrustDomain(trustDomain); err != nil {
+		return "", errors.Wrapf(err, "invalid spiffe trust domain [%s]", value)
+	}
+
+	return trustDomain, nil
+}
+
+// SPIFFEID returns the SPIFFE ID of an X.509-SVID. An error is returned if the certificate does not have exactly one
+// URI subject alternative name or if it is not a valid SPIFFE ID.
+func SPIFFEID(certificate *x509.Certificate) (*url.URL, error) {
+
+	if len(certificate.URIs) != 1 {
+		return nil, fmt.Errorf("certificate for [%s] has [%d] uri subject alternative names", certificate.Subject.CommonName, len(certificate.URIs))
+	}
+
+	return ParseSPIFFEID(certificate.URIs[0].String())
+}
+
+// SVIDTemplate returns a template for an X.509-SVID with the provided SPIFFE ID as its only URI subject alternative
+// name. The subject of the template is empty, the key usages are those permitted for leaf SVIDs and the template is valid
+// for the LeafValidity.
+func SVIDTemplate(id string) (Template, error) {
+
+	spiffeID, err := ParseSPIFFEID(id)
+	if err != nil {
+		return Template{}, errors.Wrapf(err, "error creating svid template for [%s]", id)
+	}
+
+	template, err := profile(pkix.Name{}, LeafValidity)
+	if err != nil {
+		return Template{}, errors.Wrapf(err, "error creating svid template for [%s]", id)
+	}
+
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}
+	template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageKeyAgreement
+	template.URIs = []*url.URL{spiffeID}
+
+	return template, nil
+}
+
+// VerifySVID verifies that the first of the certificates is an X.509-SVID that chains through the remaining
+// certificates to the roots of its own trust domain and returns the verified chains. The roots are keyed by trust domain
+// (e.g., "nautls.com") and an error is returned if none are defined for the trust domain of the SVID, such that the
+// authorities of one trust domain cannot issue SVIDs for another. Note that hostnames are not verified and that any
+// extended key usage is accepted.
+func VerifySVID(certificates []*x509.Certificate, roots map[string]*x509.CertPool) ([][]*x509.Certificate, error) {
+
+	if len(certificates) == 0 {
+		return nil, errors.New("error verifying svid without certificates")
+	}
+
+	leaf := certificates[0]
+
+	if leaf.IsCA {
+		return nil, fmt.Errorf("error verifying svid [%s] as it is a certificate authority", leaf.URIs)
+	}
+
+	id, err := SPIFFEID(leaf)
+	if err != nil {
+		return nil, errors.Wrap(err, "error verifying svid")
+	}
+
+	pool, ok := roots[id.Host]
+	if !ok {
+		return nil, fmt.Errorf("error verifying svid [%s] without authorities for trust domain [%s]", id, id.Host)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		Roots:         pool,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error verifying svid [%s]", id)
+	}
+
+	return chains, nil
+}
+
+// SPIFFEAuthorizer authorizes X.509-SVIDs by their SPIFFE IDs or trust domains.
+type SPIFFEAuthorizer struct {
+	ids          []string
+	trustDomains []string
+}
+
+// NewSPIFFEAuthorizer returns a SPIFFEAuthorizer that authorizes SVIDs whose SPIFFE ID is one of the IDs or belongs to
+// one of the trust domains (e.g., "nautls.com").
+func NewSPIFFEAuthorizer(ids []string, trustDomains []string) (*SPIFFEAuthorizer, error) {
+
+	authorizer := &SPIFFEAuthorizer{}
+
+	for _, id := range ids {
+
+		parsed, err := ParseSPIFFEID(id)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating spiffe authorizer")
+		}
+
+		authorizer.ids = append(authorizer.ids, parsed.String())
+	}
+
+	for _, value := range trustDomains {
+
+		trustDomain, err := ParseSPIFFETrustDomain(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating spiffe authorizer")
+		}
+
+		authorizer.trustDomains = append(authorizer.trustDomains, trustDomain)
+	}
+
+	return authorizer, nil
+}
+
+// Authorize returns an error if the SPIFFE ID of an X.509-SVID is not authorized.
+func (a *SPIFFEAuthorizer) Authorize(certificate *x509.Certificate) error {
+
+	id, err := SPIFFEID(certificate)
+	if err != nil {
+		return errors.Wrap(err, "error authorizing svid")
+	}
+
+	if containsString(a.ids, id.String()) || containsString(a.trustDomains, id.Host) {
+		return nil
+	}
+
+	return fmt.Errorf("spiffe id [%s] is not authorized", id)
+}
+
+// spiffeBundle represents a SPIFFE trust bundle (i.e., an RFC 7517 JWK set with SPIFFE parameters).
+type spiffeBundle struct {
+	Keys        []jwk  `json:"keys"`
+	RefreshHint int    `json:"spiffe_refresh_hint,omitempty"`
+	Sequence    uint64 `json:"spiffe_sequence,omitempty"`
+}
+
+// jwk represents the parameters of an RFC 7517 JSON web key used by SPIFFE trust bundles.
+type jwk struct {
+	Curve                string   `json:"crv,omitempty"`
+	Exponent             string   `json:"e,omitempty"`
+	KeyType              string   `json:"kty"`
+	Modulus              string   `json:"n,omitempty"`
+	Use                  string   `json:"use"`
+	X                    string   `json:"x,omitempty"`
+	X509CertificateChain []string `json:"x5c,omitempty"`
+	Y                    string   `json:"y,omitempty"`
+}
+
+// DecodeSPIFFEBundle decodes the X.509-SVID authorities of a SPIFFE trust bundle. Keys for other uses (e.g., JWT-SVIDs)
+// are ignored and an error is returned if the parameters of a key do not match its certificate.
+func DecodeSPIFFEBundle(bytes []byte) ([]*x509.Certificate, error) {
+
+	var bundle spiffeBundle
+	if err := json.Unmarshal(bytes, &bundle); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling spiffe bundle")
+	}
+
+	var certificates []*x509.Certificate
+
+	for index, key := range bundle.Keys {
+
+		if key.Use != x509SVIDUse {
+			continue
+		}
+
+		if len(key.X509CertificateChain) != 1 {
+			return nil, fmt.Errorf("expected one certificate for key [%d] of spiffe bundle but found [%d]", index, len(key.X509CertificateChain))
+		}
+
+		der, err := base64.StdEncoding.DecodeString(key.X509CertificateChain[0])
+		if err != nil {
+			return nil, errors.Wrapf(err, "error decoding certificate for key [%d] of spiffe bundle", index)
+		}
+
+		certificate, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing certificate for key [%d] of spiffe bundle", index)
+		}
+
+		expected, err := newJWK(certificate)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error encoding public key for key [%d] of spiffe bundle", index)
+		}
+
+		if expected.KeyType != key.KeyType || expected.Curve != key.Curve || expected.X != key.X || expected.Y != key.Y || expected.Modulus != key.Modulus || expected.Exponent != key.Exponent {
+			return nil, fmt.Errorf("parameters of key [%d] of spiffe bundle do not match its certificate", index)
+		}
+
+		certificates = append(certificates, certificate)
+	}
+
+	return certificates, nil
+}
+
+// EncodeSPIFFEBundle encodes certificates as the X.509-SVID authorities of a SPIFFE trust bundle. Note that only ECDSA,
+// Ed25519 and RSA public keys are supported.
+func EncodeSPIFFEBundle(certificates []*x509.Certificate) ([]byte, error) {
+
+	bundle := spiffeBundle{Keys: []jwk{}}
+
+	for _, certificate := range certificates {
+
+		key, err := newJWK(certificate)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error encoding public key for [%s]", certificate.Subject.CommonName)
+		}
+
+		bundle.Keys = append(bundle.Keys, key)
+	}
+
+	bytes, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshalling spiffe bundle")
+	}
+
+	return bytes, nil
+}
+
+// LoadSPIFFEBundle loads the X.509-SVID authorities of a SPIFFE trust bundle from a URL.
+func LoadSPIFFEBundle(resource string) ([]*x509.Certificate, error) {
+
+	bytes, err := loadResource(resource)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading spiffe bundle from [%s]", resource)
+	}
+
+	certificates, err := DecodeSPIFFEBundle(bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error decoding spiffe bundle from [%s]", resource)
+	}
+
+	return certificates, nil
+}
+
+// newJWK returns the JSON web key of the public key of a certificate for use as an X.509-SVID authority.
+func newJWK(certificate *x509.Certificate) (jwk, error) {
+
+	key := jwk{
+		Use:                  x509SVIDUse,
+		X509CertificateChain: []string{base64.StdEncoding.EncodeToString(certificate.Raw)},
+	}
+
+	switch public := certificate.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+		key.Curve = public.Curve.Params().Name
+		key.KeyType = "EC"
+		key.X = base64.RawURLEncoding.EncodeToString(public.X.FillBytes(make([]byte, size)))
+		key.Y = base64.RawURLEncoding.EncodeToString(public.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		key.Curve = "Ed25519"
+		key.KeyType = "OKP"
+		key.X = base64.RawURLEncoding.EncodeToString(public)
+	case *rsa.PublicKey:
+		key.Exponent = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		key.KeyType = "RSA"
+		key.Modulus = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+	default:
+		return jwk{}, fmt.Errorf("unsupported public key type [%T]", certificate.PublicKey)
+	}
+
+	return key, nil
+}
+
+// validateTrustDomain returns an error if a value is not a valid SPIFFE trust domain.
+func validateTrustDomain(value string) error {
+
+	if value == "" {
+		return errors.New("trust domain is empty")
+	}
+
+	for _, character := range value {
+		if !(character >= 'a' && character <= 'z') && !(character >= '0' && character <= '9') && !strings.ContainsRune(".-_", character) {
+			return fmt.Errorf("trust domain [%s] contains invalid character [%c]", value, character)
+		}
+	}
+
+	return nil
+}
+
+// validatePathSegment returns an error if a value is not a valid segment of the path of a SPIFFE ID.
+func validatePathSegment(value string) error {
+
+	if value == "" || value == "." || value == ".." {
+		return fmt.Errorf("path segment [%s] is empty or relative", value)
+	}
+
+	for _, character := range value {
+		if !(character >= 'a' && character <= 'z') && !(character >= 'A' && character <= 'Z') && !(character >= '0' && character <= '9') && !strings.ContainsRune(".-_", character) {
+			return fmt.Errorf("path segment [%s] contains invalid character [%c]", value, character)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,365 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSPIFFE(t *testing.T) {
+
+	Convey("When using SPIFFE", t, func() {
+
+		root := MustSelf("NauTLS (Root)", t)
+
+		template, err := SVIDTemplate("spiffe://nautls.com/api/v1")
+		So(err, ShouldBeNil)
+
+		svid, err := root.Issue(template, ECDSA, 256)
+		So(err, ShouldBeNil)
+
+		Convey("#ParseSPIFFEID is invoked", func() {
+
+			Convey("with valid identifiers", func() {
+
+				for _, value := range []string{"spiffe://nautls.com", "spiffe://nautls.com/api", "spiffe://nautls-1.com/API/v1_2"} {
+
+					id, err := ParseSPIFFEID(value)
+
+					Convey(fmt.Sprintf("it parses [%s]", value), func() {
+						So(err, ShouldBeNil)
+						So(id.String(), ShouldEqual, value)
+					})
+				}
+			})
+
+			Convey("with invalid identifiers", func() {
+
+				values := []string{
+					"https://nautls.com/api",
+					"SPIFFE://nautls.com/api",
+					"spiffe://",
+					"spiffe://NauTLS.com/api",
+					"spiffe://nautls.com:8443/api",
+					"spiffe://user@nautls.com/api",
+					"spiffe://nautls.com/",
+					"spiffe://nautls.com//api",
+					"spiffe://nautls.com/./api",
+					"spiffe://nautls.com/../api",
+					"spiffe://nautls.com/api?query",
+					"spiffe://nautls.com/api#fragment",
+				}
+
+				for _, value := range values {
+
+					_, err := ParseSPIFFEID(value)
+
+					Convey(fmt.Sprintf("it rejects [%s]", value), func() {
+						So(err, ShouldNotBeNil)
+					})
+				}
+			})
+		})
+
+		Convey("#SVIDTemplate is invoked", func() {
+
+			Convey("it returns an svid", func() {
+				So(svid.Certificate.Subject.CommonName, ShouldBeEmpty)
+				So(svid.Certificate.URIs, ShouldHaveLength, 1)
+				So(svid.Certificate.URIs[0].String(), ShouldEqual, "spiffe://nautls.com/api/v1")
+				So(svid.Certificate.IsCA, ShouldBeFalse)
+				So(svid.Certificate.KeyUsage&x509.KeyUsageDigitalSignature, ShouldNotBeZeroValue)
+				So(svid.Certificate.KeyUsage&(x509.KeyUsageCertSign|x509.KeyUsageCRLSign), ShouldBeZeroValue)
+			})
+
+			Convey("with an invalid identifier", func() {
+
+				_, err := SVIDTemplate("spiffe://nautls.com/")
+
+				Convey("it returns an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey("#SPIFFEID is invoked", func() {
+
+			Convey("with an svid", func() {
+
+				id, err := SPIFFEID(svid.Certificate)
+
+				Convey("it returns the identifier", func() {
+					So(err, ShouldBeNil)
+					So(id.String(), ShouldEqual, "spiffe://nautls.com/api/v1")
+				})
+			})
+
+			Convey("with a certificate without uris", func() {
+
+				_, err := SPIFFEID(MustIssue(root, "nautls.com", t).Certificate)
+
+				Convey("it returns an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey("#VerifySVID is invoked", func() {
+
+			pool := x509.NewCertPool()
+			pool.AddCert(root.Certificate)
+
+			roots := map[string]*x509.CertPool{"nautls.com": pool}
+
+			Convey("with a trusted svid", func() {
+
+				chains, err := VerifySVID([]*x509.Certificate{svid.Certificate}, roots)
+
+				Convey("it returns the verified chains", func() {
+					So(err, ShouldBeNil)
+					So(chains, ShouldResemble, [][]*x509.Certificate{{svid.Certificate, root.Certificate}})
+				})
+			})
+
+			Convey("with an untrusted svid", func() {
+
+				other, err := MustSelf("NauTLS (Other)", t).Issue(template, ECDSA, 256)
+				So(err, ShouldBeNil)
+
+				_, err = VerifySVID([]*x509.Certificate{other.Certificate}, roots)
+
+				Convey("it returns an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("with an svid issued for another trust domain", func() {
+
+				template, err := SVIDTemplate("spiffe://nautls.org/api/v1")
+				So(err, ShouldBeNil)
+
+				other, err := root.Issue(template, ECDSA, 256)
+				So(err, ShouldBeNil)
+
+				Convey("without authorities for the trust domain", func() {
+
+					_, err := VerifySVID([]*x509.Certificate{other.Certificate}, roots)
+
+					Convey("it returns an error", func() {
+						So(err, ShouldNotBeNil)
+					})
+				})
+
+				Convey("with the authorities of another trust domain for the trust domain", func() {
+
+					roots["nautls.org"] = MustSelf("NauTLS (Other)", t).TrustPool()
+
+					_, err := VerifySVID([]*x509.Certificate{other.Certificate}, roots)
+
+					Convey("it returns an error", func() {
+						So(err, ShouldNotBeNil)
+					})
+				})
+			})
+
+			Convey("with a certificate authority", func() {
+
+				_, err := VerifySVID([]*x509.Certificate{root.Certificate}, roots)
+
+				Convey("it returns an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey("#ParseSPIFFETrustDomain is invoked", func() {
+
+			Convey("with a trust domain", func() {
+
+				trustDomain, err := ParseSPIFFETrustDomain("spiffe://nautls.com")
+
+				Convey("it returns the trust domain without the scheme", func() {
+					So(err, ShouldBeNil)
+					So(trustDomain, ShouldEqual, "nautls.com")
+				})
+			})
+
+			Convey("with an invalid trust domain", func() {
+
+				_, err := ParseSPIFFETrustDomain("NauTLS.com")
+
+				Convey("it returns an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey("#NewSPIFFEAuthorizer is invoked", func() {
+
+			Convey("with an identifier", func() {
+
+				authorizer, err := NewSPIFFEAuthorizer([]string{"spiffe://nautls.com/api/v1"}, nil)
+				So(err, ShouldBeNil)
+
+				Convey("it authorizes the identifier", func() {
+					So(authorizer.Authorize(svid.Certificate), ShouldBeNil)
+				})
+
+				Convey("it rejects other identifiers", func() {
+
+					template, err := SVIDTemplate("spiffe://nautls.com/api/v2")
+					So(err, ShouldBeNil)
+
+					other, err := root.Issue(template, ECDSA, 256)
+					So(err, ShouldBeNil)
+
+					So(authorizer.Authorize(other.Certificate), ShouldNotBeNil)
+				})
+			})
+
+			Convey("with a trust domain", func() {
+
+				authorizer, err := NewSPIFFEAuthorizer(nil, []string{"nautls.com"})
+				So(err, ShouldBeNil)
+
+				Convey("it authorizes identifiers in the trust domain", func() {
+					So(authorizer.Authorize(svid.Certificate), ShouldBeNil)
+				})
+
+				Convey("it rejects identifiers in other trust domains", func() {
+
+					template, err := SVIDTemplate("spiffe://nautls.org/api/v1")
+					So(err, ShouldBeNil)
+
+					other, err := root.Issue(template, ECDSA, 256)
+					So(err, ShouldBeNil)
+
+					So(authorizer.Authorize(other.Certificate), ShouldNotBeNil)
+				})
+			})
+
+			Convey("with an invalid trust domain", func() {
+
+				_, err := NewSPIFFEAuthorizer(nil, []string{"NauTLS.com"})
+
+				Convey("it returns an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey("#EncodeSPIFFEBundle is invoked", func() {
+
+			rsa, err := Self(Template{
+				BasicConstraintsValid: true,
+				IsCA:                  true,
+				NotAfter:              root.Certificate.NotAfter,
+				NotBefore:             root.Certificate.NotBefore,
+				SerialNumber:          root.Certificate.SerialNumber,
+			}, RSA, 2048)
+			So(err, ShouldBeNil)
+
+			bytes, err := EncodeSPIFFEBundle([]*x509.Certificate{root.Certificate, rsa.Certificate})
+			So(err, ShouldBeNil)
+
+			Convey("and #DecodeSPIFFEBundle is invoked", func() {
+
+				certificates, err := DecodeSPIFFEBundle(bytes)
+
+				Convey("it returns the certificates", func() {
+					So(err, ShouldBeNil)
+					So(certificates, ShouldResemble, []*x509.Certificate{root.Certificate, rsa.Certificate})
+				})
+			})
+
+			Convey("with an ed25519 authority", func() {
+
+				ed25519, err := Self(Template{
+					BasicConstraintsValid: true,
+					IsCA:                  true,
+					NotAfter:              root.Certificate.NotAfter,
+					NotBefore:             root.Certificate.NotBefore,
+					SerialNumber:          root.Certificate.SerialNumber,
+				}, Ed25519, 0)
+				So(err, ShouldBeNil)
+
+				bytes, err := EncodeSPIFFEBundle([]*x509.Certificate{ed25519.Certificate})
+				So(err, ShouldBeNil)
+
+				Convey("it encodes an okp key", func() {
+					So(string(bytes), ShouldContainSubstring, `"kty":"OKP"`)
+					So(string(bytes), ShouldContainSubstring, `"crv":"Ed25519"`)
+				})
+
+				Convey("and #DecodeSPIFFEBundle is invoked it returns the certificate", func() {
+
+					certificates, err := DecodeSPIFFEBundle(bytes)
+
+					So(err, ShouldBeNil)
+					So(certificates, ShouldResemble, []*x509.Certificate{ed25519.Certificate})
+				})
+			})
+
+			Convey("and #LoadSPIFFEBundle is invoked", func() {
+
+				certificates, err := LoadSPIFFEBundle("base64:///" + url.PathEscape(base64.StdEncoding.EncodeToString(bytes)))
+
+				Convey("it returns the certificates", func() {
+					So(err, ShouldBeNil)
+					So(certificates, ShouldResemble, []*x509.Certificate{root.Certificate, rsa.Certificate})
+				})
+			})
+		})
+
+		Convey("#DecodeSPIFFEBundle is invoked", func() {
+
+			encoded := base64.StdEncoding.EncodeToString(root.Certificate.Raw)
+
+			Convey("with keys for other uses", func() {
+
+				certificates, err := DecodeSPIFFEBundle([]byte(`{"keys":[{"use":"jwt-svid","kty":"EC","kid":"1"}],"spiffe_sequence":1}`))
+
+				Convey("it ignores the keys", func() {
+					So(err, ShouldBeNil)
+					So(certificates, ShouldBeEmpty)
+				})
+			})
+
+			Convey("with mismatched key parameters", func() {
+
+				_, err := DecodeSPIFFEBundle([]byte(`{"keys":[{"use":"x509-svid","kty":"EC","crv":"P-256","x":"AA","y":"AA","x5c":["` + encoded + `"]}]}`))
+
+				Convey("it returns an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("with invalid json", func() {
+
+				_, err := DecodeSPIFFEBundle([]byte(`{"keys":`))
+
+				Convey("it returns an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+	})
+}
@@ -22,6 +22,7 @@ type Template struct {
 	ExcludedURIDomains          []string
 	ExtKeyUsage                 []x509.ExtKeyUsage
 	ExtraExtensions             []pkix.Extension
+	IPAddresses                 []net.IP
 	IsCA                        bool
 	IssuingCertificateURL       []string
 	KeyUsage                    x509.KeyUsage
@@ -57,6 +58,7 @@ func (t *Template) certificate() *x509.Certificate {
 		ExcludedURIDomains:          t.ExcludedURIDomains,
 		ExtKeyUsage:                 t.ExtKeyUsage,
 		ExtraExtensions:             t.ExtraExtensions,
+		IPAddresses:                 t.IPAddresses,
 		IsCA:                        t.IsCA,
 		IssuingCertificateURL:       t.IssuingCertificateURL,
 		KeyUsage:                    t.KeyUsage,
@@ -0,0 +1,253 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NameConfig provides a serializable representation of a pkix.Name structure.
+type NameConfig struct {
+	CommonName         string   `json:"common_name" mapstructure:"common_name" yaml:"common_name"`
+	Country            []string `json:"country" mapstructure:"country" yaml:"country"`
+	Locality           []string `json:"locality" mapstructure:"locality" yaml:"locality"`
+	Organization       []string `json:"organization" mapstructure:"organization" yaml:"organization"`
+	OrganizationalUnit []string `json:"organizational_unit" mapstructure:"organizational_unit" yaml:"organizational_unit"`
+	PostalCode         []string `json:"postal_code" mapstructure:"postal_code" yaml:"postal_code"`
+	Province           []string `json:"province" mapstructure:"province" yaml:"province"`
+	SerialNumber       string   `json:"serial_number" mapstructure:"serial_number" yaml:"serial_number"`
+	StreetAddress      []string `json:"street_address" mapstructure:"street_address" yaml:"street_address"`
+}
+
+// Build creates a pkix.Name from the NameConfig instance.
+func (c *NameConfig) Build() pkix.Name {
+	return pkix.Name{
+		CommonName:         c.CommonName,
+		Country:            c.Country,
+		Locality:           c.Locality,
+		Organization:       c.Organization,
+		OrganizationalUnit: c.OrganizationalUnit,
+		PostalCode:         c.PostalCode,
+		Province:           c.Province,
+		SerialNumber:       c.SerialNumber,
+		StreetAddress:      c.StreetAddress,
+	}
+}
+
+// TemplateConfig provides a serializable representation of a Template structure.
+type TemplateConfig struct {
+
+	// Subject defines the subject of the certificate as individual fields. Note that the subject may not be combined
+	// with the SubjectDN.
+	Subject NameConfig `json:"subject" mapstructure:"subject" yaml:"subject"`
+
+	// SubjectDN defines the subject of the certificate as an RFC 4514 distinguished name (e.g., "CN=nautls.com,C=US").
+	// Note that the SubjectDN may not be combined with the Subject.
+	SubjectDN string `json:"subject_dn" mapstructure:"subject_dn" yaml:"subject_dn"`
+
+	// Validity defines the duration from the time the template is built that the certificate is valid (e.g., "2160h"
+	// or "90d").
+	Validity Duration `json:"validity" mapstructure:"validity" yaml:"validity"`
+
+	// IsCA defines whether the certificate is a certificate authority. Note that basic constraints are always defined.
+	IsCA           bool `json:"is_ca" mapstructure:"is_ca" yaml:"is_ca"`
+	MaxPathLen     int  `json:"max_path_len" mapstructure:"max_path_len" yaml:"max_path_len"`
+	MaxPathLenZero bool `json:"max_path_len_zero" mapstructure:"max_path_len_zero" yaml:"max_path_len_zero"`
+
+	// KeyUsages and ExtKeyUsages define the key usages and extended key usages of the certificate by name (e.g.,
+	// "DigitalSignature" or "ServerAuth").
+	KeyUsages    []KeyUsage    `json:"key_usages" mapstructure:"key_usages" yaml:"key_usages"`
+	ExtKeyUsages []ExtKeyUsage `json:"ext_key_usages" mapstructure:"ext_key_usages" yaml:"ext_key_usages"`
+
+	// DNSNames, EmailAddresses, IPAddresses and URIs define the subject alternative names of the certificate.
+	DNSNames       []string `json:"dns_names" mapstructure:"dns_names" yaml:"dns_names"`
+	EmailAddresses []string `json:"email_addresses" mapstructure:"email_addresses" yaml:"email_addresses"`
+	IPAddresses    []string `json:"ip_addresses" mapstructure:"ip_addresses" yaml:"ip_addresses"`
+	URIs           []string `json:"uris" mapstructure:"uris" yaml:"uris"`
+
+	// The name constraints of the certificate. Note that IP ranges must be defined in CIDR notation (e.g.,
+	// "10.0.0.0/8").
+	PermittedDNSDomainsCritical bool     `json:"permitted_dns_domains_critical" mapstructure:"permitted_dns_domains_critical" yaml:"permitted_dns_domains_critical"`
+	PermittedDNSDomains         []string `json:"permitted_dns_domains" mapstructure:"permitted_dns_domains" yaml:"permitted_dns_domains"`
+	ExcludedDNSDomains          []string `json:"excluded_dns_domains" mapstructure:"excluded_dns_domains" yaml:"excluded_dns_domains"`
+	PermittedIPRanges           []string `json:"permitted_ip_ranges" mapstructure:"permitted_ip_ranges" yaml:"permitted_ip_ranges"`
+	ExcludedIPRanges            []string `json:"excluded_ip_ranges" mapstructure:"excluded_ip_ranges" yaml:"excluded_ip_ranges"`
+	PermittedEmailAddresses     []string `json:"permitted_email_addresses" mapstructure:"permitted_email_addresses" yaml:"permitted_email_addresses"`
+	ExcludedEmailAddresses      []string `json:"excluded_email_addresses" mapstructure:"excluded_email_addresses" yaml:"excluded_email_addresses"`
+	PermittedURIDomains         []string `json:"permitted_uri_domains" mapstructure:"permitted_uri_domains" yaml:"permitted_uri_domains"`
+	ExcludedURIDomains          []string `json:"excluded_uri_domains" mapstructure:"excluded_uri_domains" yaml:"excluded_uri_domains"`
+
+	// The revocation and issuer information locations of the certificate.
+	CRLDistributionPoints []string `json:"crl_distribution_points" mapstructure:"crl_distribution_points" yaml:"crl_distribution_points"`
+	IssuingCertificateURL []string `json:"issuing_certificate_url" mapstructure:"issuing_certificate_url" yaml:"issuing_certificate_url"`
+	OCSPServer            []string `json:"ocsp_server" mapstructure:"ocsp_server" yaml:"ocsp_server"`
+}
+
+// Build creates a Template from the TemplateConfig instance. The template is assigned a random serial number and is
+// valid for the duration of the validity from the current time less the Backdate.
+func (c *TemplateConfig) Build() (Template, error) {
+
+	subject := c.Subject.Build()
+
+	if c.SubjectDN != "" {
+
+		if !reflect.DeepEqual(c.Subject, NameConfig{}) {
+			return Template{}, errors.New("error building template with both a subject and a subject dn")
+		}
+
+		name, err := ParseDistinguishedName(c.SubjectDN)
+		if err != nil {
+			return Template{}, errors.Wrap(err, "error building template subject")
+		}
+
+		subject = name
+	}
+
+	if c.Validity <= 0 {
+		return Template{}, fmt.Errorf("error building template for [%s] with invalid validity [%s]", subject.CommonName, c.Validity.ToString())
+	}
+
+	template, err := profile(subject, time.Duration(c.Validity))
+	if err != nil {
+		return Template{}, errors.Wrapf(err, "error creating template for [%s]", subject.CommonName)
+	}
+
+	ips, err := parseIPs(c.IPAddresses)
+	if err != nil {
+		return Template{}, errors.Wrapf(err, "error parsing ip addresses for [%s]", subject.CommonName)
+	}
+
+	uris, err := parseURLs(c.URIs)
+	if err != nil {
+		return Template{}, errors.Wrapf(err, "error parsing uris for [%s]", subject.CommonName)
+	}
+
+	permitted, err := parseCIDRs(c.PermittedIPRanges)
+	if err != nil {
+		return Template{}, errors.Wrapf(err, "error parsing permitted ip ranges for [%s]", subject.CommonName)
+	}
+
+	excluded, err := parseCIDRs(c.ExcludedIPRanges)
+	if err != nil {
+		return Template{}, errors.Wrapf(err, "error parsing excluded ip ranges for [%s]", subject.CommonName)
+	}
+
+	var keyUsage x509.KeyUsage
+	for _, usage := range c.KeyUsages {
+		keyUsage |= x509.KeyUsage(usage)
+	}
+
+	var extKeyUsage []x509.ExtKeyUsage
+	for _, usage := range c.ExtKeyUsages {
+		extKeyUsage = append(extKeyUsage, x509.ExtKeyUsage(usage))
+	}
+
+	template.CRLDistributionPoints = c.CRLDistributionPoints
+	template.DNSNames = c.DNSNames
+	template.EmailAddresses = c.EmailAddresses
+	template.ExcludedDNSDomains = c.ExcludedDNSDomains
+	template.ExcludedEmailAddresses = c.ExcludedEmailAddresses
+	template.ExcludedIPRanges = excluded
+	template.ExcludedURIDomains = c.ExcludedURIDomains
+	template.ExtKeyUsage = extKeyUsage
+	template.IPAddresses = ips
+	template.IsCA = c.IsCA
+	template.IssuingCertificateURL = c.IssuingCertificateURL
+	template.KeyUsage = keyUsage
+	template.MaxPathLen = c.MaxPathLen
+	template.MaxPathLenZero = c.MaxPathLenZero
+	template.OCSPServer = c.OCSPServer
+	template.PermittedDNSDomains = c.PermittedDNSDomains
+	template.PermittedDNSDomainsCritical = c.PermittedDNSDomainsCritical
+	template.PermittedEmailAddresses = c.PermittedEmailAddresses
+	template.PermittedIPRanges = permitted
+	template.PermittedURIDomains = c.PermittedURIDomains
+	template.URIs = uris
+
+	return template, nil
+}
+
+// RandomSerialNumber returns a random, positive 128-bit serial number.
+func RandomSerialNumber() (*big.Int, error) {
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading random serial number")
+	}
+
+	if serial.Sign() == 0 {
+		return RandomSerialNumber()
+	}
+
+	return serial, nil
+}
+
+// parseIPs parses a slice of strings as IP addresses.
+func parseIPs(values []string) ([]net.IP, error) {
+
+	var ips []net.IP
+
+	for _, value := range values {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ip address [%s]", value)
+		}
+		ips = append(ips, ip)
+	}
+
+	return ips, nil
+}
+
+// parseURLs parses a slice of strings as URLs.
+func parseURLs(values []string) ([]*url.URL, error) {
+
+	var urls []*url.URL
+
+	for _, value := range values {
+		parsed, err := url.Parse(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid url [%s]", value)
+		}
+		urls = append(urls, parsed)
+	}
+
+	return urls, nil
+}
+
+// parseCIDRs parses a slice of strings in CIDR notation as IP networks.
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+
+	var networks []*net.IPNet
+
+	for _, value := range values {
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid cidr [%s]", value)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
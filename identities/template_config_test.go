@@ -0,0 +1,271 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/deciphernow/nautls/internal/tests"
+	"github.com/mitchellh/mapstructure"
+	"gopkg.in/yaml.v2"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// ExpectedTemplateConfig returns the template configuration defined in the testdata directory.
+func ExpectedTemplateConfig() TemplateConfig {
+	return TemplateConfig{
+		SubjectDN:         "CN=nautls.com,O=Decipher Technology Studios,C=US",
+		Validity:          Duration(90 * 24 * time.Hour),
+		KeyUsages:         []KeyUsage{KeyUsage(x509.KeyUsageDigitalSignature), KeyUsage(x509.KeyUsageKeyEncipherment)},
+		ExtKeyUsages:      []ExtKeyUsage{ExtKeyUsage(x509.ExtKeyUsageServerAuth), ExtKeyUsage(x509.ExtKeyUsageClientAuth)},
+		DNSNames:          []string{"nautls.com"},
+		IPAddresses:       []string{"127.0.0.1", "::1"},
+		URIs:              []string{"spiffe://nautls.com/service"},
+		PermittedIPRanges: []string{"10.0.0.0/8"},
+	}
+}
+
+func TestTemplateConfig(t *testing.T) {
+
+	Convey("When TemplateConfig", t, func() {
+
+		Convey("is deserialized from json", func() {
+
+			var actual TemplateConfig
+			err := json.Unmarshal(tests.MustRead("testdata/template.json", t), &actual)
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("it returns the expected configuration", func() {
+				So(actual, ShouldResemble, ExpectedTemplateConfig())
+			})
+		})
+
+		Convey("is deserialized from yaml", func() {
+
+			var actual TemplateConfig
+			err := yaml.Unmarshal(tests.MustRead("testdata/template.yaml", t), &actual)
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("it returns the expected configuration", func() {
+				So(actual, ShouldResemble, ExpectedTemplateConfig())
+			})
+		})
+
+		Convey("is decoded with mapstructure", func() {
+
+			var values map[string]interface{}
+			if err := yaml.Unmarshal(tests.MustRead("testdata/template.yaml", t), &values); err != nil {
+				t.Fatalf("error unmarshalling yaml [%s]", err.Error())
+			}
+
+			var actual TemplateConfig
+			decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+				DecodeHook: mapstructure.ComposeDecodeHookFunc(StringToDuration(), StringToKeyUsage(), StringToExtKeyUsage()),
+				Result:     &actual,
+			})
+			if err != nil {
+				t.Fatalf("error initializing decoder [%s]", err.Error())
+			}
+
+			err = decoder.Decode(values)
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("it returns the expected configuration", func() {
+				So(actual, ShouldResemble, ExpectedTemplateConfig())
+			})
+		})
+
+		Convey(".Build is invoked", func() {
+
+			config := ExpectedTemplateConfig()
+
+			Convey("with a valid configuration", func() {
+
+				template, err := config.Build()
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("it returns the subject", func() {
+					So(template.Subject.String(), ShouldEqual, "CN=nautls.com,O=Decipher Technology Studios,C=US")
+				})
+
+				Convey("it returns the validity", func() {
+					So(template.NotAfter.Sub(template.NotBefore), ShouldEqual, 90*24*time.Hour+Backdate)
+				})
+
+				Convey("it returns the usages", func() {
+					So(template.KeyUsage, ShouldEqual, x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment)
+					So(template.ExtKeyUsage, ShouldResemble, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth})
+				})
+
+				Convey("it returns the subject alternative names", func() {
+					So(template.IPAddresses, ShouldHaveLength, 2)
+					So(template.IPAddresses[1].String(), ShouldEqual, "::1")
+					So(template.URIs[0].String(), ShouldEqual, "spiffe://nautls.com/service")
+				})
+
+				Convey("it returns the name constraints", func() {
+					So(template.PermittedIPRanges[0].String(), ShouldEqual, "10.0.0.0/8")
+				})
+
+				Convey("it returns a template that can be signed", func() {
+					identity, err := MustSelf("NauTLS (Root)", t).Issue(template, ECDSA, 256)
+					So(err, ShouldBeNil)
+					So(identity.Certificate.SerialNumber.Sign(), ShouldEqual, 1)
+				})
+			})
+
+			Convey("with subject fields", func() {
+
+				config.SubjectDN = ""
+				config.Subject = NameConfig{CommonName: "nautls.com", Organization: []string{"Decipher Technology Studios"}}
+				template, err := config.Build()
+
+				Convey("it returns the subject", func() {
+					So(template.Subject.String(), ShouldEqual, "CN=nautls.com,O=Decipher Technology Studios")
+				})
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("with both subject fields and a subject dn", func() {
+
+				config.Subject = NameConfig{CommonName: "nautls.com"}
+				_, err := config.Build()
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("with an invalid subject dn", func() {
+
+				config.SubjectDN = "nautls.com"
+				_, err := config.Build()
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("without a validity", func() {
+
+				config.Validity = 0
+				_, err := config.Build()
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("with an invalid ip address", func() {
+
+				config.IPAddresses = []string{"nautls.com"}
+				_, err := config.Build()
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("with an invalid ip range", func() {
+
+				config.PermittedIPRanges = []string{"10.0.0.0"}
+				_, err := config.Build()
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+	})
+
+	Convey("When Duration", t, func() {
+
+		Convey(".FromString is invoked", func() {
+
+			var duration Duration
+
+			Convey("with a duration", func() {
+
+				err := duration.FromString("36h30m")
+
+				Convey("it returns the duration", func() {
+					So(duration, ShouldEqual, Duration(36*time.Hour+30*time.Minute))
+				})
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("with a number of days", func() {
+
+				err := duration.FromString("365d")
+
+				Convey("it returns the duration", func() {
+					So(duration, ShouldEqual, Duration(365*24*time.Hour))
+				})
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("with an invalid value", func() {
+
+				err := duration.FromString("1.5d")
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+
+				Convey("it returns a zero duration", func() {
+					So(duration, ShouldBeZeroValue)
+				})
+			})
+		})
+
+		Convey(".MarshalJSON and .UnmarshalJSON are invoked", func() {
+
+			var actual Duration
+
+			bytes, err := json.Marshal(Duration(time.Hour))
+			So(err, ShouldBeNil)
+
+			err = json.Unmarshal(bytes, &actual)
+			So(err, ShouldBeNil)
+
+			So(actual, ShouldEqual, Duration(time.Hour))
+		})
+	})
+}
@@ -1,5 +1,8 @@
 {
 	"authorities": "{{ .authorities }}",
 	"certificate": "{{ .certificate }}",
-	"key": "{{ .key }}"
+	"key": "{{ .key }}",
+	"passphrase": "{{ .passphrase }}",
+	"pkcs12": "{{ .pkcs12 }}",
+	"verify": {{ .verify }}
 }
@@ -1,3 +1,6 @@
 authorities: "{{ .authorities }}"
 certificate: "{{ .certificate }}"
 key: "{{ .key }}"
+passphrase: "{{ .passphrase }}"
+pkcs12: "{{ .pkcs12 }}"
+verify: {{ .verify }}
@@ -0,0 +1,263 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+var (
+	keyUsages = map[KeyUsage]string{
+		KeyUsage(x509.KeyUsageDigitalSignature):  "DigitalSignature",
+		KeyUsage(x509.KeyUsageContentCommitment): "ContentCommitment",
+		KeyUsage(x509.KeyUsageKeyEncipherment):   "KeyEncipherment",
+		KeyUsage(x509.KeyUsageDataEncipherment):  "DataEncipherment",
+		KeyUsage(x509.KeyUsageKeyAgreement):      "KeyAgreement",
+		KeyUsage(x509.KeyUsageCertSign):          "CertSign",
+		KeyUsage(x509.KeyUsageCRLSign):           "CRLSign",
+		KeyUsage(x509.KeyUsageEncipherOnly):      "EncipherOnly",
+		KeyUsage(x509.KeyUsageDecipherOnly):      "DecipherOnly",
+	}
+
+	extKeyUsages = map[ExtKeyUsage]string{
+		ExtKeyUsage(x509.ExtKeyUsageAny):                            "Any",
+		ExtKeyUsage(x509.ExtKeyUsageServerAuth):                     "ServerAuth",
+		ExtKeyUsage(x509.ExtKeyUsageClientAuth):                     "ClientAuth",
+		ExtKeyUsage(x509.ExtKeyUsageCodeSigning):                    "CodeSigning",
+		ExtKeyUsage(x509.ExtKeyUsageEmailProtection):                "EmailProtection",
+		ExtKeyUsage(x509.ExtKeyUsageIPSECEndSystem):                 "IPSECEndSystem",
+		ExtKeyUsage(x509.ExtKeyUsageIPSECTunnel):                    "IPSECTunnel",
+		ExtKeyUsage(x509.ExtKeyUsageIPSECUser):                      "IPSECUser",
+		ExtKeyUsage(x509.ExtKeyUsageTimeStamping):                   "TimeStamping",
+		ExtKeyUsage(x509.ExtKeyUsageOCSPSigning):                    "OCSPSigning",
+		ExtKeyUsage(x509.ExtKeyUsageMicrosoftServerGatedCrypto):     "MicrosoftServerGatedCrypto",
+		ExtKeyUsage(x509.ExtKeyUsageNetscapeServerGatedCrypto):      "NetscapeServerGatedCrypto",
+		ExtKeyUsage(x509.ExtKeyUsageMicrosoftCommercialCodeSigning): "MicrosoftCommercialCodeSigning",
+		ExtKeyUsage(x509.ExtKeyUsageMicrosoftKernelCodeSigning):     "MicrosoftKernelCodeSigning",
+	}
+)
+
+// KeyUsage subtypes a single x509.KeyUsage flag to provide serialization support.
+type KeyUsage x509.KeyUsage
+
+// MarshalJSON implements the json.Marshaler interface for KeyUsage instances.
+func (k KeyUsage) MarshalJSON() ([]byte, error) {
+
+	value, err := k.ToString()
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshalling key usage to json")
+	}
+
+	return json.Marshal(value)
+}
+
+// MarshalYAML implements the yaml.Marshaler interface for KeyUsage instances.
+func (k KeyUsage) MarshalYAML() (interface{}, error) {
+	return k.ToString()
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for KeyUsage instances.
+func (k *KeyUsage) UnmarshalJSON(bytes []byte) error {
+
+	var value string
+
+	err := json.Unmarshal(bytes, &value)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling key usage from json")
+	}
+
+	return k.FromString(value)
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for KeyUsage instances.
+func (k *KeyUsage) UnmarshalYAML(unmarshal func(interface{}) error) error {
+
+	var value string
+
+	err := unmarshal(&value)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling key usage from yaml")
+	}
+
+	return k.FromString(value)
+}
+
+// FromString sets the value of a key usage to the value represented by a string (e.g., "DigitalSignature") or errors.
+func (k *KeyUsage) FromString(value string) error {
+
+	for usage, name := range keyUsages {
+		if strings.EqualFold(name, value) {
+			*k = usage
+			return nil
+		}
+	}
+
+	return fmt.Errorf("error unmarshalling unknown key usage value [%s]", value)
+}
+
+// ToString returns the string representation of the key usage or an error.
+func (k KeyUsage) ToString() (string, error) {
+
+	name, ok := keyUsages[k]
+	if !ok {
+		return "", fmt.Errorf("error converting unknown key usage value to string [%d]", k)
+	}
+
+	return name, nil
+}
+
+// StringToKeyUsage returns a mapstructure.DecodeHookFunc that converts a string to a key usage.
+func StringToKeyUsage() mapstructure.DecodeHookFunc {
+
+	return func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+
+		if from != reflect.TypeOf("") {
+			return data, nil
+		}
+
+		if to != reflect.TypeOf(KeyUsage(0)) {
+			return data, nil
+		}
+
+		var usage KeyUsage
+
+		err := usage.FromString(data.(string))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error decoding string as key usage")
+		}
+
+		return usage, nil
+	}
+}
+
+// KeyUsageNames returns the names of the bits set in a key usage (e.g., "DigitalSignature") where unknown bits are named
+// by their value.
+func KeyUsageNames(usage x509.KeyUsage) []string {
+
+	var names []string
+
+	for bit := x509.KeyUsageDigitalSignature; bit <= x509.KeyUsageDecipherOnly; bit <<= 1 {
+		if usage&bit != 0 {
+			name, err := KeyUsage(bit).ToString()
+			if err != nil {
+				name = fmt.Sprintf("%d", bit)
+			}
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// ExtKeyUsage subtypes x509.ExtKeyUsage to provide serialization support.
+type ExtKeyUsage x509.ExtKeyUsage
+
+// MarshalJSON implements the json.Marshaler interface for ExtKeyUsage instances.
+func (e ExtKeyUsage) MarshalJSON() ([]byte, error) {
+
+	value, err := e.ToString()
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshalling extended key usage to json")
+	}
+
+	return json.Marshal(value)
+}
+
+// MarshalYAML implements the yaml.Marshaler interface for ExtKeyUsage instances.
+func (e ExtKeyUsage) MarshalYAML() (interface{}, error) {
+	return e.ToString()
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for ExtKeyUsage instances.
+func (e *ExtKeyUsage) UnmarshalJSON(bytes []byte) error {
+
+	var value string
+
+	err := json.Unmarshal(bytes, &value)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling extended key usage from json")
+	}
+
+	return e.FromString(value)
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for ExtKeyUsage instances.
+func (e *ExtKeyUsage) UnmarshalYAML(unmarshal func(interface{}) error) error {
+
+	var value string
+
+	err := unmarshal(&value)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling extended key usage from yaml")
+	}
+
+	return e.FromString(value)
+}
+
+// FromString sets the value of an extended key usage to the value represented by a string (e.g., "ServerAuth") or
+// errors.
+func (e *ExtKeyUsage) FromString(value string) error {
+
+	for usage, name := range extKeyUsages {
+		if strings.EqualFold(name, value) {
+			*e = usage
+			return nil
+		}
+	}
+
+	return fmt.Errorf("error unmarshalling unknown extended key usage value [%s]", value)
+}
+
+// ToString returns the string representation of the extended key usage or an error.
+func (e ExtKeyUsage) ToString() (string, error) {
+
+	name, ok := extKeyUsages[e]
+	if !ok {
+		return "", fmt.Errorf("error converting unknown extended key usage value to string [%d]", e)
+	}
+
+	return name, nil
+}
+
+// StringToExtKeyUsage returns a mapstructure.DecodeHookFunc that converts a string to an extended key usage.
+func StringToExtKeyUsage() mapstructure.DecodeHookFunc {
+
+	return func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+
+		if from != reflect.TypeOf("") {
+			return data, nil
+		}
+
+		if to != reflect.TypeOf(ExtKeyUsage(0)) {
+			return data, nil
+		}
+
+		var usage ExtKeyUsage
+
+		err := usage.FromString(data.(string))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error decoding string as extended key usage")
+		}
+
+		return usage, nil
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identities
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"testing"
+
+	"github.com/mitchellh/mapstructure"
+	"gopkg.in/yaml.v2"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUsages(t *testing.T) {
+
+	Convey("When KeyUsage", t, func() {
+
+		Convey(".MarshalJSON is invoked", func() {
+
+			Convey("on a valid value", func() {
+
+				bytes, err := json.Marshal(KeyUsage(x509.KeyUsageCertSign))
+
+				Convey("it returns the name", func() {
+					So(string(bytes), ShouldEqual, `"CertSign"`)
+				})
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("on a combination of values", func() {
+
+				_, err := json.Marshal(KeyUsage(x509.KeyUsageCertSign | x509.KeyUsageCRLSign))
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey(".UnmarshalJSON is invoked", func() {
+
+			Convey("on a valid name of any case", func() {
+
+				var usage KeyUsage
+				err := json.Unmarshal([]byte(`"digitalsignature"`), &usage)
+
+				Convey("it returns the key usage", func() {
+					So(usage, ShouldEqual, KeyUsage(x509.KeyUsageDigitalSignature))
+				})
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("on an invalid name", func() {
+
+				var usage KeyUsage
+				err := json.Unmarshal([]byte(`"Invalid"`), &usage)
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+
+				Convey("it returns a zero key usage", func() {
+					So(usage, ShouldBeZeroValue)
+				})
+			})
+		})
+
+		Convey(".MarshalYAML and .UnmarshalYAML are invoked", func() {
+
+			for usage := range keyUsages {
+
+				var actual KeyUsage
+
+				bytes, err := yaml.Marshal(usage)
+				So(err, ShouldBeNil)
+
+				err = yaml.Unmarshal(bytes, &actual)
+				So(err, ShouldBeNil)
+
+				So(actual, ShouldEqual, usage)
+			}
+		})
+
+		Convey("#StringToKeyUsage is invoked", func() {
+
+			var actual []KeyUsage
+
+			decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{DecodeHook: StringToKeyUsage(), Result: &actual})
+			if err != nil {
+				t.Fatalf("error initializing decoder [%s]", err.Error())
+			}
+
+			Convey("with valid names", func() {
+
+				err := decoder.Decode([]string{"KeyEncipherment", "CRLSign"})
+
+				Convey("it returns the key usages", func() {
+					So(actual, ShouldResemble, []KeyUsage{KeyUsage(x509.KeyUsageKeyEncipherment), KeyUsage(x509.KeyUsageCRLSign)})
+				})
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("with an invalid name", func() {
+
+				err := decoder.Decode([]string{"Invalid"})
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey("#KeyUsageNames is invoked", func() {
+
+			names := KeyUsageNames(x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign)
+
+			Convey("it returns the names of the bits in order", func() {
+				So(names, ShouldResemble, []string{"DigitalSignature", "CertSign", "CRLSign"})
+			})
+
+			Convey("with no bits", func() {
+
+				Convey("it returns no names", func() {
+					So(KeyUsageNames(0), ShouldBeEmpty)
+				})
+			})
+		})
+	})
+
+	Convey("When ExtKeyUsage", t, func() {
+
+		Convey(".MarshalJSON and .UnmarshalJSON are invoked", func() {
+
+			for usage := range extKeyUsages {
+
+				var actual ExtKeyUsage
+
+				bytes, err := json.Marshal(usage)
+				So(err, ShouldBeNil)
+
+				err = json.Unmarshal(bytes, &actual)
+				So(err, ShouldBeNil)
+
+				So(actual, ShouldEqual, usage)
+			}
+		})
+
+		Convey(".UnmarshalYAML is invoked", func() {
+
+			Convey("on an invalid type", func() {
+
+				var usage ExtKeyUsage
+				err := yaml.Unmarshal([]byte("[]"), &usage)
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("on a valid name", func() {
+
+				var usage ExtKeyUsage
+				err := yaml.Unmarshal([]byte("ServerAuth"), &usage)
+
+				Convey("it returns the extended key usage", func() {
+					So(usage, ShouldEqual, ExtKeyUsage(x509.ExtKeyUsageServerAuth))
+				})
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+		})
+
+		Convey(".ToString is invoked on an invalid value", func() {
+
+			_, err := ExtKeyUsage(-1).ToString()
+
+			Convey("it returns a non-nil error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("#StringToExtKeyUsage is invoked", func() {
+
+			var actual ExtKeyUsage
+
+			decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{DecodeHook: StringToExtKeyUsage(), Result: &actual})
+			if err != nil {
+				t.Fatalf("error initializing decoder [%s]", err.Error())
+			}
+
+			err = decoder.Decode("ClientAuth")
+
+			Convey("it returns the extended key usage", func() {
+				So(actual, ShouldEqual, ExtKeyUsage(x509.ExtKeyUsageClientAuth))
+			})
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
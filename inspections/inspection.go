@@ -0,0 +1,590 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package inspections provides human readable and structured descriptions of certificates, chains and certificate
+// signing requests.
+package inspections
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/deciphernow/nautls/identities"
+	"github.com/deciphernow/nautls/internal/urls"
+	"github.com/pkg/errors"
+)
+
+var (
+	// extensionNames defines the names of well known X.509 extensions.
+	extensionNames = map[string]string{
+		"1.3.6.1.4.1.11129.2.4.2": "Signed Certificate Timestamps",
+		"1.3.6.1.5.5.7.1.1":       "Authority Information Access",
+		"1.3.6.1.5.5.7.1.24":      "TLS Feature",
+		"1.3.6.1.5.5.7.48.1.5":    "OCSP No Check",
+		"2.5.29.14":               "Subject Key Identifier",
+		"2.5.29.15":               "Key Usage",
+		"2.5.29.17":               "Subject Alternative Name",
+		"2.5.29.19":               "Basic Constraints",
+		"2.5.29.30":               "Name Constraints",
+		"2.5.29.31":               "CRL Distribution Points",
+		"2.5.29.32":               "Certificate Policies",
+		"2.5.29.35":               "Authority Key Identifier",
+		"2.5.29.37":               "Extended Key Usage",
+	}
+)
+
+// Inspection describes a collection of certificates and certificate signing requests.
+type Inspection struct {
+
+	// Certificates defines the descriptions of the certificates in the order they were loaded.
+	Certificates []Certificate `json:"certificates"`
+
+	// Chain defines the indices of the certificates that form the preferred chain from the leaf (i.e., the first
+	// certificate that did not issue another certificate) toward a root (see identities.BuildChains).
+	Chain []int `json:"chain"`
+
+	// Requests defines the descriptions of the certificate signing requests in the order they were loaded.
+	Requests []Request `json:"requests"`
+}
+
+// Certificate describes a certificate.
+type Certificate struct {
+	Subject                string       `json:"subject"`
+	Issuer                 string       `json:"issuer"`
+	SerialNumber           string       `json:"serial_number"`
+	NotBefore              time.Time    `json:"not_before"`
+	NotAfter               time.Time    `json:"not_after"`
+	Status                 string       `json:"status"`
+	Names                  Names        `json:"names"`
+	Key                    Key          `json:"key"`
+	SignatureAlgorithm     string       `json:"signature_algorithm"`
+	IsCA                   bool         `json:"is_ca"`
+	MaxPathLen             *int         `json:"max_path_len,omitempty"`
+	KeyUsages              []string     `json:"key_usages,omitempty"`
+	ExtKeyUsages           []string     `json:"ext_key_usages,omitempty"`
+	SubjectKeyID           string       `json:"subject_key_id,omitempty"`
+	AuthorityKeyID         string       `json:"authority_key_id,omitempty"`
+	CRLDistributionPoints  []string     `json:"crl_distribution_points,omitempty"`
+	OCSPServers            []string     `json:"ocsp_servers,omitempty"`
+	IssuingCertificateURLs []string     `json:"issuing_certificate_urls,omitempty"`
+	Extensions             []Extension  `json:"extensions,omitempty"`
+	Fingerprints           Fingerprints `json:"fingerprints"`
+	SelfSigned             bool         `json:"self_signed"`
+	IssuedBy               *int         `json:"issued_by,omitempty"`
+}
+
+// Request describes a certificate signing request.
+type Request struct {
+	Subject            string       `json:"subject"`
+	Names              Names        `json:"names"`
+	Key                Key          `json:"key"`
+	SignatureAlgorithm string       `json:"signature_algorithm"`
+	SignatureValid     bool         `json:"signature_valid"`
+	Extensions         []Extension  `json:"extensions,omitempty"`
+	Fingerprints       Fingerprints `json:"fingerprints"`
+}
+
+// Names describes the subject alternative names of a certificate or certificate signing request.
+type Names struct {
+	DNSNames       []string `json:"dns_names,omitempty"`
+	EmailAddresses []string `json:"email_addresses,omitempty"`
+	IPAddresses    []string `json:"ip_addresses,omitempty"`
+	URIs           []string `json:"uris,omitempty"`
+}
+
+// Key describes a public key by its algorithm (i.e., "RSA", "ECDSA" or "Ed25519") and size in bits.
+type Key struct {
+	Algorithm string `json:"algorithm"`
+	Size      int    `json:"size"`
+	Curve     string `json:"curve,omitempty"`
+}
+
+// Extension describes an extension by its object identifier, name (if well known) and criticality.
+type Extension struct {
+	ID       string `json:"id"`
+	Name     string `json:"name,omitempty"`
+	Critical bool   `json:"critical"`
+}
+
+// Fingerprints describes the SHA-256 fingerprint of a certificate as colon separated hex and the SHA-256 hash of the
+// subject public key info as base64 (i.e., the format of HTTP public key pins).
+type Fingerprints struct {
+	SHA256     string `json:"sha256,omitempty"`
+	SPKISHA256 string `json:"spki_sha256"`
+}
+
+// Inspect loads and describes the certificates and certificate signing requests from a URL that points to the location
+// of PEM or DER encoded values.
+//
+// Note that in addition to those schemes supported by [getter](https://godoc.org/github.com/hashicorp/go-getter) a
+// "base64" scheme is supported for providing the values in the path of the URL directly. This is most applicable when
+// the values must be provided via an environement variable.
+func Inspect(resource string) (*Inspection, error) {
+
+	parsed, err := url.Parse(resource)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing url from [%s]", resource)
+	}
+
+	bytes, err := urls.ReadFile(parsed)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading resource from [%s]", resource)
+	}
+
+	inspection, err := InspectBytes(bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error inspecting [%s]", resource)
+	}
+
+	return inspection, nil
+}
+
+// InspectBytes describes the certificates and certificate signing requests of PEM blocks or, if there are no PEM
+// blocks, of DER encoded certificates or a certificate signing request. PEM blocks of other types (e.g., keys) are
+// ignored and an error is returned if there are no certificate or certificate signing request blocks.
+func InspectBytes(data []byte) (*Inspection, error) {
+
+	var certificates []*x509.Certificate
+	var requests []*x509.CertificateRequest
+
+	block, rest := pem.Decode(data)
+	if block == nil {
+
+		parsed, err := x509.ParseCertificates(data)
+		if err == nil {
+			return NewInspection(parsed, nil), nil
+		}
+
+		request, err := x509.ParseCertificateRequest(data)
+		if err != nil {
+			return nil, errors.New("error decoding certificates or certificate requests")
+		}
+
+		return NewInspection(nil, []*x509.CertificateRequest{request}), nil
+	}
+
+	for block != nil {
+
+		switch block.Type {
+		case "CERTIFICATE":
+			certificate, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, errors.Wrap(err, "error parsing certificate")
+			}
+			certificates = append(certificates, certificate)
+		case "CERTIFICATE REQUEST", "NEW CERTIFICATE REQUEST":
+			request, err := x509.ParseCertificateRequest(block.Bytes)
+			if err != nil {
+				return nil, errors.Wrap(err, "error parsing certificate request")
+			}
+			requests = append(requests, request)
+		}
+
+		block, rest = pem.Decode(rest)
+	}
+
+	if len(certificates) == 0 && len(requests) == 0 {
+		return nil, errors.New("error decoding pem blocks without certificates or certificate requests")
+	}
+
+	return NewInspection(certificates, requests), nil
+}
+
+// NewInspection describes certificates, including the chain relationships between them, and certificate signing
+// requests at the current time.
+func NewInspection(certificates []*x509.Certificate, requests []*x509.CertificateRequest) *Inspection {
+
+	inspection := &Inspection{Certificates: []Certificate{}, Chain: []int{}, Requests: []Request{}}
+	now := time.Now()
+
+	for _, certificate := range certificates {
+		inspection.Certificates = append(inspection.Certificates, describeCertificate(certificate, certificates, now))
+	}
+
+	if leaf := findLeaf(certificates); leaf != nil {
+		for _, certificate := range identities.BuildChains(leaf, certificates)[0] {
+			inspection.Chain = append(inspection.Chain, indexOf(certificates, certificate))
+		}
+	}
+
+	for _, request := range requests {
+		inspection.Requests = append(inspection.Requests, describeRequest(request))
+	}
+
+	return inspection
+}
+
+// JSON returns the inspection as indented JSON.
+func (i *Inspection) JSON() ([]byte, error) {
+
+	bytes, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshalling inspection")
+	}
+
+	return bytes, nil
+}
+
+// Text returns the inspection as human readable text similar to that of "openssl x509 -text".
+func (i *Inspection) Text() string {
+
+	var builder strings.Builder
+
+	line := func(indent int, format string, arguments ...interface{}) {
+		builder.WriteString(strings.Repeat("    ", indent))
+		builder.WriteString(fmt.Sprintf(format, arguments...))
+		builder.WriteString("\n")
+	}
+
+	list := func(indent int, label string, values []string) {
+		if len(values) > 0 {
+			line(indent, "%s: %s", label, strings.Join(values, ", "))
+		}
+	}
+
+	for index, certificate := range i.Certificates {
+
+		line(0, "Certificate [%d]:", index)
+		line(1, "Subject: %s", certificate.Subject)
+		line(1, "Issuer: %s", certificate.Issuer)
+		line(1, "Serial Number: %s", certificate.SerialNumber)
+		line(1, "Validity: %s", certificate.Status)
+		line(2, "Not Before: %s", certificate.NotBefore.Format(time.RFC3339))
+		line(2, "Not After: %s", certificate.NotAfter.Format(time.RFC3339))
+		writeKey(line, certificate.Key)
+		line(1, "Signature Algorithm: %s", certificate.SignatureAlgorithm)
+		writeNames(line, certificate.Names)
+
+		if certificate.MaxPathLen != nil {
+			line(1, "Basic Constraints: CA=%t, MaxPathLen=%d", certificate.IsCA, *certificate.MaxPathLen)
+		} else {
+			line(1, "Basic Constraints: CA=%t", certificate.IsCA)
+		}
+
+		list(1, "Key Usage", certificate.KeyUsages)
+		list(1, "Extended Key Usage", certificate.ExtKeyUsages)
+
+		if certificate.SubjectKeyID != "" {
+			line(1, "Subject Key ID: %s", certificate.SubjectKeyID)
+		}
+
+		if certificate.AuthorityKeyID != "" {
+			line(1, "Authority Key ID: %s", certificate.AuthorityKeyID)
+		}
+
+		list(1, "CRL Distribution Points", certificate.CRLDistributionPoints)
+		list(1, "OCSP Servers", certificate.OCSPServers)
+		list(1, "Issuing Certificate URLs", certificate.IssuingCertificateURLs)
+		writeExtensions(line, certificate.Extensions)
+		line(1, "Fingerprints:")
+		line(2, "SHA-256: %s", certificate.Fingerprints.SHA256)
+		line(2, "SPKI SHA-256: %s", certificate.Fingerprints.SPKISHA256)
+
+		switch {
+		case certificate.SelfSigned:
+			line(1, "Issued By: self signed")
+		case certificate.IssuedBy != nil:
+			line(1, "Issued By: [%d]", *certificate.IssuedBy)
+		default:
+			line(1, "Issued By: not present")
+		}
+	}
+
+	if len(i.Chain) > 0 {
+
+		links := make([]string, len(i.Chain))
+		for index, certificate := range i.Chain {
+			links[index] = fmt.Sprintf("[%d] %s", certificate, i.Certificates[certificate].Subject)
+		}
+
+		line(0, "Chain: %s", strings.Join(links, " -> "))
+	}
+
+	for index, request := range i.Requests {
+
+		line(0, "Certificate Request [%d]:", index)
+		line(1, "Subject: %s", request.Subject)
+		writeKey(line, request.Key)
+		line(1, "Signature Algorithm: %s", request.SignatureAlgorithm)
+		line(1, "Signature Valid: %t", request.SignatureValid)
+		writeNames(line, request.Names)
+		writeExtensions(line, request.Extensions)
+		line(1, "Fingerprints:")
+		line(2, "SPKI SHA-256: %s", request.Fingerprints.SPKISHA256)
+	}
+
+	return builder.String()
+}
+
+// describeCertificate returns the description of a certificate loaded with other certificates at a point in time.
+func describeCertificate(certificate *x509.Certificate, certificates []*x509.Certificate, now time.Time) Certificate {
+
+	fingerprint := sha256.Sum256(certificate.Raw)
+
+	description := Certificate{
+		AuthorityKeyID:         colonHex(certificate.AuthorityKeyId),
+		CRLDistributionPoints:  certificate.CRLDistributionPoints,
+		Extensions:             describeExtensions(certificate.Extensions),
+		ExtKeyUsages:           extKeyUsageNames(certificate.ExtKeyUsage, certificate.UnknownExtKeyUsage),
+		Fingerprints:           Fingerprints{SHA256: colonHex(fingerprint[:]), SPKISHA256: spkiFingerprint(certificate.RawSubjectPublicKeyInfo)},
+		IsCA:                   certificate.IsCA,
+		Issuer:                 certificate.Issuer.String(),
+		IssuingCertificateURLs: certificate.IssuingCertificateURL,
+		Key:                    describeKey(certificate.PublicKey),
+		KeyUsages:              identities.KeyUsageNames(certificate.KeyUsage),
+		Names:                  describeNames(certificate.DNSNames, certificate.EmailAddresses, certificate.IPAddresses, certificate.URIs),
+		NotAfter:               certificate.NotAfter.UTC(),
+		NotBefore:              certificate.NotBefore.UTC(),
+		OCSPServers:            certificate.OCSPServer,
+		SelfSigned:             identities.IsSelfSigned(certificate),
+		SerialNumber:           colonHex(certificate.SerialNumber.Bytes()),
+		SignatureAlgorithm:     certificate.SignatureAlgorithm.String(),
+		Status:                 "valid",
+		Subject:                certificate.Subject.String(),
+		SubjectKeyID:           colonHex(certificate.SubjectKeyId),
+	}
+
+	if now.Before(certificate.NotBefore) {
+		description.Status = "not yet valid"
+	} else if now.After(certificate.NotAfter) {
+		description.Status = "expired"
+	}
+
+	if certificate.IsCA && (certificate.MaxPathLen > 0 || certificate.MaxPathLenZero) {
+		length := certificate.MaxPathLen
+		description.MaxPathLen = &length
+	}
+
+	if !description.SelfSigned {
+		for index, candidate := range certificates {
+			if candidate != certificate && identities.IssuedBy(certificate, candidate) {
+				issuer := index
+				description.IssuedBy = &issuer
+				break
+			}
+		}
+	}
+
+	return description
+}
+
+// describeRequest returns the description of a certificate signing request.
+func describeRequest(request *x509.CertificateRequest) Request {
+	return Request{
+		Extensions:         describeExtensions(request.Extensions),
+		Fingerprints:       Fingerprints{SPKISHA256: spkiFingerprint(request.RawSubjectPublicKeyInfo)},
+		Key:                describeKey(request.PublicKey),
+		Names:              describeNames(request.DNSNames, request.EmailAddresses, request.IPAddresses, request.URIs),
+		SignatureAlgorithm: request.SignatureAlgorithm.String(),
+		SignatureValid:     request.CheckSignature() == nil,
+		Subject:            request.Subject.String(),
+	}
+}
+
+// describeKey returns the description of a public key.
+func describeKey(key interface{}) Key {
+
+	switch public := key.(type) {
+	case *rsa.PublicKey:
+		return Key{Algorithm: "RSA", Size: public.N.BitLen()}
+	case *ecdsa.PublicKey:
+		return Key{Algorithm: "ECDSA", Size: public.Curve.Params().BitSize, Curve: public.Curve.Params().Name}
+	case ed25519.PublicKey:
+		return Key{Algorithm: "Ed25519", Size: 256}
+	default:
+		return Key{Algorithm: fmt.Sprintf("%T", key)}
+	}
+}
+
+// describeNames returns the description of subject alternative names.
+func describeNames(dnsNames []string, emailAddresses []string, ipAddresses []net.IP, uris []*url.URL) Names {
+
+	names := Names{DNSNames: dnsNames, EmailAddresses: emailAddresses}
+
+	for _, ip := range ipAddresses {
+		names.IPAddresses = append(names.IPAddresses, ip.String())
+	}
+
+	for _, uri := range uris {
+		names.URIs = append(names.URIs, uri.String())
+	}
+
+	return names
+}
+
+// describeExtensions returns the descriptions of extensions.
+func describeExtensions(extensions []pkix.Extension) []Extension {
+
+	var descriptions []Extension
+
+	for _, extension := range extensions {
+		descriptions = append(descriptions, Extension{
+			Critical: extension.Critical,
+			ID:       extension.Id.String(),
+			Name:     extensionNames[extension.Id.String()],
+		})
+	}
+
+	return descriptions
+}
+
+// extKeyUsageNames returns the names of extended key usages and the object identifiers of unknown extended key usages.
+func extKeyUsageNames(usages []x509.ExtKeyUsage, unknown []asn1.ObjectIdentifier) []string {
+
+	var names []string
+
+	for _, usage := range usages {
+		name, err := identities.ExtKeyUsage(usage).ToString()
+		if err != nil {
+			name = fmt.Sprintf("%d", usage)
+		}
+		names = append(names, name)
+	}
+
+	for _, usage := range unknown {
+		names = append(names, usage.String())
+	}
+
+	return names
+}
+
+// colonHex returns bytes as upper case hex separated by colons (e.g., "AB:CD") or an empty string if there are none.
+func colonHex(value []byte) string {
+
+	octets := make([]string, len(value))
+	for index, octet := range value {
+		octets[index] = strings.ToUpper(hex.EncodeToString([]byte{octet}))
+	}
+
+	return strings.Join(octets, ":")
+}
+
+// spkiFingerprint returns the base64 encoded SHA-256 hash of a subject public key info.
+func spkiFingerprint(spki []byte) string {
+	hash := sha256.Sum256(spki)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// findLeaf returns the first certificate that did not issue any of the other certificates or nil if there are no
+// certificates.
+func findLeaf(certificates []*x509.Certificate) *x509.Certificate {
+
+	for _, candidate := range certificates {
+
+		issuer := false
+		for _, certificate := range certificates {
+			if certificate != candidate && identities.IssuedBy(certificate, candidate) {
+				issuer = true
+				break
+			}
+		}
+
+		if !issuer {
+			return candidate
+		}
+	}
+
+	if len(certificates) > 0 {
+		return certificates[0]
+	}
+
+	return nil
+}
+
+// indexOf returns the index of a certificate in a slice or -1 if it is not present.
+func indexOf(certificates []*x509.Certificate, certificate *x509.Certificate) int {
+
+	for index, candidate := range certificates {
+		if candidate == certificate {
+			return index
+		}
+	}
+
+	return -1
+}
+
+// writeKey writes the description of a public key.
+func writeKey(line func(int, string, ...interface{}), key Key) {
+
+	if key.Curve != "" {
+		line(1, "Public Key: %s %d bit (%s)", key.Algorithm, key.Size, key.Curve)
+		return
+	}
+
+	line(1, "Public Key: %s %d bit", key.Algorithm, key.Size)
+}
+
+// writeNames writes the descriptions of subject alternative names.
+func writeNames(line func(int, string, ...interface{}), names Names) {
+
+	if len(names.DNSNames)+len(names.EmailAddresses)+len(names.IPAddresses)+len(names.URIs) == 0 {
+		return
+	}
+
+	line(1, "Subject Alternative Names:")
+
+	for _, name := range names.DNSNames {
+		line(2, "DNS: %s", name)
+	}
+
+	for _, address := range names.EmailAddresses {
+		line(2, "Email: %s", address)
+	}
+
+	for _, ip := range names.IPAddresses {
+		line(2, "IP: %s", ip)
+	}
+
+	for _, uri := range names.URIs {
+		line(2, "URI: %s", uri)
+	}
+}
+
+// writeExtensions writes the descriptions of extensions.
+func writeExtensions(line func(int, string, ...interface{}), extensions []Extension) {
+
+	if len(extensions) == 0 {
+		return
+	}
+
+	line(1, "Extensions:")
+
+	for _, extension := range extensions {
+
+		name := extension.Name
+		if name == "" {
+			name = "Unknown"
+		}
+
+		if extension.Critical {
+			line(2, "%s %s (critical)", extension.ID, name)
+		} else {
+			line(2, "%s %s", extension.ID, name)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inspections
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/deciphernow/nautls/identities"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestInspection(t *testing.T) {
+
+	Convey("When inspecting", t, func() {
+
+		template, err := identities.RootTemplate(pkix.Name{CommonName: "NauTLS (Root)"})
+		So(err, ShouldBeNil)
+
+		root, err := identities.Self(template, identities.ECDSA, 256)
+		So(err, ShouldBeNil)
+
+		template, err = identities.IntermediateTemplate(pkix.Name{CommonName: "NauTLS (Intermediate)"})
+		So(err, ShouldBeNil)
+
+		intermediate, err := root.Issue(template, identities.ECDSA, 384)
+		So(err, ShouldBeNil)
+
+		template, err = identities.ServerTemplate([]string{"nautls.com"}, []net.IP{net.ParseIP("127.0.0.1")})
+		So(err, ShouldBeNil)
+
+		leaf, err := intermediate.Issue(template, identities.RSA, 2048)
+		So(err, ShouldBeNil)
+
+		key, err := leaf.EncodeKey()
+		So(err, ShouldBeNil)
+
+		request, err := identities.NewRequest(identities.Template{Subject: pkix.Name{CommonName: "api.nautls.com"}, DNSNames: []string{"api.nautls.com"}}, leaf.Key)
+		So(err, ShouldBeNil)
+
+		bundle := append(identities.EncodeCertificates([]*x509.Certificate{root.Certificate, leaf.Certificate, intermediate.Certificate}), key...)
+		bundle = append(bundle, identities.EncodeRequest(request)...)
+
+		Convey("#Inspect is invoked", func() {
+
+			inspection, err := Inspect("base64:///" + url.PathEscape(base64.StdEncoding.EncodeToString(bundle)))
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("it describes the certificates", func() {
+
+				So(inspection.Certificates, ShouldHaveLength, 3)
+
+				described := inspection.Certificates[1]
+				fingerprint := sha256.Sum256(leaf.Certificate.Raw)
+
+				So(described.Subject, ShouldEqual, leaf.Certificate.Subject.String())
+				So(described.Issuer, ShouldEqual, "CN=NauTLS (Intermediate)")
+				So(described.Status, ShouldEqual, "valid")
+				So(described.Names, ShouldResemble, Names{DNSNames: []string{"nautls.com"}, IPAddresses: []string{"127.0.0.1"}})
+				So(described.Key, ShouldResemble, Key{Algorithm: "RSA", Size: 2048})
+				So(described.KeyUsages, ShouldResemble, []string{"DigitalSignature", "KeyEncipherment"})
+				So(described.ExtKeyUsages, ShouldResemble, []string{"ServerAuth"})
+				So(described.Fingerprints.SHA256, ShouldEqual, colonHex(fingerprint[:]))
+				So(described.Fingerprints.SPKISHA256, ShouldEqual, spkiFingerprint(leaf.Certificate.RawSubjectPublicKeyInfo))
+				So(described.Extensions, ShouldContain, Extension{ID: "2.5.29.15", Name: "Key Usage", Critical: true})
+
+				So(inspection.Certificates[2].Key, ShouldResemble, Key{Algorithm: "ECDSA", Size: 384, Curve: "P-384"})
+				So(*inspection.Certificates[2].MaxPathLen, ShouldEqual, 0)
+			})
+
+			Convey("it describes the chain relationships", func() {
+				So(inspection.Chain, ShouldResemble, []int{1, 2, 0})
+				So(inspection.Certificates[0].SelfSigned, ShouldBeTrue)
+				So(inspection.Certificates[0].IssuedBy, ShouldBeNil)
+				So(*inspection.Certificates[1].IssuedBy, ShouldEqual, 2)
+				So(*inspection.Certificates[2].IssuedBy, ShouldEqual, 0)
+			})
+
+			Convey("it describes the requests", func() {
+				So(inspection.Requests, ShouldHaveLength, 1)
+				So(inspection.Requests[0].Subject, ShouldEqual, "CN=api.nautls.com")
+				So(inspection.Requests[0].Names.DNSNames, ShouldResemble, []string{"api.nautls.com"})
+				So(inspection.Requests[0].SignatureValid, ShouldBeTrue)
+			})
+
+			Convey("and .Text is invoked", func() {
+
+				text := inspection.Text()
+
+				Convey("it renders the certificates, chain and requests", func() {
+					So(text, ShouldContainSubstring, "Certificate [1]:\n    Subject: "+leaf.Certificate.Subject.String()+"\n")
+					So(text, ShouldContainSubstring, "        DNS: nautls.com\n")
+					So(text, ShouldContainSubstring, "    Public Key: ECDSA 384 bit (P-384)\n")
+					So(text, ShouldContainSubstring, "    Basic Constraints: CA=true, MaxPathLen=0\n")
+					So(text, ShouldContainSubstring, "    Issued By: self signed\n")
+					So(text, ShouldContainSubstring, "Chain: [1] "+leaf.Certificate.Subject.String()+" -> [2] CN=NauTLS (Intermediate) -> [0] CN=NauTLS (Root)\n")
+					So(text, ShouldContainSubstring, "Certificate Request [0]:\n    Subject: CN=api.nautls.com\n")
+				})
+			})
+
+			Convey("and .JSON is invoked", func() {
+
+				bytes, err := inspection.JSON()
+				So(err, ShouldBeNil)
+
+				var actual Inspection
+				err = json.Unmarshal(bytes, &actual)
+
+				Convey("it returns the inspection as json", func() {
+					So(err, ShouldBeNil)
+					So(actual, ShouldResemble, *inspection)
+				})
+			})
+		})
+
+		Convey("#InspectBytes is invoked", func() {
+
+			Convey("with der encoded certificates", func() {
+
+				inspection, err := InspectBytes(append(append([]byte{}, leaf.Certificate.Raw...), intermediate.Certificate.Raw...))
+
+				Convey("it describes the certificates", func() {
+					So(err, ShouldBeNil)
+					So(inspection.Certificates, ShouldHaveLength, 2)
+					So(inspection.Chain, ShouldResemble, []int{0, 1})
+				})
+			})
+
+			Convey("with a der encoded request", func() {
+
+				inspection, err := InspectBytes(request.Raw)
+
+				Convey("it describes the request", func() {
+					So(err, ShouldBeNil)
+					So(inspection.Certificates, ShouldBeEmpty)
+					So(inspection.Requests, ShouldHaveLength, 1)
+				})
+			})
+
+			Convey("with pem blocks without certificates or requests", func() {
+
+				_, err := InspectBytes(key)
+
+				Convey("it returns an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("with invalid data", func() {
+
+				_, err := InspectBytes([]byte("invalid"))
+
+				Convey("it returns an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,604 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package acmetest provides an in-process ACME (RFC 8555) directory for testing ACME clients.
+package acmetest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deciphernow/nautls/identities"
+	"github.com/pkg/errors"
+)
+
+var (
+	// oidACMEIdentifier defines the id-pe-acmeIdentifier extension of RFC 8737 section 3.
+	oidACMEIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+)
+
+// Server represents an in-process ACME directory served over TLS. The signatures of requests are not verified but the
+// challenges of an order are validated against the addresses of the server under test before certificates are issued
+// by the authority of the directory.
+type Server struct {
+	*httptest.Server
+
+	// Challenges defines the challenge types offered for each authorization. If empty both "tls-alpn-01" and "http-01"
+	// are offered.
+	Challenges []string
+
+	// HTTPAddress defines the address (i.e., host and port) against which HTTP-01 challenges are validated.
+	HTTPAddress string
+
+	// TLSAddress defines the address (i.e., host and port) against which TLS-ALPN-01 challenges are validated.
+	TLSAddress string
+
+	authority      *identities.Identity
+	accounts       []string
+	authorizations []*authorization
+	challenges     []*challenge
+	mutex          sync.Mutex
+	nonce          int
+	orders         []*order
+}
+
+type identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type order struct {
+	Authorizations []string     `json:"authorizations"`
+	Certificate    string       `json:"certificate,omitempty"`
+	Finalize       string       `json:"finalize"`
+	Identifiers    []identifier `json:"identifiers"`
+	Status         string       `json:"status"`
+
+	chain []byte
+	url   string
+}
+
+type authorization struct {
+	Challenges []*challenge `json:"challenges"`
+	Identifier identifier   `json:"identifier"`
+	Status     string       `json:"status"`
+
+	order *order
+}
+
+type challenge struct {
+	Status string `json:"status"`
+	Token  string `json:"token"`
+	Type   string `json:"type"`
+	URL    string `json:"url"`
+
+	authorization *authorization
+}
+
+// request represents the decoded protected header and payload of a JWS request.
+type request struct {
+	JWK     map[string]string `json:"jwk"`
+	KeyID   string            `json:"kid"`
+	payload []byte
+}
+
+// NewServer starts and returns a new ACME directory that issues certificates from the authority. The server must be
+// closed when no longer needed.
+func NewServer(authority *identities.Identity) *Server {
+
+	server := &Server{authority: authority}
+	server.Server = httptest.NewTLSServer(http.HandlerFunc(server.serve))
+
+	return server
+}
+
+// DirectoryURL returns the URL of the directory.
+func (s *Server) DirectoryURL() string {
+	return s.URL + "/directory"
+}
+
+// AuthorityURL returns a base64 URL of the certificate of the directory suitable for trusting the directory.
+func (s *Server) AuthorityURL() string {
+	encoded := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+	return "base64:///" + url.PathEscape(base64.StdEncoding.EncodeToString(encoded))
+}
+
+// serve routes the requests of the directory.
+func (s *Server) serve(writer http.ResponseWriter, r *http.Request) {
+
+	s.mutex.Lock()
+	s.nonce++
+	writer.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", s.nonce))
+	s.mutex.Unlock()
+
+	switch {
+	case r.URL.Path == "/directory":
+		s.writeJSON(writer, http.StatusOK, map[string]string{
+			"keyChange":  s.URL + "/key-change",
+			"newAccount": s.URL + "/new-account",
+			"newNonce":   s.URL + "/new-nonce",
+			"newOrder":   s.URL + "/new-order",
+			"revokeCert": s.URL + "/revoke-cert",
+		})
+	case r.URL.Path == "/new-nonce":
+		writer.WriteHeader(http.StatusOK)
+	case r.URL.Path == "/new-account":
+		s.serveAccount(writer, r)
+	case r.URL.Path == "/new-order":
+		s.serveNewOrder(writer, r)
+	case strings.HasPrefix(r.URL.Path, "/orders/"):
+		s.serveOrder(writer, r)
+	case strings.HasPrefix(r.URL.Path, "/authorizations/"):
+		s.serveAuthorization(writer, r)
+	case strings.HasPrefix(r.URL.Path, "/challenges/"):
+		s.serveChallenge(writer, r)
+	case strings.HasPrefix(r.URL.Path, "/finalize/"):
+		s.serveFinalize(writer, r)
+	case strings.HasPrefix(r.URL.Path, "/certificates/"):
+		s.serveCertificate(writer, r)
+	default:
+		s.writeError(writer, http.StatusNotFound, "malformed", "unknown resource")
+	}
+}
+
+// serveAccount registers an account recording the thumbprint of its key.
+func (s *Server) serveAccount(writer http.ResponseWriter, r *http.Request) {
+
+	request, err := decode(r)
+	if err != nil {
+		s.writeError(writer, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+
+	thumbprint, err := thumbprint(request.JWK)
+	if err != nil {
+		s.writeError(writer, http.StatusBadRequest, "badPublicKey", err.Error())
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	status := http.StatusCreated
+	index := indexOf(s.accounts, thumbprint)
+	if index < 0 {
+		s.accounts = append(s.accounts, thumbprint)
+		index = len(s.accounts) - 1
+	} else {
+		status = http.StatusOK
+	}
+
+	writer.Header().Set("Location", fmt.Sprintf("%s/accounts/%d", s.URL, index))
+	s.writeJSON(writer, status, map[string]string{"status": "valid"})
+}
+
+// serveNewOrder creates an order with an authorization for each identifier.
+func (s *Server) serveNewOrder(writer http.ResponseWriter, r *http.Request) {
+
+	request, err := decode(r)
+	if err != nil {
+		s.writeError(writer, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+
+	var payload struct {
+		Identifiers []identifier `json:"identifiers"`
+	}
+
+	if err := json.Unmarshal(request.payload, &payload); err != nil {
+		s.writeError(writer, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	order := &order{Identifiers: payload.Identifiers, Status: "pending"}
+	order.url = fmt.Sprintf("%s/orders/%d", s.URL, len(s.orders))
+	order.Finalize = fmt.Sprintf("%s/finalize/%d", s.URL, len(s.orders))
+	s.orders = append(s.orders, order)
+
+	types := s.Challenges
+	if len(types) == 0 {
+		types = []string{"tls-alpn-01", "http-01"}
+	}
+
+	for _, identifier := range payload.Identifiers {
+
+		authorization := &authorization{Identifier: identifier, Status: "pending", order: order}
+		order.Authorizations = append(order.Authorizations, fmt.Sprintf("%s/authorizations/%d", s.URL, len(s.authorizations)))
+		s.authorizations = append(s.authorizations, authorization)
+
+		for _, tipe := range types {
+			challenge := &challenge{
+				Status:        "pending",
+				Token:         fmt.Sprintf("token-%d-%d", time.Now().UnixNano(), len(s.challenges)),
+				Type:          tipe,
+				URL:           fmt.Sprintf("%s/challenges/%d", s.URL, len(s.challenges)),
+				authorization: authorization,
+			}
+			authorization.Challenges = append(authorization.Challenges, challenge)
+			s.challenges = append(s.challenges, challenge)
+		}
+	}
+
+	writer.Header().Set("Location", order.url)
+	s.writeJSON(writer, http.StatusCreated, order)
+}
+
+// serveOrder returns an order.
+func (s *Server) serveOrder(writer http.ResponseWriter, r *http.Request) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	index, ok := resource(r, "/orders/", len(s.orders))
+	if !ok {
+		s.writeError(writer, http.StatusNotFound, "malformed", "unknown order")
+		return
+	}
+
+	writer.Header().Set("Location", s.orders[index].url)
+	s.writeJSON(writer, http.StatusOK, s.orders[index])
+}
+
+// serveAuthorization returns or deactivates an authorization.
+func (s *Server) serveAuthorization(writer http.ResponseWriter, r *http.Request) {
+
+	request, err := decode(r)
+	if err != nil {
+		s.writeError(writer, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	index, ok := resource(r, "/authorizations/", len(s.authorizations))
+	if !ok {
+		s.writeError(writer, http.StatusNotFound, "malformed", "unknown authorization")
+		return
+	}
+
+	authorization := s.authorizations[index]
+
+	if bytes.Contains(request.payload, []byte("deactivated")) {
+		authorization.Status = "deactivated"
+	}
+
+	s.writeJSON(writer, http.StatusOK, authorization)
+}
+
+// serveChallenge validates a challenge against the server under test and updates the authorization and order.
+func (s *Server) serveChallenge(writer http.ResponseWriter, r *http.Request) {
+
+	request, err := decode(r)
+	if err != nil {
+		s.writeError(writer, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+
+	s.mutex.Lock()
+
+	index, ok := resource(r, "/challenges/", len(s.challenges))
+	if !ok {
+		s.mutex.Unlock()
+		s.writeError(writer, http.StatusNotFound, "malformed", "unknown challenge")
+		return
+	}
+
+	account, ok := resource(&http.Request{URL: &url.URL{Path: strings.TrimPrefix(request.KeyID, s.URL)}}, "/accounts/", len(s.accounts))
+	if !ok {
+		s.mutex.Unlock()
+		s.writeError(writer, http.StatusUnauthorized, "accountDoesNotExist", "unknown account")
+		return
+	}
+
+	challenge := s.challenges[index]
+	authorization := fmt.Sprintf("%s.%s", challenge.Token, s.accounts[account])
+	domain := challenge.authorization.Identifier.Value
+
+	s.mutex.Unlock()
+
+	var validationErr error
+	switch challenge.Type {
+	case "tls-alpn-01":
+		validationErr = validateTLSALPN(s.TLSAddress, domain, authorization)
+	case "http-01":
+		validationErr = validateHTTP(s.HTTPAddress, domain, challenge.Token, authorization)
+	default:
+		validationErr = fmt.Errorf("unsupported challenge type [%s]", challenge.Type)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	challenge.Status = "valid"
+	challenge.authorization.Status = "valid"
+
+	if validationErr != nil {
+		challenge.Status = "invalid"
+		challenge.authorization.Status = "invalid"
+		challenge.authorization.order.Status = "invalid"
+	} else if challenge.authorization.order.Status == "pending" && s.authorized(challenge.authorization.order) {
+		challenge.authorization.order.Status = "ready"
+	}
+
+	s.writeJSON(writer, http.StatusOK, challenge)
+}
+
+// serveFinalize issues the certificate of an order from a certificate signing request.
+func (s *Server) serveFinalize(writer http.ResponseWriter, r *http.Request) {
+
+	request, err := decode(r)
+	if err != nil {
+		s.writeError(writer, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+
+	var payload struct {
+		CSR string `json:"csr"`
+	}
+
+	if err := json.Unmarshal(request.payload, &payload); err != nil {
+		s.writeError(writer, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+
+	der, err := base64.RawURLEncoding.DecodeString(payload.CSR)
+	if err != nil {
+		s.writeError(writer, http.StatusBadRequest, "badCSR", err.Error())
+		return
+	}
+
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		s.writeError(writer, http.StatusBadRequest, "badCSR", err.Error())
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	index, ok := resource(r, "/finalize/", len(s.orders))
+	if !ok {
+		s.writeError(writer, http.StatusNotFound, "malformed", "unknown order")
+		return
+	}
+
+	order := s.orders[index]
+	if order.Status != "ready" {
+		s.writeError(writer, http.StatusForbidden, "orderNotReady", fmt.Sprintf("order is [%s]", order.Status))
+		return
+	}
+
+	var names []string
+	for _, identifier := range order.Identifiers {
+		names = append(names, identifier.Value)
+	}
+
+	template, err := identities.ServerTemplate(names, nil)
+	if err != nil {
+		s.writeError(writer, http.StatusBadRequest, "badCSR", err.Error())
+		return
+	}
+
+	certificate, err := s.authority.SignRequest(csr, template)
+	if err != nil {
+		s.writeError(writer, http.StatusBadRequest, "badCSR", err.Error())
+		return
+	}
+
+	order.chain = identities.EncodeCertificates([]*x509.Certificate{certificate, s.authority.Certificate})
+	order.Certificate = fmt.Sprintf("%s/certificates/%d", s.URL, index)
+	order.Status = "valid"
+
+	writer.Header().Set("Location", order.url)
+	s.writeJSON(writer, http.StatusOK, order)
+}
+
+// serveCertificate returns the PEM encoded certificate chain of an order.
+func (s *Server) serveCertificate(writer http.ResponseWriter, r *http.Request) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	index, ok := resource(r, "/certificates/", len(s.orders))
+	if !ok || s.orders[index].chain == nil {
+		s.writeError(writer, http.StatusNotFound, "malformed", "unknown certificate")
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/pem-certificate-chain")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(s.orders[index].chain)
+}
+
+// authorized returns a value indicating whether every authorization of an order is valid.
+func (s *Server) authorized(order *order) bool {
+
+	for _, authorization := range s.authorizations {
+		if authorization.order == order && authorization.Status != "valid" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// writeJSON writes a JSON response.
+func (s *Server) writeJSON(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(value)
+}
+
+// writeError writes an ACME problem document.
+func (s *Server) writeError(writer http.ResponseWriter, status int, tipe string, detail string) {
+	writer.Header().Set("Content-Type", "application/problem+json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(map[string]string{"type": "urn:ietf:params:acme:error:" + tipe, "detail": detail})
+}
+
+// decode decodes the protected header and payload of a flattened JWS request without verifying its signature.
+func decode(r *http.Request) (*request, error) {
+
+	var jws struct {
+		Payload   string `json:"payload"`
+		Protected string `json:"protected"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		return nil, errors.Wrap(err, "error decoding jws")
+	}
+
+	protected, err := base64.RawURLEncoding.DecodeString(jws.Protected)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding jws protected header")
+	}
+
+	var decoded request
+	if err := json.Unmarshal(protected, &decoded); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling jws protected header")
+	}
+
+	decoded.payload, err = base64.RawURLEncoding.DecodeString(jws.Payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding jws payload")
+	}
+
+	return &decoded, nil
+}
+
+// thumbprint returns the RFC 7638 thumbprint of an ECDSA or RSA JSON web key.
+func thumbprint(jwk map[string]string) (string, error) {
+
+	var canonical string
+
+	switch jwk["kty"] {
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`, jwk["crv"], jwk["x"], jwk["y"])
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, jwk["e"], jwk["n"])
+	default:
+		return "", fmt.Errorf("unsupported key type [%s]", jwk["kty"])
+	}
+
+	digest := sha256.Sum256([]byte(canonical))
+
+	return base64.RawURLEncoding.EncodeToString(digest[:]), nil
+}
+
+// validateTLSALPN validates a TLS-ALPN-01 challenge (see RFC 8737) for a domain against an address.
+func validateTLSALPN(address string, domain string, authorization string) error {
+
+	connection, err := tls.Dial("tcp", address, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"acme-tls/1"}, ServerName: domain})
+	if err != nil {
+		return errors.Wrapf(err, "error connecting to [%s]", address)
+	}
+	defer connection.Close()
+
+	state := connection.ConnectionState()
+	if state.NegotiatedProtocol != "acme-tls/1" {
+		return fmt.Errorf("unexpected protocol [%s] negotiated by [%s]", state.NegotiatedProtocol, address)
+	}
+
+	expected := sha256.Sum256([]byte(authorization))
+
+	for _, extension := range state.PeerCertificates[0].Extensions {
+
+		if !extension.Id.Equal(oidACMEIdentifier) {
+			continue
+		}
+
+		var actual []byte
+		if _, err := asn1.Unmarshal(extension.Value, &actual); err != nil {
+			return errors.Wrap(err, "error unmarshalling acme identifier")
+		}
+
+		if !bytes.Equal(actual, expected[:]) {
+			return errors.New("unexpected acme identifier")
+		}
+
+		return nil
+	}
+
+	return errors.New("missing acme identifier")
+}
+
+// validateHTTP validates an HTTP-01 challenge (see RFC 8555 section 8.3) for a domain against an address.
+func validateHTTP(address string, domain string, token string, authorization string) error {
+
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s/.well-known/acme-challenge/%s", address, token), nil)
+	if err != nil {
+		return errors.Wrap(err, "error creating challenge request")
+	}
+
+	request.Host = domain
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return errors.Wrapf(err, "error requesting challenge from [%s]", address)
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return errors.Wrap(err, "error reading challenge response")
+	}
+
+	if strings.TrimSpace(string(body)) != authorization {
+		return fmt.Errorf("unexpected challenge response [%s]", body)
+	}
+
+	return nil
+}
+
+// resource returns the index of the resource identified by the path of a request with the provided prefix.
+func resource(r *http.Request, prefix string, count int) (int, bool) {
+
+	index, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, prefix))
+	if err != nil || index < 0 || index >= count {
+		return 0, false
+	}
+
+	return index, true
+}
+
+// indexOf returns the index of a value in a slice or -1 if the slice does not contain the value.
+func indexOf(values []string, value string) int {
+
+	for index, candidate := range values {
+		if candidate == value {
+			return index
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package identitytest provides identity fixtures for tests. Note that these cannot be defined in the tests package as
+// the tests of the identities package depend on it.
+package identitytest
+
+import (
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/deciphernow/nautls/identities"
+)
+
+// MustAuthority generates a self signed root with an ECDSA key or fails the test.
+func MustAuthority(name string, t *testing.T) *identities.Identity {
+
+	template, err := identities.RootTemplate(pkix.Name{CommonName: name})
+	if err != nil {
+		t.Fatalf("error creating template [%s]", err.Error())
+	}
+
+	return MustIssue(nil, template, identities.ECDSA, 256, t)
+}
+
+// MustIssue issues an identity from an authority (or a self signed identity if the authority is nil) or fails the test.
+func MustIssue(authority *identities.Identity, template identities.Template, algorithm identities.KeyAlgorithm, size int, t *testing.T) *identities.Identity {
+
+	var identity *identities.Identity
+	var err error
+
+	if authority == nil {
+		identity, err = identities.Self(template, algorithm, size)
+	} else {
+		identity, err = authority.Issue(template, algorithm, size)
+	}
+
+	if err != nil {
+		t.Fatalf("error issuing identity [%s]", err.Error())
+	}
+
+	return identity
+}
+
+// MustServerTemplate returns a server template for a DNS name or fails the test.
+func MustServerTemplate(name string, t *testing.T) identities.Template {
+
+	template, err := identities.ServerTemplate([]string{name}, nil)
+	if err != nil {
+		t.Fatalf("error creating template [%s]", err.Error())
+	}
+
+	return template
+}
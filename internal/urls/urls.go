@@ -30,6 +30,25 @@ func init() {
 	getter.Getters["base64"] = &getters.Base64{}
 }
 
+// clientGetters returns new instances of the getters supported for resources. Note that go-getter configures the getters
+// of a client for that client on every fetch such that its default getters, which are shared between clients, must not
+// be used by concurrent fetches.
+func clientGetters() map[string]getter.Getter {
+
+	http := &getter.HttpGetter{Netrc: true}
+
+	return map[string]getter.Getter{
+		"base64": &getters.Base64{},
+		"file":   new(getter.FileGetter),
+		"gcs":    new(getter.GCSGetter),
+		"git":    new(getter.GitGetter),
+		"hg":     new(getter.HgGetter),
+		"http":   http,
+		"https":  http,
+		"s3":     new(getter.S3Getter),
+	}
+}
+
 // File gets the provided resource to a temporary file on the local machine and returns the path.
 func File(resource *url.URL) (string, error) {
 
@@ -40,8 +59,13 @@ func File(resource *url.URL) (string, error) {
 
 	destination := filepath.Join(directory, "resource")
 
-	err = getter.GetFile(destination, resource.String())
-	if err != nil {
+	client := &getter.Client{
+		Dst:     destination,
+		Getters: clientGetters(),
+		Src:     resource.String(),
+	}
+
+	if err := client.Get(); err != nil {
 		return "", errors.Wrapf(err, "error fetching resource from [%s] to [%s]", resource.String(), destination)
 	}
 
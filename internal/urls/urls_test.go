@@ -16,8 +16,11 @@ package urls
 
 import (
 	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/deciphernow/nautls/internal/temporary"
 	"github.com/deciphernow/nautls/internal/tests"
@@ -60,5 +63,44 @@ func TestReadFile(test *testing.T) {
 				So(err, ShouldBeNil)
 			})
 		})
+
+		Convey("while a slow http resource is fetched", func() {
+
+			release := make(chan struct{})
+
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				if request.Method == http.MethodGet {
+					<-release
+				}
+				writer.Write([]byte("slow"))
+			}))
+			defer server.Close()
+
+			slow, err := url.Parse(server.URL + "/slow")
+			So(err, ShouldBeNil)
+
+			done := make(chan struct{})
+			go func() {
+				ReadFile(slow)
+				close(done)
+			}()
+
+			expectedContent := tests.MustGenerateBytes(test)
+			resource, err := url.Parse("base64:///" + url.PathEscape(base64.StdEncoding.EncodeToString(expectedContent)))
+			So(err, ShouldBeNil)
+
+			start := time.Now()
+			actualContent, err := ReadFile(resource)
+			elapsed := time.Since(start)
+
+			close(release)
+			<-done
+
+			Convey("it returns the content of other resources without waiting", func() {
+				So(err, ShouldBeNil)
+				So(actualContent, ShouldResemble, expectedContent)
+				So(elapsed, ShouldBeLessThan, time.Second)
+			})
+		})
 	})
 }
@@ -0,0 +1,304 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lints provides checks of certificates and keys for weak cryptography and common misconfigurations.
+package lints
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Severity defines the severity of a finding.
+type Severity int
+
+const (
+
+	// Info defines findings that are informational only.
+	Info Severity = iota
+
+	// Warning defines findings that are likely misconfigurations but are accepted by peers.
+	Warning
+
+	// Error defines findings that weaken security or cause peers to reject the certificate.
+	Error
+)
+
+// String returns the name of the severity.
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// Usage defines the role of the leaf certificate being linted.
+type Usage int
+
+const (
+
+	// AnyUsage lints the leaf certificate without regard to its role.
+	AnyUsage Usage = iota
+
+	// ServerUsage lints the leaf certificate as a TLS server certificate.
+	ServerUsage
+
+	// ClientUsage lints the leaf certificate as a TLS client certificate.
+	ClientUsage
+)
+
+const (
+	// minimumRSASize defines the smallest RSA modulus length in bits that is not considered weak.
+	minimumRSASize = 2048
+
+	// minimumECDSASize defines the smallest ECDSA curve size in bits that is not considered weak.
+	minimumECDSASize = 256
+)
+
+// Finding describes the result of a lint of a certificate or key.
+type Finding struct {
+	Lint     string
+	Severity Severity
+	Subject  string
+	Message  string
+}
+
+// String returns a human readable representation of the finding.
+func (f Finding) String() string {
+	return fmt.Sprintf("%s [%s] %s: %s", f.Severity, f.Subject, f.Lint, f.Message)
+}
+
+// LintError is returned when material has findings of error severity. Note that the error may be wrapped and should be
+// retrieved with errors.Cause.
+type LintError struct {
+	Findings []Finding
+}
+
+// Error returns the findings.
+func (e *LintError) Error() string {
+
+	findings := make([]string, len(e.Findings))
+	for index, finding := range e.Findings {
+		findings[index] = finding.String()
+	}
+
+	return fmt.Sprintf("certificate lint failed [%s]", strings.Join(findings, "; "))
+}
+
+// Check returns a *LintError containing the findings of error severity if there are any.
+func Check(findings []Finding) error {
+
+	var failures []Finding
+	for _, finding := range findings {
+		if finding.Severity >= Error {
+			failures = append(failures, finding)
+		}
+	}
+
+	if len(failures) > 0 {
+		return &LintError{Findings: failures}
+	}
+
+	return nil
+}
+
+// LintTLSCertificate lints the leaf certificate of a key pair for a usage and the remaining certificates of its chain as
+// certificate authorities at a point in time.
+func LintTLSCertificate(certificate tls.Certificate, usage Usage, now time.Time) ([]Finding, error) {
+
+	var findings []Finding
+
+	for index, raw := range certificate.Certificate {
+
+		parsed, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing certificate [%d] of chain", index)
+		}
+
+		if index == 0 {
+			findings = append(findings, LintLeaf(parsed, usage, now)...)
+		} else {
+			findings = append(findings, LintAuthority(parsed, now)...)
+		}
+	}
+
+	return findings, nil
+}
+
+// LintLeaf lints a leaf certificate for a usage at a point in time.
+func LintLeaf(certificate *x509.Certificate, usage Usage, now time.Time) []Finding {
+
+	findings := LintCertificate(certificate, now)
+	subject := name(certificate)
+
+	add := func(lint string, severity Severity, format string, arguments ...interface{}) {
+		findings = append(findings, Finding{Lint: lint, Severity: severity, Subject: subject, Message: fmt.Sprintf(format, arguments...)})
+	}
+
+	if certificate.IsCA {
+		add("leaf_is_ca", Error, "leaf certificate is a certificate authority")
+	}
+
+	sans := len(certificate.DNSNames) + len(certificate.EmailAddresses) + len(certificate.IPAddresses) + len(certificate.URIs)
+	if sans == 0 && certificate.Subject.CommonName != "" {
+		severity := Warning
+		if usage == ServerUsage {
+			severity = Error
+		}
+		add("missing_subject_alternative_names", severity, "certificate identifies [%s] by common name only which is not verified as a hostname", certificate.Subject.CommonName)
+	}
+
+	switch usage {
+	case ServerUsage:
+		lintExtKeyUsage(certificate, x509.ExtKeyUsageServerAuth, "ServerAuth", add)
+	case ClientUsage:
+		lintExtKeyUsage(certificate, x509.ExtKeyUsageClientAuth, "ClientAuth", add)
+	}
+
+	return findings
+}
+
+// LintAuthority lints a certificate authority of a chain at a point in time.
+func LintAuthority(certificate *x509.Certificate, now time.Time) []Finding {
+
+	findings := LintCertificate(certificate, now)
+
+	if !certificate.BasicConstraintsValid || !certificate.IsCA {
+		findings = append(findings, Finding{
+			Lint:     "authority_is_not_ca",
+			Severity: Error,
+			Subject:  name(certificate),
+			Message:  "certificate in the chain is not a certificate authority",
+		})
+	}
+
+	return findings
+}
+
+// LintCertificate lints the properties common to all certificates (i.e., the public key, signature algorithm and
+// validity period) at a point in time. Note that the signature algorithm of self signed certificates is not linted as
+// the signatures of trust anchors are not verified.
+func LintCertificate(certificate *x509.Certificate, now time.Time) []Finding {
+
+	findings := LintKey(certificate.PublicKey)
+	subject := name(certificate)
+
+	for index := range findings {
+		findings[index].Subject = subject
+	}
+
+	add := func(lint string, severity Severity, format string, arguments ...interface{}) {
+		findings = append(findings, Finding{Lint: lint, Severity: severity, Subject: subject, Message: fmt.Sprintf(format, arguments...)})
+	}
+
+	if !selfSigned(certificate) {
+		switch certificate.SignatureAlgorithm {
+		case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+			add("weak_signature_algorithm", Error, "certificate is signed with [%s]", certificate.SignatureAlgorithm)
+		}
+	}
+
+	if now.Before(certificate.NotBefore) {
+		add("not_yet_valid", Error, "certificate is not valid until [%s]", certificate.NotBefore.UTC().Format(time.RFC3339))
+	}
+
+	if now.After(certificate.NotAfter) {
+		add("expired", Error, "certificate expired at [%s]", certificate.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	return findings
+}
+
+// LintKey lints a public or private key for weak parameters. Note that the subject of the findings is empty.
+func LintKey(key crypto.PublicKey) []Finding {
+
+	if signer, ok := key.(crypto.Signer); ok {
+		key = signer.Public()
+	}
+
+	var findings []Finding
+
+	switch public := key.(type) {
+	case *rsa.PublicKey:
+		if size := public.N.BitLen(); size < minimumRSASize {
+			findings = append(findings, Finding{Lint: "weak_rsa_key", Severity: Error, Message: fmt.Sprintf("rsa key size [%d] is less than [%d]", size, minimumRSASize)})
+		}
+		if public.E < 65537 {
+			findings = append(findings, Finding{Lint: "small_rsa_exponent", Severity: Warning, Message: fmt.Sprintf("rsa public exponent [%d] is less than [65537]", public.E)})
+		}
+	case *ecdsa.PublicKey:
+		if size := public.Curve.Params().BitSize; size < minimumECDSASize {
+			findings = append(findings, Finding{Lint: "weak_ecdsa_key", Severity: Error, Message: fmt.Sprintf("ecdsa curve size [%d] is less than [%d]", size, minimumECDSASize)})
+		}
+	}
+
+	return findings
+}
+
+// lintExtKeyUsage adds a finding if the extended key usages of a certificate do not permit a usage. Certificates without
+// extended key usages are permitted any usage by peers and result in a warning.
+func lintExtKeyUsage(certificate *x509.Certificate, usage x509.ExtKeyUsage, usageName string, add func(string, Severity, string, ...interface{})) {
+
+	if len(certificate.ExtKeyUsage) == 0 && len(certificate.UnknownExtKeyUsage) == 0 {
+		add("missing_ext_key_usage", Warning, "certificate does not define extended key usages and permits [%s] implicitly", usageName)
+		return
+	}
+
+	for _, permitted := range certificate.ExtKeyUsage {
+		if permitted == usage || permitted == x509.ExtKeyUsageAny {
+			return
+		}
+	}
+
+	add("missing_ext_key_usage", Error, "certificate extended key usages do not include [%s]", usageName)
+}
+
+// name returns the name used to identify a certificate in findings.
+func name(certificate *x509.Certificate) string {
+
+	if certificate.Subject.CommonName != "" {
+		return certificate.Subject.CommonName
+	}
+
+	if len(certificate.URIs) > 0 {
+		return certificate.URIs[0].String()
+	}
+
+	if len(certificate.DNSNames) > 0 {
+		return certificate.DNSNames[0]
+	}
+
+	return certificate.Subject.String()
+}
+
+// selfSigned returns whether a certificate is self issued with its own key. Note that the signature is not checked as
+// signatures using weak algorithms (e.g., SHA-1) cannot be verified.
+func selfSigned(certificate *x509.Certificate) bool {
+	return bytes.Equal(certificate.RawIssuer, certificate.RawSubject) && (len(certificate.AuthorityKeyId) == 0 || bytes.Equal(certificate.AuthorityKeyId, certificate.SubjectKeyId))
+}
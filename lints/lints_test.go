@@ -0,0 +1,240 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lints
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/deciphernow/nautls/identities"
+	"github.com/deciphernow/nautls/internal/tests/identitytest"
+	"github.com/pkg/errors"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// MustTemplate returns a template from a profile or fails the test.
+func MustTemplate(template identities.Template, err error) func(*testing.T) identities.Template {
+	return func(t *testing.T) identities.Template {
+		if err != nil {
+			t.Fatalf("error creating template [%s]", err.Error())
+		}
+		return template
+	}
+}
+
+// lints returns the names of the lints of the findings.
+func lints(findings []Finding) []string {
+
+	names := []string{}
+	for _, finding := range findings {
+		names = append(names, finding.Lint)
+	}
+
+	return names
+}
+
+func TestLints(t *testing.T) {
+
+	Convey("When linting", t, func() {
+
+		now := time.Now()
+
+		root := identitytest.MustIssue(nil, MustTemplate(identities.RootTemplate(pkix.Name{CommonName: "NauTLS (Root)"}))(t), identities.ECDSA, 256, t)
+		intermediate := identitytest.MustIssue(root, MustTemplate(identities.IntermediateTemplate(pkix.Name{CommonName: "NauTLS (Intermediate)"}))(t), identities.ECDSA, 256, t)
+		server := identitytest.MustIssue(intermediate, MustTemplate(identities.ServerTemplate([]string{"nautls.com"}, nil))(t), identities.ECDSA, 256, t)
+
+		Convey("#LintTLSCertificate is invoked", func() {
+
+			Convey("with a valid server chain", func() {
+
+				certificate, err := server.TLSCertificate()
+				So(err, ShouldBeNil)
+
+				findings, err := LintTLSCertificate(certificate, ServerUsage, now)
+
+				Convey("it returns no findings", func() {
+					So(err, ShouldBeNil)
+					So(findings, ShouldBeEmpty)
+				})
+			})
+
+			Convey("with a chain including a leaf as an authority", func() {
+
+				certificate, err := identities.NewIdentity([]*x509.Certificate{server.Certificate}, server.Certificate, server.Key).TLSCertificate()
+				So(err, ShouldBeNil)
+
+				findings, err := LintTLSCertificate(certificate, ServerUsage, now)
+
+				Convey("it returns an authority finding", func() {
+					So(err, ShouldBeNil)
+					So(lints(findings), ShouldResemble, []string{"authority_is_not_ca"})
+				})
+			})
+
+			Convey("with an invalid certificate", func() {
+
+				_, err := LintTLSCertificate(tls.Certificate{Certificate: [][]byte{{0x00}}}, ServerUsage, now)
+
+				Convey("it returns an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey("#LintLeaf is invoked", func() {
+
+			Convey("with a weak rsa key", func() {
+
+				weak := identitytest.MustIssue(root, MustTemplate(identities.ServerTemplate([]string{"nautls.com"}, nil))(t), identities.RSA, 1024, t)
+
+				findings := LintLeaf(weak.Certificate, ServerUsage, now)
+
+				Convey("it returns an error finding", func() {
+					So(findings, ShouldResemble, []Finding{{Lint: "weak_rsa_key", Severity: Error, Subject: "nautls.com", Message: "rsa key size [1024] is less than [2048]"}})
+				})
+			})
+
+			Convey("with a sha-1 signature", func() {
+
+				weak := *server.Certificate
+				weak.SignatureAlgorithm = x509.SHA1WithRSA
+
+				findings := LintLeaf(&weak, ServerUsage, now)
+
+				Convey("it returns an error finding", func() {
+					So(lints(findings), ShouldResemble, []string{"weak_signature_algorithm"})
+					So(findings[0].Severity, ShouldEqual, Error)
+				})
+			})
+
+			Convey("with an expired certificate", func() {
+
+				findings := LintLeaf(server.Certificate, ServerUsage, server.Certificate.NotAfter.Add(time.Second))
+
+				Convey("it returns an error finding", func() {
+					So(lints(findings), ShouldResemble, []string{"expired"})
+				})
+			})
+
+			Convey("with a certificate that is not yet valid", func() {
+
+				findings := LintLeaf(server.Certificate, ServerUsage, server.Certificate.NotBefore.Add(-time.Second))
+
+				Convey("it returns an error finding", func() {
+					So(lints(findings), ShouldResemble, []string{"not_yet_valid"})
+				})
+			})
+
+			Convey("with a common name only", func() {
+
+				template := MustTemplate(identities.ClientTemplate("nautls.com"))(t)
+				template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+
+				leaf := identitytest.MustIssue(intermediate, template, identities.ECDSA, 256, t)
+
+				Convey("as a server it returns an error finding", func() {
+					findings := LintLeaf(leaf.Certificate, ServerUsage, now)
+					So(lints(findings), ShouldResemble, []string{"missing_subject_alternative_names"})
+					So(findings[0].Severity, ShouldEqual, Error)
+				})
+
+				Convey("as a client it returns a warning finding", func() {
+					findings := LintLeaf(leaf.Certificate, ClientUsage, now)
+					So(lints(findings), ShouldResemble, []string{"missing_subject_alternative_names"})
+					So(findings[0].Severity, ShouldEqual, Warning)
+				})
+			})
+
+			Convey("with a client certificate used as a server", func() {
+
+				client := identitytest.MustIssue(intermediate, MustTemplate(identities.ClientTemplate("client"))(t), identities.ECDSA, 256, t)
+
+				findings := LintLeaf(client.Certificate, ServerUsage, now)
+
+				Convey("it returns an error finding", func() {
+					So(lints(findings), ShouldContain, "missing_ext_key_usage")
+					So(Check(findings), ShouldNotBeNil)
+				})
+			})
+
+			Convey("with a certificate without extended key usages", func() {
+
+				template := MustTemplate(identities.ServerTemplate([]string{"nautls.com"}, nil))(t)
+				template.ExtKeyUsage = nil
+
+				leaf := identitytest.MustIssue(intermediate, template, identities.ECDSA, 256, t)
+
+				findings := LintLeaf(leaf.Certificate, ServerUsage, now)
+
+				Convey("it returns a warning finding", func() {
+					So(lints(findings), ShouldResemble, []string{"missing_ext_key_usage"})
+					So(findings[0].Severity, ShouldEqual, Warning)
+				})
+			})
+
+			Convey("with a certificate authority", func() {
+
+				findings := LintLeaf(intermediate.Certificate, AnyUsage, now)
+
+				Convey("it returns error and warning findings", func() {
+					So(lints(findings), ShouldResemble, []string{"leaf_is_ca", "missing_subject_alternative_names"})
+				})
+			})
+		})
+
+		Convey("#LintCertificate is invoked", func() {
+
+			Convey("with a self signed sha-1 certificate", func() {
+
+				weak := *root.Certificate
+				weak.SignatureAlgorithm = x509.SHA1WithRSA
+
+				findings := LintCertificate(&weak, now)
+
+				Convey("it does not lint the signature of the trust anchor", func() {
+					So(findings, ShouldBeEmpty)
+				})
+			})
+		})
+
+		Convey("#Check is invoked", func() {
+
+			Convey("with findings of error severity", func() {
+
+				findings := []Finding{{Lint: "warning", Severity: Warning}, {Lint: "error", Severity: Error, Subject: "nautls.com", Message: "message"}}
+
+				err := Check(findings)
+
+				Convey("it returns a lint error with the error findings", func() {
+					cause, ok := errors.Cause(err).(*LintError)
+					So(ok, ShouldBeTrue)
+					So(cause.Findings, ShouldResemble, findings[1:])
+					So(err.Error(), ShouldEqual, "certificate lint failed [error [nautls.com] error: message]")
+				})
+			})
+
+			Convey("with findings of lesser severity", func() {
+
+				Convey("it returns a nil error", func() {
+					So(Check([]Finding{{Severity: Info}, {Severity: Warning}}), ShouldBeNil)
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,395 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policies provides declarative issuance policies that limit the certificates a certificate authority issues.
+package policies
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/deciphernow/nautls/identities"
+	"github.com/deciphernow/nautls/internal/urls"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Policy provides a serializable issuance policy that limits the certificates that may be issued for templates and
+// certificate signing requests. Each field defines a rule and rules whose values are empty (or zero) do not restrict
+// issuance with the exception of AllowCA which denies certificate authorities unless set.
+type Policy struct {
+
+	// CommonNames defines the patterns (e.g., "*.svc.internal") that a non-empty subject common name must match. The
+	// patterns are matched label by label as for the DNS names (i.e., "*.svc.internal" matches "api.svc.internal" but
+	// not "v1.api.svc.internal").
+	CommonNames []string `json:"common_names" mapstructure:"common_names" yaml:"common_names"`
+
+	// DNSNames defines the patterns (e.g., "*.svc.internal") that each DNS name must match. Each label of a pattern
+	// matches a single label of a name case insensitively and a "*" label matches any one label (i.e.,
+	// "*.svc.internal" matches "api.svc.internal" but neither "svc.internal" nor "v1.api.svc.internal").
+	DNSNames []string `json:"dns_names" mapstructure:"dns_names" yaml:"dns_names"`
+
+	// EmailAddresses defines the patterns (e.g., "*@nautls.com") that each email address must match. The patterns use
+	// the syntax of path.Match.
+	EmailAddresses []string `json:"email_addresses" mapstructure:"email_addresses" yaml:"email_addresses"`
+
+	// IPRanges defines the ranges in CIDR notation (e.g., "10.0.0.0/8") that must contain each IP address.
+	IPRanges []string `json:"ip_ranges" mapstructure:"ip_ranges" yaml:"ip_ranges"`
+
+	// URIs defines the patterns (e.g., "spiffe://nautls.com/*") that each URI must match. The patterns use the syntax of
+	// path.Match and are matched against the whole URI case sensitively. A "*" matches any characters other than "/"
+	// such that it never spans path segments (i.e., "spiffe://nautls.com/*" matches "spiffe://nautls.com/api" but not
+	// "spiffe://nautls.com/api/v1") and a "*" in the host (e.g., "spiffe://*/api") matches any single host.
+	URIs []string `json:"uris" mapstructure:"uris" yaml:"uris"`
+
+	// MaxValidity defines the longest period that certificates may be valid (e.g., "2160h" or "90d"). The period is
+	// measured from the start to the end of the validity of the template and may exceed the maximum by at most
+	// identities.Backdate such that templates backdated for clock skew (see identities.ServerTemplate) are not denied.
+	MaxValidity identities.Duration `json:"max_validity" mapstructure:"max_validity" yaml:"max_validity"`
+
+	// AllowCA defines whether certificate authorities may be issued.
+	AllowCA bool `json:"allow_ca" mapstructure:"allow_ca" yaml:"allow_ca"`
+
+	// KeyUsages and ExtKeyUsages define the key usages and extended key usages that certificates may have by name (e.g.,
+	// "DigitalSignature" or "ServerAuth").
+	KeyUsages    []identities.KeyUsage    `json:"key_usages" mapstructure:"key_usages" yaml:"key_usages"`
+	ExtKeyUsages []identities.ExtKeyUsage `json:"ext_key_usages" mapstructure:"ext_key_usages" yaml:"ext_key_usages"`
+
+	// KeyAlgorithms defines the algorithms (i.e., "rsa", "ecdsa" or "ed25519") of the keys that may be certified.
+	KeyAlgorithms []identities.KeyAlgorithm `json:"key_algorithms" mapstructure:"key_algorithms" yaml:"key_algorithms"`
+
+	// MinRSABits defines the minimum modulus length in bits of the RSA keys that may be certified.
+	MinRSABits int `json:"min_rsa_bits" mapstructure:"min_rsa_bits" yaml:"min_rsa_bits"`
+}
+
+// Denial describes a rule of a policy that denies issuance. The rule is the serialized name of the field of the Policy
+// (e.g., "dns_names").
+type Denial struct {
+	Rule   string
+	Reason string
+}
+
+// DenialError is returned when a policy denies issuance and describes the denial of each rule. Note that the error may
+// be wrapped and should be retrieved with errors.Cause.
+type DenialError struct {
+	Subject string
+	Denials []Denial
+}
+
+// Error returns the reasons of the denials.
+func (e *DenialError) Error() string {
+
+	reasons := make([]string, len(e.Denials))
+	for index, denial := range e.Denials {
+		reasons[index] = fmt.Sprintf("%s: %s", denial.Rule, denial.Reason)
+	}
+
+	return fmt.Sprintf("policy denies certificate for [%s] [%s]", e.Subject, strings.Join(reasons, "; "))
+}
+
+// LoadPolicy loads a policy from a URL that points to the location of a YAML or JSON encoded policy.
+//
+// Note that in addition to those schemes supported by [getter](https://godoc.org/github.com/hashicorp/go-getter) a
+// "base64" scheme is supported for providing the policy in the path of the URL directly. This is most applicable when
+// the policy must be provided via an environement variable.
+func LoadPolicy(resource string) (*Policy, error) {
+
+	parsed, err := url.Parse(resource)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing url from [%s]", resource)
+	}
+
+	bytes, err := urls.ReadFile(parsed)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading policy from [%s]", resource)
+	}
+
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(bytes, policy); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshalling policy from [%s]", resource)
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid policy from [%s]", resource)
+	}
+
+	return policy, nil
+}
+
+// Validate returns an error if the patterns or ranges of the policy are malformed.
+func (p *Policy) Validate() error {
+
+	for _, patterns := range [][]string{p.EmailAddresses, p.URIs} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return errors.Wrapf(err, "invalid pattern [%s]", pattern)
+			}
+		}
+	}
+
+	for _, value := range p.IPRanges {
+		if _, _, err := net.ParseCIDR(value); err != nil {
+			return errors.Wrapf(err, "invalid ip range [%s]", value)
+		}
+	}
+
+	return nil
+}
+
+// Evaluate returns a *DenialError describing each rule of the policy that denies a certificate for a template.
+func (p *Policy) Evaluate(template identities.Template) error {
+	return p.result(template.Subject.CommonName, p.evaluate(template))
+}
+
+// EvaluateRequest returns a *DenialError describing each rule of the policy that denies a certificate for a certificate
+// signing request signed with a template (see identities.RequestTemplate) including those that deny its public key.
+func (p *Policy) EvaluateRequest(request *x509.CertificateRequest, template identities.Template) error {
+
+	template, err := identities.RequestTemplate(request, template)
+	if err != nil {
+		return errors.Wrapf(err, "error evaluating certificate request for [%s]", request.Subject.CommonName)
+	}
+
+	algorithm, size, err := keyParameters(request.PublicKey)
+	if err != nil {
+		return errors.Wrapf(err, "error evaluating certificate request for [%s]", template.Subject.CommonName)
+	}
+
+	return p.result(template.Subject.CommonName, append(p.evaluate(template), p.evaluateKey(algorithm, size)...))
+}
+
+// Issue returns a new identity issued by the issuer for a template with a key of the provided algorithm and size if
+// the policy permits it and a *DenialError otherwise.
+func (p *Policy) Issue(issuer *identities.Identity, template identities.Template, algorithm identities.KeyAlgorithm, size int) (*identities.Identity, error) {
+
+	if err := p.result(template.Subject.CommonName, append(p.evaluate(template), p.evaluateKey(algorithm, size)...)); err != nil {
+		return nil, errors.Wrapf(err, "error issuing certificate for [%s]", template.Subject.CommonName)
+	}
+
+	return issuer.Issue(template, algorithm, size)
+}
+
+// SignRequest returns a certificate signed by the issuer for a certificate signing request (see
+// identities.Identity.SignRequest) if the policy permits it and a *DenialError otherwise.
+func (p *Policy) SignRequest(issuer *identities.Identity, request *x509.CertificateRequest, template identities.Template) (*x509.Certificate, error) {
+
+	if err := p.EvaluateRequest(request, template); err != nil {
+		return nil, errors.Wrapf(err, "error signing certificate request for [%s]", request.Subject.CommonName)
+	}
+
+	return issuer.SignRequest(request, template)
+}
+
+// evaluate returns the denials of the rules of the policy that apply to a template.
+func (p *Policy) evaluate(template identities.Template) []Denial {
+
+	var denials []Denial
+
+	deny := func(rule string, format string, arguments ...interface{}) {
+		denials = append(denials, Denial{Rule: rule, Reason: fmt.Sprintf(format, arguments...)})
+	}
+
+	if name := template.Subject.CommonName; name != "" && len(p.CommonNames) > 0 && !matchAny(p.CommonNames, name, matchDNSName) {
+		deny("common_names", "common name [%s] does not match a permitted pattern", name)
+	}
+
+	for _, name := range template.DNSNames {
+		if len(p.DNSNames) > 0 && !matchAny(p.DNSNames, name, matchDNSName) {
+			deny("dns_names", "dns name [%s] does not match a permitted pattern", name)
+		}
+	}
+
+	for _, address := range template.EmailAddresses {
+		if len(p.EmailAddresses) > 0 && !matchAny(p.EmailAddresses, address, matchPattern) {
+			deny("email_addresses", "email address [%s] does not match a permitted pattern", address)
+		}
+	}
+
+	for _, ip := range template.IPAddresses {
+		if len(p.IPRanges) > 0 && !matchAny(p.IPRanges, ip.String(), matchIPRange) {
+			deny("ip_ranges", "ip address [%s] is not within a permitted range", ip)
+		}
+	}
+
+	for _, uri := range template.URIs {
+		if len(p.URIs) > 0 && !matchAny(p.URIs, uri.String(), matchPattern) {
+			deny("uris", "uri [%s] does not match a permitted pattern", uri)
+		}
+	}
+
+	if p.MaxValidity > 0 {
+
+		if validity := template.NotAfter.Sub(template.NotBefore); validity > time.Duration(p.MaxValidity)+identities.Backdate {
+			deny("max_validity", "validity [%s] exceeds [%s]", validity.Round(time.Second), time.Duration(p.MaxValidity))
+		}
+	}
+
+	if template.IsCA && !p.AllowCA {
+		deny("allow_ca", "certificate authorities are not permitted")
+	}
+
+	if len(p.KeyUsages) > 0 {
+
+		var permitted x509.KeyUsage
+		for _, usage := range p.KeyUsages {
+			permitted |= x509.KeyUsage(usage)
+		}
+
+		if denied := template.KeyUsage &^ permitted; denied != 0 {
+			deny("key_usages", "key usages [%s] are not permitted", strings.Join(identities.KeyUsageNames(denied), ", "))
+		}
+	}
+
+	if len(p.ExtKeyUsages) > 0 {
+
+		for _, usage := range template.ExtKeyUsage {
+			if !containsExtKeyUsage(p.ExtKeyUsages, usage) {
+				name, err := identities.ExtKeyUsage(usage).ToString()
+				if err != nil {
+					name = fmt.Sprintf("%d", usage)
+				}
+				deny("ext_key_usages", "extended key usage [%s] is not permitted", name)
+			}
+		}
+
+		for _, usage := range template.UnknownExtKeyUsage {
+			deny("ext_key_usages", "extended key usage [%s] is not permitted", usage)
+		}
+	}
+
+	return denials
+}
+
+// evaluateKey returns the denials of the rules of the policy that apply to a key of an algorithm and size.
+func (p *Policy) evaluateKey(algorithm identities.KeyAlgorithm, size int) []Denial {
+
+	var denials []Denial
+
+	if len(p.KeyAlgorithms) > 0 && !containsKeyAlgorithm(p.KeyAlgorithms, algorithm) {
+		denials = append(denials, Denial{Rule: "key_algorithms", Reason: fmt.Sprintf("key algorithm [%s] is not permitted", algorithm)})
+	}
+
+	if algorithm == identities.RSA && size < p.MinRSABits {
+		denials = append(denials, Denial{Rule: "min_rsa_bits", Reason: fmt.Sprintf("rsa key size [%d] is less than [%d]", size, p.MinRSABits)})
+	}
+
+	return denials
+}
+
+// result returns a *DenialError for the denials if any.
+func (p *Policy) result(subject string, denials []Denial) error {
+
+	if len(denials) > 0 {
+		return &DenialError{Subject: subject, Denials: denials}
+	}
+
+	return nil
+}
+
+// keyParameters returns the algorithm and size of a public key.
+func keyParameters(public crypto.PublicKey) (identities.KeyAlgorithm, int, error) {
+
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		return identities.RSA, key.N.BitLen(), nil
+	case *ecdsa.PublicKey:
+		return identities.ECDSA, key.Curve.Params().BitSize, nil
+	case ed25519.PublicKey:
+		return identities.Ed25519, 256, nil
+	default:
+		return "", 0, fmt.Errorf("unsupported public key type [%T]", public)
+	}
+}
+
+// matchAny returns whether a value matches any of the patterns according to a match function.
+func matchAny(patterns []string, value string, match func(string, string) bool) bool {
+
+	for _, pattern := range patterns {
+		if match(pattern, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchPattern returns whether a value matches a path.Match pattern.
+func matchPattern(pattern string, value string) bool {
+	matched, err := path.Match(pattern, value)
+	return err == nil && matched
+}
+
+// matchDNSName returns whether a DNS name (or common name) matches a pattern label by label where a "*" label matches
+// any one label.
+func matchDNSName(pattern string, name string) bool {
+
+	patternLabels := strings.Split(strings.ToLower(strings.TrimSuffix(pattern, ".")), ".")
+	nameLabels := strings.Split(strings.ToLower(strings.TrimSuffix(name, ".")), ".")
+
+	if len(patternLabels) != len(nameLabels) {
+		return false
+	}
+
+	for index, label := range patternLabels {
+		if nameLabels[index] == "" || (label != "*" && label != nameLabels[index]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchIPRange returns whether an IP address is within a range in CIDR notation.
+func matchIPRange(cidr string, ip string) bool {
+
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+
+	return network.Contains(net.ParseIP(ip))
+}
+
+// containsExtKeyUsage returns whether an extended key usage is in a slice.
+func containsExtKeyUsage(usages []identities.ExtKeyUsage, usage x509.ExtKeyUsage) bool {
+
+	for _, permitted := range usages {
+		if x509.ExtKeyUsage(permitted) == usage {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsKeyAlgorithm returns whether a key algorithm is in a slice.
+func containsKeyAlgorithm(algorithms []identities.KeyAlgorithm, algorithm identities.KeyAlgorithm) bool {
+
+	for _, permitted := range algorithms {
+		if permitted == algorithm {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,391 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policies
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/deciphernow/nautls/identities"
+	"github.com/deciphernow/nautls/internal/tests"
+	"github.com/deciphernow/nautls/internal/tests/identitytest"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// ExpectedPolicy returns the policy defined in the testdata directory.
+func ExpectedPolicy() Policy {
+	return Policy{
+		DNSNames:      []string{"*.svc.internal"},
+		IPRanges:      []string{"10.0.0.0/8"},
+		URIs:          []string{"spiffe://svc.internal/*"},
+		MaxValidity:   identities.Duration(90 * 24 * time.Hour),
+		KeyUsages:     []identities.KeyUsage{identities.KeyUsage(x509.KeyUsageDigitalSignature), identities.KeyUsage(x509.KeyUsageKeyEncipherment)},
+		ExtKeyUsages:  []identities.ExtKeyUsage{identities.ExtKeyUsage(x509.ExtKeyUsageServerAuth), identities.ExtKeyUsage(x509.ExtKeyUsageClientAuth)},
+		KeyAlgorithms: []identities.KeyAlgorithm{identities.ECDSA, identities.RSA},
+		MinRSABits:    2048,
+	}
+}
+
+func TestPolicy(t *testing.T) {
+
+	Convey("When Policy", t, func() {
+
+		Convey("is deserialized from json", func() {
+
+			var actual Policy
+			err := json.Unmarshal(tests.MustRead("testdata/policy.json", t), &actual)
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("it returns the expected policy", func() {
+				So(actual, ShouldResemble, ExpectedPolicy())
+			})
+		})
+
+		Convey("is deserialized from yaml", func() {
+
+			var actual Policy
+			err := yaml.Unmarshal(tests.MustRead("testdata/policy.yaml", t), &actual)
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("it returns the expected policy", func() {
+				So(actual, ShouldResemble, ExpectedPolicy())
+			})
+		})
+
+		Convey("is decoded with mapstructure", func() {
+
+			var values map[string]interface{}
+			if err := yaml.Unmarshal(tests.MustRead("testdata/policy.yaml", t), &values); err != nil {
+				t.Fatalf("error unmarshalling yaml [%s]", err.Error())
+			}
+
+			var actual Policy
+			decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+				DecodeHook: mapstructure.ComposeDecodeHookFunc(identities.StringToDuration(), identities.StringToKeyUsage(), identities.StringToExtKeyUsage()),
+				Result:     &actual,
+			})
+			if err != nil {
+				t.Fatalf("error initializing decoder [%s]", err.Error())
+			}
+
+			err = decoder.Decode(values)
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("it returns the expected policy", func() {
+				So(actual, ShouldResemble, ExpectedPolicy())
+			})
+		})
+
+		Convey("#LoadPolicy is invoked", func() {
+
+			for _, name := range []string{"policy.json", "policy.yaml"} {
+
+				policy, err := LoadPolicy(fmt.Sprintf("file://%s", tests.MustAbsolutePath("testdata/"+name, t)))
+
+				Convey(fmt.Sprintf("with %s it returns the policy", name), func() {
+					So(err, ShouldBeNil)
+					So(*policy, ShouldResemble, ExpectedPolicy())
+				})
+			}
+
+			Convey("with an invalid pattern", func() {
+
+				_, err := LoadPolicy(fmt.Sprintf("file://%s", tests.MustAbsolutePath("testdata/invalid.yaml", t)))
+
+				Convey("it returns an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("with an unknown rule", func() {
+
+				_, err := LoadPolicy("base64:///" + url.PathEscape("ZG5zX25hbWVzX3R5cG86IFtdCg=="))
+
+				Convey("it returns an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		policy := ExpectedPolicy()
+
+		template, err := identities.ServerTemplate([]string{"api.svc.internal"}, []net.IP{net.ParseIP("10.0.0.1")})
+		So(err, ShouldBeNil)
+
+		template.URIs = []*url.URL{{Scheme: "spiffe", Host: "svc.internal", Path: "/api"}}
+
+		denials := func(err error) []Denial {
+			cause, ok := errors.Cause(err).(*DenialError)
+			So(ok, ShouldBeTrue)
+			return cause.Denials
+		}
+
+		Convey(".Evaluate is invoked", func() {
+
+			Convey("with a permitted template", func() {
+
+				err := policy.Evaluate(template)
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("with names that do not match", func() {
+
+				template.DNSNames = []string{"api.svc.internal", "svc.internal", "v1.api.svc.internal", "api.svc.external"}
+				template.IPAddresses = []net.IP{net.ParseIP("192.168.0.1")}
+				template.URIs = []*url.URL{{Scheme: "spiffe", Host: "svc.internal", Path: "/api/v1"}}
+
+				err := policy.Evaluate(template)
+
+				Convey("it returns a denial for each name", func() {
+					So(denials(err), ShouldResemble, []Denial{
+						{Rule: "dns_names", Reason: "dns name [svc.internal] does not match a permitted pattern"},
+						{Rule: "dns_names", Reason: "dns name [v1.api.svc.internal] does not match a permitted pattern"},
+						{Rule: "dns_names", Reason: "dns name [api.svc.external] does not match a permitted pattern"},
+						{Rule: "ip_ranges", Reason: "ip address [192.168.0.1] is not within a permitted range"},
+						{Rule: "uris", Reason: "uri [spiffe://svc.internal/api/v1] does not match a permitted pattern"},
+					})
+				})
+			})
+
+			Convey("with a validity that is too long", func() {
+
+				template.NotAfter = time.Now().Add(91 * 24 * time.Hour)
+
+				err := policy.Evaluate(template)
+
+				Convey("it returns a max validity denial", func() {
+					So(denials(err), ShouldHaveLength, 1)
+					So(denials(err)[0].Rule, ShouldEqual, "max_validity")
+				})
+			})
+
+			Convey("with a validity backdated beyond the tolerance", func() {
+
+				template.NotBefore = time.Now().Add(-10 * 365 * 24 * time.Hour)
+				template.NotAfter = time.Now().Add(89 * 24 * time.Hour)
+
+				err := policy.Evaluate(template)
+
+				Convey("it returns a max validity denial", func() {
+					So(denials(err), ShouldHaveLength, 1)
+					So(denials(err)[0].Rule, ShouldEqual, "max_validity")
+				})
+			})
+
+			Convey("with a validity of the maximum backdated for clock skew", func() {
+
+				now := time.Now()
+
+				template.NotBefore = now.Add(-identities.Backdate)
+				template.NotAfter = now.Add(90 * 24 * time.Hour)
+
+				err := policy.Evaluate(template)
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("with a future validity within the maximum", func() {
+
+				template.NotBefore = time.Now().Add(30 * 24 * time.Hour)
+				template.NotAfter = template.NotBefore.Add(90 * 24 * time.Hour)
+
+				err := policy.Evaluate(template)
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("with a certificate authority", func() {
+
+				template, err := identities.IntermediateTemplate(pkix.Name{CommonName: "NauTLS (Intermediate)"})
+				So(err, ShouldBeNil)
+
+				err = policy.Evaluate(template)
+
+				Convey("it returns a denial for the validity, authority and key usages", func() {
+					So(denials(err), ShouldHaveLength, 3)
+					So(denials(err)[0].Rule, ShouldEqual, "max_validity")
+					So(denials(err)[1:], ShouldResemble, []Denial{
+						{Rule: "allow_ca", Reason: "certificate authorities are not permitted"},
+						{Rule: "key_usages", Reason: "key usages [CertSign, CRLSign] are not permitted"},
+					})
+				})
+			})
+
+			Convey("with extended key usages that are not permitted", func() {
+
+				template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageCodeSigning}
+
+				err := policy.Evaluate(template)
+
+				Convey("it returns an extended key usage denial", func() {
+					So(denials(err), ShouldResemble, []Denial{{Rule: "ext_key_usages", Reason: "extended key usage [CodeSigning] is not permitted"}})
+				})
+			})
+
+			Convey("with common names", func() {
+
+				policy.CommonNames = []string{"*.svc.internal"}
+
+				template.Subject = pkix.Name{CommonName: "api.svc.external"}
+
+				err := policy.Evaluate(template)
+
+				Convey("it returns a common name denial", func() {
+					So(denials(err), ShouldResemble, []Denial{{Rule: "common_names", Reason: "common name [api.svc.external] does not match a permitted pattern"}})
+				})
+
+				Convey("and a common name with more labels than the pattern", func() {
+
+					template.Subject = pkix.Name{CommonName: "v1.api.svc.internal"}
+
+					err := policy.Evaluate(template)
+
+					Convey("it returns a common name denial", func() {
+						So(denials(err), ShouldResemble, []Denial{{Rule: "common_names", Reason: "common name [v1.api.svc.internal] does not match a permitted pattern"}})
+					})
+				})
+
+				Convey("and a matching common name of different case", func() {
+
+					template.Subject = pkix.Name{CommonName: "API.svc.internal"}
+
+					Convey("it returns a nil error", func() {
+						So(policy.Evaluate(template), ShouldBeNil)
+					})
+				})
+			})
+
+			Convey("with an empty policy", func() {
+
+				err := (&Policy{}).Evaluate(template)
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+		})
+
+		Convey(".Issue is invoked", func() {
+
+			issuer := identitytest.MustAuthority("NauTLS (Root)", t)
+
+			Convey("with a permitted template and key", func() {
+
+				identity, err := policy.Issue(issuer, template, identities.ECDSA, 256)
+
+				Convey("it issues the identity", func() {
+					So(err, ShouldBeNil)
+					So(identity.Certificate.DNSNames, ShouldResemble, []string{"api.svc.internal"})
+				})
+			})
+
+			Convey("with a key that is not permitted", func() {
+
+				_, err := policy.Issue(issuer, template, identities.Ed25519, 0)
+
+				Convey("it returns a key algorithm denial", func() {
+					So(denials(err), ShouldResemble, []Denial{{Rule: "key_algorithms", Reason: "key algorithm [ed25519] is not permitted"}})
+				})
+			})
+		})
+
+		Convey(".SignRequest is invoked", func() {
+
+			issuer := identitytest.MustAuthority("NauTLS (Root)", t)
+
+			key, err := identities.GenerateKey(identities.RSA, 1024)
+			So(err, ShouldBeNil)
+
+			request, err := identities.NewRequest(identities.Template{
+				Subject:  pkix.Name{CommonName: "db.svc.internal"},
+				DNSNames: []string{"db.svc.internal", "db.svc.external"},
+			}, key)
+			So(err, ShouldBeNil)
+
+			template.DNSNames = []string{"db.svc.internal", "db.svc.external"}
+
+			_, err = policy.SignRequest(issuer, request, template)
+
+			Convey("it returns a denial for the requested names and key", func() {
+				So(denials(err), ShouldResemble, []Denial{
+					{Rule: "dns_names", Reason: "dns name [db.svc.external] does not match a permitted pattern"},
+					{Rule: "min_rsa_bits", Reason: "rsa key size [1024] is less than [2048]"},
+				})
+			})
+
+			Convey("with a request whose signature is invalid", func() {
+
+				key, err := identities.GenerateKey(identities.ECDSA, 256)
+				So(err, ShouldBeNil)
+
+				request, err := identities.NewRequest(identities.Template{DNSNames: []string{"db.svc.internal"}}, key)
+				So(err, ShouldBeNil)
+
+				request.Signature[len(request.Signature)-1] ^= 0xff
+				template.DNSNames = []string{"db.svc.internal"}
+
+				_, err = policy.SignRequest(issuer, request, template)
+
+				Convey("it returns an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("with a permitted request", func() {
+
+				key, err := identities.GenerateKey(identities.ECDSA, 256)
+				So(err, ShouldBeNil)
+
+				request, err := identities.NewRequest(identities.Template{DNSNames: []string{"db.svc.internal"}}, key)
+				So(err, ShouldBeNil)
+
+				template.DNSNames = []string{"db.svc.internal"}
+
+				certificate, err := policy.SignRequest(issuer, request, template)
+
+				Convey("it signs the request", func() {
+					So(err, ShouldBeNil)
+					So(certificate.DNSNames, ShouldResemble, []string{"db.svc.internal"})
+				})
+			})
+		})
+	})
+}
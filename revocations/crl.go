@@ -0,0 +1,185 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revocations
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/deciphernow/nautls/identities"
+	"github.com/pkg/errors"
+)
+
+const (
+
+	// crlRetryInterval defines the minimum interval between attempts to reload a stale CRL.
+	crlRetryInterval = time.Minute
+)
+
+// CRLChecker verifies certificate chains against X.509 certificate revocation lists loaded from URLs. A CRL is only
+// applied to certificates whose issuer both matches the issuer of the CRL and verifies the signature of the CRL.
+// Certificates whose issuers have no CRL are not checked. CRLs that have passed their next update are reloaded in the
+// background when checked (at most once per retry interval) while the last CRL loaded continues to be used and, while
+// it remains stale, the policy of the checker determines whether it is accepted.
+type CRLChecker struct {
+	attempts   []time.Time
+	crls       []*x509.RevocationList
+	interval   time.Duration
+	mutex      sync.Mutex
+	policy     Policy
+	refreshing []bool
+	resources  []string
+}
+
+// NewCRLChecker returns a new CRLChecker for the CRLs at the resource URLs. The CRLs are loaded immediately and an
+// error is returned if any of them cannot be loaded.
+func NewCRLChecker(resources []string, policy Policy) (*CRLChecker, error) {
+
+	if _, err := policy.ToString(); err != nil {
+		return nil, errors.Wrap(err, "error creating crl checker")
+	}
+
+	checker := &CRLChecker{
+		attempts:   make([]time.Time, len(resources)),
+		crls:       make([]*x509.RevocationList, len(resources)),
+		interval:   crlRetryInterval,
+		policy:     policy,
+		refreshing: make([]bool, len(resources)),
+		resources:  resources,
+	}
+
+	for index, resource := range resources {
+
+		crl, err := identities.LoadCRL(resource)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error loading crl from [%s]", resource)
+		}
+
+		checker.crls[index] = crl
+	}
+
+	return checker, nil
+}
+
+// VerifyPeerCertificate implements the tls.Config VerifyPeerCertificate callback. The peer is accepted if any of the
+// verified chains passes Check. Note that there is nothing to check if the peer certificate was not verified (e.g.,
+// when a server does not require client certificates).
+func (c *CRLChecker) VerifyPeerCertificate(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+
+	var err error
+
+	for _, chain := range verifiedChains {
+		if err = c.Check(chain); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// Check verifies that no certificate in a chain (i.e., leaf first and ending with the root) has been revoked by its
+// issuer.
+func (c *CRLChecker) Check(chain []*x509.Certificate) error {
+
+	for index := 0; index < len(chain)-1; index++ {
+		if err := c.check(chain[index], chain[index+1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// check verifies that a certificate has not been revoked by its issuer.
+func (c *CRLChecker) check(certificate *x509.Certificate, issuer *x509.Certificate) error {
+
+	now := time.Now()
+	matched := false
+
+	for index := range c.resources {
+
+		crl := c.crl(index, now)
+
+		if !bytes.Equal(crl.RawIssuer, certificate.RawIssuer) {
+			continue
+		}
+
+		matched = true
+
+		if err := crl.CheckSignatureFrom(issuer); err != nil {
+			continue
+		}
+
+		for _, entry := range crl.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(certificate.SerialNumber) == 0 {
+				return fmt.Errorf("certificate [%s] for [%s] was revoked by [%s] at [%s]", certificate.SerialNumber, certificate.Subject.CommonName, issuer.Subject.CommonName, entry.RevocationTime.Format(time.RFC3339))
+			}
+		}
+
+		if stale(crl, now) && c.policy == FailClosed {
+			return fmt.Errorf("crl from [%s] for [%s] is stale since [%s]", c.resources[index], issuer.Subject.CommonName, crl.NextUpdate.Format(time.RFC3339))
+		}
+
+		return nil
+	}
+
+	if matched {
+		return fmt.Errorf("no crl for [%s] has a valid signature", issuer.Subject.CommonName)
+	}
+
+	return nil
+}
+
+// crl returns the CRL at an index starting a background reload from its resource if it is stale. Note that the reload
+// is skipped if one is in progress or was attempted within the retry interval such that checks never wait on (or
+// repeatedly trigger) a slow or failing resource.
+func (c *CRLChecker) crl(index int, now time.Time) *x509.RevocationList {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if stale(c.crls[index], now) && !c.refreshing[index] && now.Sub(c.attempts[index]) >= c.interval {
+		c.attempts[index] = now
+		c.refreshing[index] = true
+		go c.refresh(index)
+	}
+
+	return c.crls[index]
+}
+
+// refresh reloads the CRL at an index from its resource. Note that the current CRL is retained if the CRL cannot be
+// reloaded or the reloaded CRL is not newer.
+func (c *CRLChecker) refresh(index int) {
+
+	crl, err := identities.LoadCRL(c.resources[index])
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.refreshing[index] = false
+
+	if err == nil && crl.ThisUpdate.After(c.crls[index].ThisUpdate) {
+		c.crls[index] = crl
+	}
+}
+
+// stale returns a value indicating whether a CRL has passed its next update. Note that a CRL without a next update is
+// never stale.
+func stale(crl *x509.RevocationList, now time.Time) bool {
+	return !crl.NextUpdate.IsZero() && now.After(crl.NextUpdate)
+}
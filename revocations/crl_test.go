@@ -0,0 +1,392 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revocations
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/deciphernow/nautls/identities"
+	"github.com/deciphernow/nautls/internal/temporary"
+	"github.com/deciphernow/nautls/internal/tests/identitytest"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// MustLeaf issues a server and client certificate for a DNS name from an authority or fails the test.
+func MustLeaf(authority *identities.Identity, name string, t *testing.T) *identities.Identity {
+
+	template := identitytest.MustServerTemplate(name, t)
+	template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+
+	return identitytest.MustIssue(authority, template, identities.ECDSA, 256, t)
+}
+
+// MustCRL creates a PEM encoded CRL of the revocations of a registry signed by its issuer with the provided validity
+// period or fails the test.
+func MustCRL(registry *identities.RevocationRegistry, thisUpdate time.Time, nextUpdate time.Time, t *testing.T) []byte {
+
+	template := &x509.RevocationList{
+		NextUpdate: nextUpdate,
+		Number:     big.NewInt(thisUpdate.UnixNano()),
+		ThisUpdate: thisUpdate,
+	}
+
+	for _, revocation := range registry.Revocations() {
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			RevocationTime: revocation.RevokedAt,
+			SerialNumber:   revocation.SerialNumber,
+		})
+	}
+
+	bytes, err := x509.CreateRevocationList(rand.Reader, template, registry.Issuer().Certificate, registry.Issuer().Key)
+	if err != nil {
+		t.Fatalf("error creating crl [%s]", err.Error())
+	}
+
+	crl, err := x509.ParseRevocationList(bytes)
+	if err != nil {
+		t.Fatalf("error parsing crl [%s]", err.Error())
+	}
+
+	return identities.EncodeCRL(crl)
+}
+
+// MustCurrentCRL creates a current PEM encoded CRL of the revocations of a registry or fails the test.
+func MustCurrentCRL(registry *identities.RevocationRegistry, t *testing.T) []byte {
+	return MustCRL(registry, time.Now().Add(-time.Minute), time.Now().Add(time.Hour), t)
+}
+
+// MustStaleCRL creates a stale PEM encoded CRL of the revocations of a registry or fails the test.
+func MustStaleCRL(registry *identities.RevocationRegistry, t *testing.T) []byte {
+	return MustCRL(registry, time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour), t)
+}
+
+// MustEventually invokes a function until it returns a nil error and returns the last error if it does not do so within
+// five seconds.
+func MustEventually(function func() error, t *testing.T) error {
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	err := function()
+	for err != nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		err = function()
+	}
+
+	return err
+}
+
+// Base64URL returns a base64 URL containing the provided bytes.
+func Base64URL(bytes []byte) string {
+	return fmt.Sprintf("base64:///%s", url.PathEscape(base64.StdEncoding.EncodeToString(bytes)))
+}
+
+func TestCRLChecker(t *testing.T) {
+
+	Convey("When CRLChecker", t, func() {
+
+		authority := identitytest.MustAuthority("NauTLS (Root)", t)
+		registry := identities.NewRevocationRegistry(authority)
+		revoked := MustLeaf(authority, "revoked.nautls.com", t)
+		valid := MustLeaf(authority, "valid.nautls.com", t)
+
+		if err := registry.RevokeCertificate(revoked.Certificate, identities.KeyCompromise); err != nil {
+			t.Fatalf("error revoking certificate [%s]", err.Error())
+		}
+
+		Convey(".NewCRLChecker is invoked", func() {
+
+			Convey("with an invalid resource", func() {
+
+				checker, err := NewCRLChecker([]string{Base64URL([]byte("invalid"))}, FailClosed)
+
+				Convey("it returns a nil checker", func() {
+					So(checker, ShouldBeNil)
+				})
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("with an invalid policy", func() {
+
+				_, err := NewCRLChecker([]string{Base64URL(MustCurrentCRL(registry, t))}, Policy(42))
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey(".Check is invoked", func() {
+
+			Convey("with a current crl", func() {
+
+				checker, err := NewCRLChecker([]string{Base64URL(MustCurrentCRL(registry, t))}, FailClosed)
+				So(err, ShouldBeNil)
+
+				Convey("on a revoked certificate", func() {
+
+					err := checker.Check([]*x509.Certificate{revoked.Certificate, authority.Certificate})
+
+					Convey("it returns an error describing the revocation", func() {
+						So(err.Error(), ShouldContainSubstring, "was revoked")
+					})
+				})
+
+				Convey("on a valid certificate", func() {
+
+					err := checker.Check([]*x509.Certificate{valid.Certificate, authority.Certificate})
+
+					Convey("it returns a nil error", func() {
+						So(err, ShouldBeNil)
+					})
+				})
+
+				Convey("on a certificate from an issuer without a crl", func() {
+
+					other := identitytest.MustAuthority("NauTLS (Other)", t)
+					err := checker.Check([]*x509.Certificate{MustLeaf(other, "nautls.com", t).Certificate, other.Certificate})
+
+					Convey("it returns a nil error", func() {
+						So(err, ShouldBeNil)
+					})
+				})
+			})
+
+			Convey("with a crl whose signature does not verify", func() {
+
+				impostor := identitytest.MustAuthority("NauTLS (Root)", t)
+				checker, err := NewCRLChecker([]string{Base64URL(MustCurrentCRL(identities.NewRevocationRegistry(impostor), t))}, FailOpen)
+				So(err, ShouldBeNil)
+
+				err = checker.Check([]*x509.Certificate{valid.Certificate, authority.Certificate})
+
+				Convey("it returns an error describing the signature failure", func() {
+					So(err.Error(), ShouldContainSubstring, "valid signature")
+				})
+			})
+
+			Convey("with a stale crl", func() {
+
+				resource := Base64URL(MustStaleCRL(registry, t))
+
+				Convey("and a fail closed policy", func() {
+
+					checker, err := NewCRLChecker([]string{resource}, FailClosed)
+					So(err, ShouldBeNil)
+
+					err = checker.Check([]*x509.Certificate{valid.Certificate, authority.Certificate})
+
+					Convey("it returns an error describing the stale crl", func() {
+						So(err.Error(), ShouldContainSubstring, "is stale")
+					})
+				})
+
+				Convey("and a fail open policy", func() {
+
+					checker, err := NewCRLChecker([]string{resource}, FailOpen)
+					So(err, ShouldBeNil)
+
+					Convey("on a valid certificate", func() {
+
+						err := checker.Check([]*x509.Certificate{valid.Certificate, authority.Certificate})
+
+						Convey("it returns a nil error", func() {
+							So(err, ShouldBeNil)
+						})
+					})
+
+					Convey("on a revoked certificate", func() {
+
+						err := checker.Check([]*x509.Certificate{revoked.Certificate, authority.Certificate})
+
+						Convey("it returns a non-nil error", func() {
+							So(err, ShouldNotBeNil)
+						})
+					})
+				})
+			})
+
+			Convey("with a stale crl that is updated", func() {
+
+				var before, after error
+
+				temporary.WithDirectory(func(directory string) (interface{}, error) {
+
+					path := filepath.Join(directory, "root.crl")
+
+					if err := ioutil.WriteFile(path, MustStaleCRL(registry, t), 0644); err != nil {
+						t.Fatalf("error writing crl [%s]", err.Error())
+					}
+
+					checker, err := NewCRLChecker([]string{fmt.Sprintf("file://%s", path)}, FailClosed)
+					if err != nil {
+						t.Fatalf("error creating checker [%s]", err.Error())
+					}
+
+					checker.interval = 0
+
+					before = checker.Check([]*x509.Certificate{valid.Certificate, authority.Certificate})
+
+					if err := ioutil.WriteFile(path, MustCurrentCRL(registry, t), 0644); err != nil {
+						t.Fatalf("error writing crl [%s]", err.Error())
+					}
+
+					after = MustEventually(func() error {
+						return checker.Check([]*x509.Certificate{valid.Certificate, authority.Certificate})
+					}, t)
+
+					return nil, nil
+				})
+
+				Convey("it rejects certificates before the update", func() {
+					So(before, ShouldNotBeNil)
+				})
+
+				Convey("it accepts certificates after the update is loaded in the background", func() {
+					So(after, ShouldBeNil)
+				})
+			})
+
+			Convey("with a stale crl whose resource does not respond", func() {
+
+				crl := MustStaleCRL(registry, t)
+				release := make(chan struct{})
+				requests := make(chan struct{}, 16)
+
+				server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+					if request.Method != http.MethodGet {
+						return
+					}
+					requests <- struct{}{}
+					if len(requests) > 1 {
+						<-release
+					}
+					writer.Write(crl)
+				}))
+				defer server.Close()
+				defer close(release)
+
+				checker, err := NewCRLChecker([]string{server.URL + "/root.crl"}, FailOpen)
+				So(err, ShouldBeNil)
+
+				started := time.Now()
+
+				first := checker.Check([]*x509.Certificate{revoked.Certificate, authority.Certificate})
+				second := checker.Check([]*x509.Certificate{valid.Certificate, authority.Certificate})
+
+				elapsed := time.Since(started)
+
+				Convey("it checks against the last crl loaded without waiting for the resource", func() {
+					So(first, ShouldNotBeNil)
+					So(second, ShouldBeNil)
+					So(elapsed, ShouldBeLessThan, time.Second)
+				})
+
+				Convey("it reloads the crl at most once per retry interval", func() {
+					time.Sleep(100 * time.Millisecond)
+					So(len(requests), ShouldEqual, 2)
+				})
+			})
+		})
+
+		Convey(".VerifyPeerCertificate is invoked", func() {
+
+			checker, err := NewCRLChecker([]string{Base64URL(MustCurrentCRL(registry, t))}, FailClosed)
+			So(err, ShouldBeNil)
+
+			Convey("without verified chains", func() {
+
+				err := checker.VerifyPeerCertificate(nil, nil)
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("during a handshake", func() {
+
+				handshake := func(client *identities.Identity) error {
+
+					serverCertificate, err := valid.TLSCertificate()
+					So(err, ShouldBeNil)
+
+					clientCertificate, err := client.TLSCertificate()
+					So(err, ShouldBeNil)
+
+					listener, err := net.Listen("tcp", "127.0.0.1:0")
+					So(err, ShouldBeNil)
+					defer listener.Close()
+
+					go func() {
+						connection, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{
+							Certificates: []tls.Certificate{clientCertificate},
+							RootCAs:      authority.TrustPool(),
+							ServerName:   "valid.nautls.com",
+						})
+						if err == nil {
+							ioutil.ReadAll(connection)
+							connection.Close()
+						}
+					}()
+
+					connection, err := listener.Accept()
+					So(err, ShouldBeNil)
+					defer connection.Close()
+
+					return tls.Server(connection, &tls.Config{
+						Certificates:          []tls.Certificate{serverCertificate},
+						ClientAuth:            tls.RequireAndVerifyClientCert,
+						ClientCAs:             authority.TrustPool(),
+						VerifyPeerCertificate: checker.VerifyPeerCertificate,
+					}).Handshake()
+				}
+
+				Convey("with a revoked client", func() {
+
+					err := handshake(revoked)
+
+					Convey("it rejects the client", func() {
+						So(err, ShouldNotBeNil)
+					})
+				})
+
+				Convey("with a valid client", func() {
+
+					err := handshake(valid)
+
+					Convey("it accepts the client", func() {
+						So(err, ShouldBeNil)
+					})
+				})
+			})
+		})
+	})
+}
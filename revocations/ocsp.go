@@ -0,0 +1,97 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revocations
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+
+	// maximumResponseSize defines the maximum size in bytes of an OCSP response read from a responder.
+	maximumResponseSize = 1024 * 1024
+
+	// ocspSkew defines the tolerated clock skew between a responder and the local system.
+	ocspSkew = 5 * time.Minute
+
+	// ocspTimeout defines the timeout of requests to OCSP responders.
+	ocspTimeout = 10 * time.Second
+)
+
+// fetchOCSP requests the OCSP response for a certificate from a responder URL and returns the verified response and its
+// DER encoding.
+func fetchOCSP(client *http.Client, responder string, certificate *x509.Certificate, issuer *x509.Certificate) (*ocsp.Response, []byte, error) {
+
+	request, err := ocsp.CreateRequest(certificate, issuer, nil)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error creating ocsp request for [%s]", certificate.Subject.CommonName)
+	}
+
+	response, err := client.Post(responder, "application/ocsp-request", bytes.NewReader(request))
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error requesting ocsp response for [%s] from [%s]", certificate.Subject.CommonName, responder)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected status [%d] requesting ocsp response for [%s] from [%s]", response.StatusCode, certificate.Subject.CommonName, responder)
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, response.Body, maximumResponseSize))
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error reading ocsp response for [%s] from [%s]", certificate.Subject.CommonName, responder)
+	}
+
+	parsed, err := parseOCSP(body, certificate, issuer)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error verifying ocsp response for [%s] from [%s]", certificate.Subject.CommonName, responder)
+	}
+
+	return parsed, body, nil
+}
+
+// parseOCSP parses a DER encoded OCSP response for a certificate and verifies that it was signed by the issuer or by a
+// delegated signer that was issued by the issuer for OCSP signing. An error is returned if the response is not current.
+func parseOCSP(response []byte, certificate *x509.Certificate, issuer *x509.Certificate) (*ocsp.Response, error) {
+
+	parsed, err := ocsp.ParseResponseForCert(response, certificate, issuer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing ocsp response for [%s]", certificate.Subject.CommonName)
+	}
+
+	if parsed.Certificate != nil && !parsed.Certificate.Equal(issuer) && !permitsOCSPSigning(parsed.Certificate) {
+		return nil, fmt.Errorf("ocsp response for [%s] was signed by [%s] which does not permit ocsp signing", certificate.Subject.CommonName, parsed.Certificate.Subject.CommonName)
+	}
+
+	now := time.Now()
+
+	if parsed.ThisUpdate.After(now.Add(ocspSkew)) {
+		return nil, fmt.Errorf("ocsp response for [%s] is not yet valid", certificate.Subject.CommonName)
+	}
+
+	if !parsed.NextUpdate.IsZero() && now.After(parsed.NextUpdate) {
+		return nil, fmt.Errorf("ocsp response for [%s] expired at [%s]", certificate.Subject.CommonName, parsed.NextUpdate.Format(time.RFC3339))
+	}
+
+	return parsed, nil
+}
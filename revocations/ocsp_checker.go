@@ -0,0 +1,228 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revocations
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+)
+
+var (
+	// oidTLSFeature defines the TLS feature extension of RFC 7633 (i.e., OCSP must-staple).
+	oidTLSFeature = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+)
+
+const (
+
+	// maximumCacheSize defines the maximum number of responses cached by an OCSPChecker.
+	maximumCacheSize = 1024
+
+	// statusRequest defines the status_request TLS extension listed by must-staple certificates.
+	statusRequest = 5
+)
+
+// OCSPChecker verifies the OCSP status of peer certificates. A stapled response is preferred and, if none is
+// provided, the first OCSP server of the certificate is queried. Responses are cached until their next update. Note
+// that only the leaf certificate of the peer is checked and that certificates with the must-staple extension (RFC 7633)
+// require a stapled response regardless of the mode.
+type OCSPChecker struct {
+	cache  map[string]*ocsp.Response
+	client *http.Client
+	mode   OCSPMode
+	mutex  sync.Mutex
+}
+
+// NewOCSPChecker returns a new OCSPChecker for a mode.
+func NewOCSPChecker(mode OCSPMode) (*OCSPChecker, error) {
+
+	if _, err := mode.ToString(); err != nil {
+		return nil, errors.Wrap(err, "error creating ocsp checker")
+	}
+
+	checker := &OCSPChecker{
+		cache:  map[string]*ocsp.Response{},
+		client: &http.Client{Timeout: ocspTimeout},
+		mode:   mode,
+	}
+
+	return checker, nil
+}
+
+// VerifyConnection implements the tls.Config VerifyConnection callback. Note that there is nothing to check if the
+// peer certificate was not verified.
+func (c *OCSPChecker) VerifyConnection(state tls.ConnectionState) error {
+
+	for _, chain := range state.VerifiedChains {
+		if len(chain) > 1 {
+			return c.Check(chain[0], chain[1], state.OCSPResponse)
+		}
+	}
+
+	return nil
+}
+
+// Check verifies the OCSP status of a certificate issued by an issuer using the stapled response if it is not empty.
+func (c *OCSPChecker) Check(certificate *x509.Certificate, issuer *x509.Certificate, staple []byte) error {
+
+	if c.mode == OCSPDisabled {
+		return nil
+	}
+
+	response, err := c.response(certificate, issuer, staple)
+	if err != nil {
+		if c.mode == OCSPSoftFail && len(staple) == 0 && !mustStaple(certificate) {
+			return nil
+		}
+		return errors.Wrapf(err, "error determining ocsp status of [%s]", certificate.Subject.CommonName)
+	}
+
+	switch response.Status {
+	case ocsp.Good:
+		return nil
+	case ocsp.Revoked:
+		return fmt.Errorf("certificate [%s] for [%s] was revoked at [%s]", certificate.SerialNumber, certificate.Subject.CommonName, response.RevokedAt.Format(time.RFC3339))
+	default:
+		if c.mode == OCSPSoftFail {
+			return nil
+		}
+		return fmt.Errorf("ocsp status of [%s] is unknown", certificate.Subject.CommonName)
+	}
+}
+
+// response returns the verified OCSP response for a certificate from the staple, the cache or the responder of the
+// certificate in that order of preference.
+func (c *OCSPChecker) response(certificate *x509.Certificate, issuer *x509.Certificate, staple []byte) (*ocsp.Response, error) {
+
+	key := fmt.Sprintf("%x/%s", issuer.RawSubjectPublicKeyInfo, certificate.SerialNumber)
+
+	if len(staple) > 0 {
+
+		response, err := parseOCSP(staple, certificate, issuer)
+		if err != nil {
+			return nil, errors.Wrap(err, "error verifying stapled ocsp response")
+		}
+
+		c.store(key, response)
+
+		return response, nil
+	}
+
+	if c.mode == OCSPMustStaple || mustStaple(certificate) {
+		return nil, errors.New("no stapled ocsp response was provided")
+	}
+
+	if response := c.load(key); response != nil {
+		return response, nil
+	}
+
+	if len(certificate.OCSPServer) == 0 {
+		return nil, errors.New("certificate does not define an ocsp server")
+	}
+
+	response, _, err := fetchOCSP(c.client, certificate.OCSPServer[0], certificate, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	c.store(key, response)
+
+	return response, nil
+}
+
+// load returns the cached response for a key if it has not passed its next update.
+func (c *OCSPChecker) load(key string) *ocsp.Response {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	response, ok := c.cache[key]
+	if !ok {
+		return nil
+	}
+
+	if time.Now().After(response.NextUpdate) {
+		delete(c.cache, key)
+		return nil
+	}
+
+	return response
+}
+
+// store caches a response for a key until its next update. Expired responses are removed and, if the cache is full,
+// the response closest to its next update is evicted. Note that responses without a next update are not cached.
+func (c *OCSPChecker) store(key string, response *ocsp.Response) {
+
+	if response.NextUpdate.IsZero() {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+
+	for cached, value := range c.cache {
+		if now.After(value.NextUpdate) {
+			delete(c.cache, cached)
+		}
+	}
+
+	if _, ok := c.cache[key]; !ok && len(c.cache) >= maximumCacheSize {
+
+		var oldest string
+
+		for cached, value := range c.cache {
+			if oldest == "" || value.NextUpdate.Before(c.cache[oldest].NextUpdate) {
+				oldest = cached
+			}
+		}
+
+		delete(c.cache, oldest)
+	}
+
+	c.cache[key] = response
+}
+
+// mustStaple returns a value indicating whether a certificate requires a stapled OCSP response (RFC 7633).
+func mustStaple(certificate *x509.Certificate) bool {
+
+	for _, extension := range certificate.Extensions {
+
+		if !extension.Id.Equal(oidTLSFeature) {
+			continue
+		}
+
+		var features []int
+		if _, err := asn1.Unmarshal(extension.Value, &features); err != nil {
+			return false
+		}
+
+		for _, feature := range features {
+			if feature == statusRequest {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,347 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revocations
+
+import (
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/deciphernow/nautls/identities"
+	"github.com/deciphernow/nautls/internal/tests/identitytest"
+	"golang.org/x/crypto/ocsp"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// MustOCSPLeaf issues a server certificate that names an OCSP server from an authority or fails the test.
+func MustOCSPLeaf(authority *identities.Identity, server string, extensions []pkix.Extension, t *testing.T) *identities.Identity {
+
+	template, err := identities.ServerTemplate([]string{"nautls.com"}, nil)
+	if err != nil {
+		t.Fatalf("error creating template [%s]", err.Error())
+	}
+
+	template.ExtraExtensions = extensions
+	template.OCSPServer = []string{server}
+
+	leaf, err := authority.Issue(template, identities.ECDSA, 256)
+	if err != nil {
+		t.Fatalf("error issuing leaf [%s]", err.Error())
+	}
+
+	return leaf
+}
+
+// MustStaple returns an OCSP response for a certificate from a responder or fails the test.
+func MustStaple(responder *Responder, leaf *identities.Identity, authority *identities.Identity, t *testing.T) []byte {
+
+	response, expires := responder.Respond(MustOCSPRequest(leaf, authority, 0, t))
+	if expires.IsZero() {
+		t.Fatalf("error creating ocsp response")
+	}
+
+	return response
+}
+
+// MustOCSPChecker returns an OCSPChecker for a mode or fails the test.
+func MustOCSPChecker(mode OCSPMode, t *testing.T) *OCSPChecker {
+
+	checker, err := NewOCSPChecker(mode)
+	if err != nil {
+		t.Fatalf("error creating ocsp checker [%s]", err.Error())
+	}
+
+	return checker
+}
+
+func TestOCSPChecker(t *testing.T) {
+
+	Convey("When OCSPChecker", t, func() {
+
+		authority := identitytest.MustAuthority("NauTLS (Root)", t)
+		registry := identities.NewRevocationRegistry(authority)
+		issued := &Issued{}
+
+		responder, err := NewResponder(registry, issued.Lookup, nil, time.Hour)
+		So(err, ShouldBeNil)
+
+		server := httptest.NewServer(responder)
+		defer server.Close()
+
+		valid := issued.Add(MustOCSPLeaf(authority, server.URL, nil, t))
+		revoked := issued.Add(MustOCSPLeaf(authority, server.URL, nil, t))
+
+		if err := registry.RevokeCertificate(revoked.Certificate, identities.KeyCompromise); err != nil {
+			t.Fatalf("error revoking certificate [%s]", err.Error())
+		}
+
+		Convey(".NewOCSPChecker is invoked with an invalid mode", func() {
+
+			_, err := NewOCSPChecker(OCSPMode(42))
+
+			Convey("it returns a non-nil error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey(".Check is invoked", func() {
+
+			Convey("in disabled mode", func() {
+
+				err := MustOCSPChecker(OCSPDisabled, t).Check(revoked.Certificate, authority.Certificate, nil)
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("in soft fail mode", func() {
+
+				checker := MustOCSPChecker(OCSPSoftFail, t)
+
+				Convey("on a good certificate", func() {
+
+					err := checker.Check(valid.Certificate, authority.Certificate, nil)
+
+					Convey("it returns a nil error", func() {
+						So(err, ShouldBeNil)
+					})
+				})
+
+				Convey("on a revoked certificate", func() {
+
+					err := checker.Check(revoked.Certificate, authority.Certificate, nil)
+
+					Convey("it returns an error describing the revocation", func() {
+						So(err.Error(), ShouldContainSubstring, "was revoked")
+					})
+				})
+
+				Convey("with an unavailable responder", func() {
+
+					server.Close()
+					err := checker.Check(revoked.Certificate, authority.Certificate, nil)
+
+					Convey("it returns a nil error", func() {
+						So(err, ShouldBeNil)
+					})
+				})
+
+				Convey("with an invalid staple", func() {
+
+					err := checker.Check(valid.Certificate, authority.Certificate, []byte("invalid"))
+
+					Convey("it returns a non-nil error", func() {
+						So(err, ShouldNotBeNil)
+					})
+				})
+
+				Convey("on a must staple certificate without a staple", func() {
+
+					features, err := asn1.Marshal([]int{5})
+					So(err, ShouldBeNil)
+
+					leaf := issued.Add(MustOCSPLeaf(authority, server.URL, []pkix.Extension{{Id: oidTLSFeature, Value: features}}, t))
+					err = checker.Check(leaf.Certificate, authority.Certificate, nil)
+
+					Convey("it returns an error describing the missing staple", func() {
+						So(err.Error(), ShouldContainSubstring, "no stapled ocsp response")
+					})
+				})
+			})
+
+			Convey("in hard fail mode", func() {
+
+				checker := MustOCSPChecker(OCSPHardFail, t)
+
+				Convey("with an unavailable responder", func() {
+
+					server.Close()
+					err := checker.Check(valid.Certificate, authority.Certificate, nil)
+
+					Convey("it returns a non-nil error", func() {
+						So(err, ShouldNotBeNil)
+					})
+				})
+
+				Convey("with a cached response and an unavailable responder", func() {
+
+					So(checker.Check(valid.Certificate, authority.Certificate, nil), ShouldBeNil)
+
+					server.Close()
+					err := checker.Check(valid.Certificate, authority.Certificate, nil)
+
+					Convey("it returns a nil error", func() {
+						So(err, ShouldBeNil)
+					})
+				})
+
+				Convey("on a certificate without an ocsp server", func() {
+
+					err := checker.Check(MustLeaf(authority, "nautls.com", t).Certificate, authority.Certificate, nil)
+
+					Convey("it returns a non-nil error", func() {
+						So(err, ShouldNotBeNil)
+					})
+				})
+			})
+
+			Convey("in must staple mode", func() {
+
+				checker := MustOCSPChecker(OCSPMustStaple, t)
+
+				Convey("without a staple", func() {
+
+					err := checker.Check(valid.Certificate, authority.Certificate, nil)
+
+					Convey("it returns a non-nil error", func() {
+						So(err, ShouldNotBeNil)
+					})
+				})
+
+				Convey("with a good staple", func() {
+
+					err := checker.Check(valid.Certificate, authority.Certificate, MustStaple(responder, valid, authority, t))
+
+					Convey("it returns a nil error", func() {
+						So(err, ShouldBeNil)
+					})
+				})
+
+				Convey("with a revoked staple", func() {
+
+					err := checker.Check(revoked.Certificate, authority.Certificate, MustStaple(responder, revoked, authority, t))
+
+					Convey("it returns a non-nil error", func() {
+						So(err, ShouldNotBeNil)
+					})
+				})
+
+				Convey("with a staple for another certificate", func() {
+
+					err := checker.Check(valid.Certificate, authority.Certificate, MustStaple(responder, revoked, authority, t))
+
+					Convey("it returns a non-nil error", func() {
+						So(err, ShouldNotBeNil)
+					})
+				})
+			})
+		})
+
+		Convey(".store is invoked", func() {
+
+			checker := MustOCSPChecker(OCSPHardFail, t)
+			now := time.Now()
+
+			Convey("with expired responses in the cache", func() {
+
+				checker.cache["expired"] = &ocsp.Response{NextUpdate: now.Add(-time.Minute)}
+				checker.store("current", &ocsp.Response{NextUpdate: now.Add(time.Hour)})
+
+				Convey("it removes the expired responses", func() {
+					So(checker.cache, ShouldHaveLength, 1)
+					So(checker.cache, ShouldContainKey, "current")
+				})
+			})
+
+			Convey("with a full cache", func() {
+
+				for index := 0; index < maximumCacheSize; index++ {
+					checker.cache[fmt.Sprintf("%d", index)] = &ocsp.Response{NextUpdate: now.Add(time.Duration(index+1) * time.Minute)}
+				}
+
+				checker.store("current", &ocsp.Response{NextUpdate: now.Add(time.Hour)})
+
+				Convey("it evicts the response closest to its next update", func() {
+					So(checker.cache, ShouldHaveLength, maximumCacheSize)
+					So(checker.cache, ShouldContainKey, "current")
+					So(checker.cache, ShouldNotContainKey, "0")
+				})
+			})
+		})
+
+		Convey(".VerifyConnection is invoked during a handshake", func() {
+
+			handshake := func(leaf *identities.Identity, mode OCSPMode) error {
+
+				certificate, err := leaf.TLSCertificate()
+				So(err, ShouldBeNil)
+
+				stapler, err := NewStapler(certificate, authority.Certificate, "", nil)
+				So(err, ShouldBeNil)
+				defer stapler.Stop()
+				stapler.Start()
+
+				listener, err := net.Listen("tcp", "127.0.0.1:0")
+				So(err, ShouldBeNil)
+				defer listener.Close()
+
+				go func() {
+					connection, err := listener.Accept()
+					if err == nil {
+						tls.Server(connection, &tls.Config{GetCertificate: GetCertificate([]*Stapler{stapler})}).Handshake()
+						ioutil.ReadAll(connection)
+						connection.Close()
+					}
+				}()
+
+				connection, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{
+					RootCAs:          authority.TrustPool(),
+					ServerName:       "nautls.com",
+					VerifyConnection: MustOCSPChecker(mode, t).VerifyConnection,
+				})
+				if err == nil {
+					connection.Close()
+				}
+
+				return err
+			}
+
+			Convey("with a good stapled certificate", func() {
+
+				err := handshake(valid, OCSPMustStaple)
+
+				Convey("it accepts the server", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("with a revoked stapled certificate", func() {
+
+				err := handshake(revoked, OCSPSoftFail)
+
+				Convey("it rejects the server", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("without verified chains", func() {
+
+				err := MustOCSPChecker(OCSPHardFail, t).VerifyConnection(tls.ConnectionState{})
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,150 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revocations
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+// OCSPMode defines how the OCSP status of peer certificates is checked.
+type OCSPMode int
+
+const (
+
+	// OCSPDisabled disables OCSP checking.
+	OCSPDisabled OCSPMode = iota
+
+	// OCSPSoftFail rejects certificates reported as revoked but accepts certificates whose status cannot be determined
+	// (e.g., when the responder is unavailable).
+	OCSPSoftFail
+
+	// OCSPHardFail rejects certificates that are not reported as good.
+	OCSPHardFail
+
+	// OCSPMustStaple rejects certificates that are not reported as good by a stapled response.
+	OCSPMustStaple
+)
+
+// MarshalJSON implements the json.Marshaler interface for OCSPMode instances.
+func (m OCSPMode) MarshalJSON() ([]byte, error) {
+
+	value, err := m.ToString()
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshalling ocsp mode to json")
+	}
+
+	return json.Marshal(value)
+}
+
+// MarshalYAML implements the yaml.Marshaler interface for OCSPMode instances.
+func (m OCSPMode) MarshalYAML() (interface{}, error) {
+	return m.ToString()
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for OCSPMode instances.
+func (m *OCSPMode) UnmarshalJSON(bytes []byte) error {
+
+	var value string
+
+	err := json.Unmarshal(bytes, &value)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling ocsp mode from json")
+	}
+
+	return m.FromString(value)
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for OCSPMode instances.
+func (m *OCSPMode) UnmarshalYAML(unmarshal func(interface{}) error) error {
+
+	var value string
+
+	err := unmarshal(&value)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling ocsp mode from yaml")
+	}
+
+	return m.FromString(value)
+}
+
+// FromString sets the value of an ocsp mode to the value represented by a string or errors.
+func (m *OCSPMode) FromString(value string) error {
+
+	var mode OCSPMode
+
+	switch strings.ToLower(value) {
+	case "disabled":
+		mode = OCSPDisabled
+	case "softfail":
+		mode = OCSPSoftFail
+	case "hardfail":
+		mode = OCSPHardFail
+	case "muststaple":
+		mode = OCSPMustStaple
+	default:
+		return fmt.Errorf("error unmarshalling unknown ocsp mode value [%s]", value)
+	}
+
+	*m = mode
+
+	return nil
+}
+
+// ToString returns the string representation of the ocsp mode or an error.
+func (m OCSPMode) ToString() (string, error) {
+
+	switch m {
+	case OCSPDisabled:
+		return "Disabled", nil
+	case OCSPSoftFail:
+		return "SoftFail", nil
+	case OCSPHardFail:
+		return "HardFail", nil
+	case OCSPMustStaple:
+		return "MustStaple", nil
+	default:
+		return "", fmt.Errorf("error converting unknown ocsp mode value to string [%d]", m)
+	}
+}
+
+// StringToOCSPMode returns a mapstructure.DecodeHookFunc that converts a string to an ocsp mode.
+func StringToOCSPMode() mapstructure.DecodeHookFunc {
+
+	return func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+
+		if from != reflect.TypeOf("") {
+			return data, nil
+		}
+
+		if to != reflect.TypeOf(OCSPMode(0)) {
+			return data, nil
+		}
+
+		var mode OCSPMode
+
+		err := mode.FromString(data.(string))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error decoding string as ocsp mode")
+		}
+
+		return mode, nil
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revocations
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+// Policy defines how revocation checking behaves when current revocation information is unavailable (e.g., a CRL has
+// passed its next update).
+type Policy int
+
+const (
+
+	// FailClosed rejects certificates whose revocation status cannot be determined from current information.
+	FailClosed Policy = iota
+
+	// FailOpen accepts certificates whose revocation status cannot be determined from current information. Note that
+	// certificates listed as revoked by stale information are still rejected.
+	FailOpen
+)
+
+// MarshalJSON implements the json.Marshaler interface for Policy instances.
+func (p Policy) MarshalJSON() ([]byte, error) {
+
+	value, err := p.ToString()
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshalling policy to json")
+	}
+
+	return json.Marshal(value)
+}
+
+// MarshalYAML implements the yaml.Marshaler interface for Policy instances.
+func (p Policy) MarshalYAML() (interface{}, error) {
+	return p.ToString()
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for Policy instances.
+func (p *Policy) UnmarshalJSON(bytes []byte) error {
+
+	var value string
+
+	err := json.Unmarshal(bytes, &value)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling policy from json")
+	}
+
+	return p.FromString(value)
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for Policy instances.
+func (p *Policy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+
+	var value string
+
+	err := unmarshal(&value)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling policy from yaml")
+	}
+
+	return p.FromString(value)
+}
+
+// FromString sets the value of a policy to the value represented by a string or errors.
+func (p *Policy) FromString(value string) error {
+
+	var policy Policy
+
+	switch strings.ToLower(value) {
+	case "failclosed":
+		policy = FailClosed
+	case "failopen":
+		policy = FailOpen
+	default:
+		return fmt.Errorf("error unmarshalling unknown policy value [%s]", value)
+	}
+
+	*p = policy
+
+	return nil
+}
+
+// ToString returns the string representation of the policy or an error.
+func (p Policy) ToString() (string, error) {
+
+	switch p {
+	case FailClosed:
+		return "FailClosed", nil
+	case FailOpen:
+		return "FailOpen", nil
+	default:
+		return "", fmt.Errorf("error converting unknown policy value to string [%d]", p)
+	}
+}
+
+// StringToPolicy returns a mapstructure.DecodeHookFunc that converts a string to a policy.
+func StringToPolicy() mapstructure.DecodeHookFunc {
+
+	return func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+
+		if from != reflect.TypeOf("") {
+			return data, nil
+		}
+
+		if to != reflect.TypeOf(Policy(0)) {
+			return data, nil
+		}
+
+		var policy Policy
+
+		err := policy.FromString(data.(string))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error decoding string as policy")
+		}
+
+		return policy, nil
+	}
+}
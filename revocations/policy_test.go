@@ -0,0 +1,122 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revocations
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mitchellh/mapstructure"
+	"gopkg.in/yaml.v2"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPolicy(t *testing.T) {
+
+	Convey("When Policy", t, func() {
+
+		Convey(".MarshalJSON and .UnmarshalJSON are invoked", func() {
+
+			for _, expected := range []Policy{FailClosed, FailOpen} {
+
+				var actual Policy
+
+				bytes, err := json.Marshal(expected)
+				So(err, ShouldBeNil)
+
+				err = json.Unmarshal(bytes, &actual)
+				So(err, ShouldBeNil)
+
+				So(actual, ShouldEqual, expected)
+			}
+		})
+
+		Convey(".MarshalYAML and .UnmarshalYAML are invoked", func() {
+
+			for _, expected := range []Policy{FailClosed, FailOpen} {
+
+				var actual Policy
+
+				bytes, err := yaml.Marshal(expected)
+				So(err, ShouldBeNil)
+
+				err = yaml.Unmarshal(bytes, &actual)
+				So(err, ShouldBeNil)
+
+				So(actual, ShouldEqual, expected)
+			}
+		})
+
+		Convey(".MarshalJSON is invoked on an invalid value", func() {
+
+			bytes, err := json.Marshal(Policy(42))
+
+			Convey("it returns a non-nil error", func() {
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("it returns a nil byte slice", func() {
+				So(bytes, ShouldBeNil)
+			})
+		})
+
+		Convey(".UnmarshalYAML is invoked on an invalid string", func() {
+
+			var policy Policy
+			err := yaml.Unmarshal([]byte("FailSometimes"), &policy)
+
+			Convey("it returns a non-nil error", func() {
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("it returns a zero policy", func() {
+				So(policy, ShouldBeZeroValue)
+			})
+		})
+
+		Convey("#StringToPolicy is invoked", func() {
+
+			var actual Policy
+
+			decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{DecodeHook: StringToPolicy(), Result: &actual})
+			if err != nil {
+				t.Fatalf("error initializing decoder [%s]", err.Error())
+			}
+
+			Convey("with a valid policy", func() {
+
+				err := decoder.Decode("failopen")
+
+				Convey("it returns the policy", func() {
+					So(actual, ShouldEqual, FailOpen)
+				})
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("with an invalid policy", func() {
+
+				err := decoder.Decode("invalid")
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,235 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revocations
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/deciphernow/nautls/identities"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+
+	// maximumRequestSize defines the maximum size in bytes of an OCSP request accepted by a Responder.
+	maximumRequestSize = 10 * 1024
+)
+
+// Responder provides an http.Handler that answers RFC 6960 OCSP requests for certificates issued by an identity using
+// the revocations of its registry. Requests are accepted via POST with the DER encoded request as the body or via GET
+// with the base64 encoded request as the final component of the path (e.g., when mounted with http.StripPrefix).
+// Certificates that were issued and have not been revoked are reported as good while certificates that were not issued
+// (i.e., those the issued lookup does not report) are reported as unknown.
+type Responder struct {
+	issued   func(serial *big.Int) (bool, error)
+	issuer   *identities.Identity
+	registry *identities.RevocationRegistry
+	signer   *identities.Identity
+	validity time.Duration
+}
+
+// NewResponder returns a new Responder for the certificates issued by the issuing identity of a registry with responses
+// valid for the provided duration. The issued lookup reports whether a serial number was issued by the identity (e.g.,
+// authorities.Store.Issued) and must not be nil. Responses are signed by the signer which must either be nil (i.e., the
+// issuer signs responses) or a delegated identity issued by the issuer for OCSP signing (see identities.OCSPTemplate).
+// Note that responses may only be signed by RSA or ECDSA keys.
+func NewResponder(registry *identities.RevocationRegistry, issued func(serial *big.Int) (bool, error), signer *identities.Identity, validity time.Duration) (*Responder, error) {
+
+	issuer := registry.Issuer()
+
+	if issued == nil {
+		return nil, fmt.Errorf("error creating ocsp responder for [%s] without an issued lookup", issuer.Certificate.Subject.CommonName)
+	}
+
+	if validity <= 0 {
+		return nil, fmt.Errorf("error creating ocsp responder for [%s] with invalid validity [%s]", issuer.Certificate.Subject.CommonName, validity)
+	}
+
+	if signer == nil {
+		signer = issuer
+	}
+
+	if signer != issuer {
+
+		if err := signer.Certificate.CheckSignatureFrom(issuer.Certificate); err != nil {
+			return nil, errors.Wrapf(err, "ocsp signer [%s] was not issued by [%s]", signer.Certificate.Subject.CommonName, issuer.Certificate.Subject.CommonName)
+		}
+
+		if !permitsOCSPSigning(signer.Certificate) {
+			return nil, fmt.Errorf("ocsp signer [%s] does not permit ocsp signing", signer.Certificate.Subject.CommonName)
+		}
+	}
+
+	responder := &Responder{
+		issued:   issued,
+		issuer:   issuer,
+		registry: registry,
+		signer:   signer,
+		validity: validity,
+	}
+
+	return responder, nil
+}
+
+// ServeHTTP implements the http.Handler interface for Responder instances. Note that, as required by RFC 6960, OCSP
+// error responses (e.g., for malformed requests) are returned with an HTTP 200 status.
+func (r *Responder) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+
+	var body []byte
+	var err error
+
+	switch request.Method {
+	case http.MethodGet:
+		body, err = decodeGetRequest(request.URL)
+	case http.MethodPost:
+		body, err = ioutil.ReadAll(http.MaxBytesReader(writer, request.Body, maximumRequestSize))
+	default:
+		writer.Header().Set("Allow", "GET, POST")
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		writeResponse(writer, ocsp.MalformedRequestErrorResponse)
+		return
+	}
+
+	response, expires := r.Respond(body)
+
+	if request.Method == http.MethodGet && !expires.IsZero() {
+		writer.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d, public, no-transform, must-revalidate", int(time.Until(expires).Seconds())))
+		writer.Header().Set("Expires", expires.UTC().Format(http.TimeFormat))
+	}
+
+	writeResponse(writer, response)
+}
+
+// Respond returns the DER encoded OCSP response for a DER encoded OCSP request and the time at which the response
+// expires. Note that the expiration is zero for OCSP error responses (e.g., when the issued lookup fails).
+func (r *Responder) Respond(request []byte) ([]byte, time.Time) {
+
+	parsed, err := ocsp.ParseRequest(request)
+	if err != nil {
+		return ocsp.MalformedRequestErrorResponse, time.Time{}
+	}
+
+	if !issuedBy(parsed, r.issuer.Certificate) {
+		return ocsp.UnauthorizedErrorResponse, time.Time{}
+	}
+
+	issued, err := r.issued(parsed.SerialNumber)
+	if err != nil {
+		return ocsp.InternalErrorErrorResponse, time.Time{}
+	}
+
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	template := ocsp.Response{
+		IssuerHash:   parsed.HashAlgorithm,
+		NextUpdate:   now.Add(r.validity),
+		SerialNumber: parsed.SerialNumber,
+		Status:       ocsp.Good,
+		ThisUpdate:   now,
+	}
+
+	if !issued {
+		template.Status = ocsp.Unknown
+	}
+
+	for _, revocation := range r.registry.Revocations() {
+		if revocation.SerialNumber.Cmp(parsed.SerialNumber) == 0 {
+			template.Status = ocsp.Revoked
+			template.RevokedAt = revocation.RevokedAt
+			template.RevocationReason = int(revocation.Reason)
+		}
+	}
+
+	if r.signer != r.issuer {
+		template.Certificate = r.signer.Certificate
+	}
+
+	response, err := ocsp.CreateResponse(r.issuer.Certificate, r.signer.Certificate, template, r.signer.Key)
+	if err != nil {
+		return ocsp.InternalErrorErrorResponse, time.Time{}
+	}
+
+	return response, template.NextUpdate
+}
+
+// decodeGetRequest decodes the base64 encoded OCSP request from the path of a URL. The entire path is tried first as
+// the base64 alphabet includes the path separator and then only the final component of the path.
+func decodeGetRequest(resource *url.URL) ([]byte, error) {
+
+	path, err := url.PathUnescape(resource.EscapedPath())
+	if err != nil {
+		return nil, errors.Wrapf(err, "error unescaping ocsp request path [%s]", resource.EscapedPath())
+	}
+
+	path = strings.TrimPrefix(path, "/")
+
+	if request, err := base64.StdEncoding.DecodeString(path); err == nil {
+		return request, nil
+	}
+
+	request, err := base64.StdEncoding.DecodeString(path[strings.LastIndex(path, "/")+1:])
+	if err != nil {
+		return nil, errors.Wrapf(err, "error decoding ocsp request path [%s]", path)
+	}
+
+	return request, nil
+}
+
+// issuedBy returns a value indicating whether the issuer name and key hashes of an OCSP request match a certificate.
+func issuedBy(request *ocsp.Request, issuer *x509.Certificate) bool {
+
+	keyID, err := identities.SubjectKeyHash(issuer.PublicKey, request.HashAlgorithm)
+	if err != nil {
+		return false
+	}
+
+	hash := request.HashAlgorithm.New()
+	hash.Write(issuer.RawSubject)
+
+	return bytes.Equal(hash.Sum(nil), request.IssuerNameHash) && bytes.Equal(keyID, request.IssuerKeyHash)
+}
+
+// permitsOCSPSigning returns a value indicating whether a certificate permits OCSP signing.
+func permitsOCSPSigning(certificate *x509.Certificate) bool {
+
+	for _, usage := range certificate.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageOCSPSigning {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeResponse writes a DER encoded OCSP response.
+func writeResponse(writer http.ResponseWriter, response []byte) {
+	writer.Header().Set("Content-Type", "application/ocsp-response")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(response)
+}
@@ -0,0 +1,320 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revocations
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/deciphernow/nautls/identities"
+	"github.com/deciphernow/nautls/internal/tests/identitytest"
+	"golang.org/x/crypto/ocsp"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// Issued records the serial numbers of the certificates issued for responders under test.
+type Issued struct {
+	mutex   sync.Mutex
+	serials []*big.Int
+}
+
+// Add records the certificate of an identity as issued and returns the identity.
+func (i *Issued) Add(identity *identities.Identity) *identities.Identity {
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.serials = append(i.serials, identity.Certificate.SerialNumber)
+
+	return identity
+}
+
+// Lookup returns a value indicating whether a serial number has been recorded as issued.
+func (i *Issued) Lookup(serial *big.Int) (bool, error) {
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	for _, issued := range i.serials {
+		if issued.Cmp(serial) == 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// MustOCSPSigner issues a delegated OCSP signing identity from an authority or fails the test.
+func MustOCSPSigner(authority *identities.Identity, t *testing.T) *identities.Identity {
+
+	template, err := identities.OCSPTemplate("NauTLS (OCSP)")
+	if err != nil {
+		t.Fatalf("error creating template [%s]", err.Error())
+	}
+
+	signer, err := authority.Issue(template, identities.ECDSA, 256)
+	if err != nil {
+		t.Fatalf("error issuing ocsp signer [%s]", err.Error())
+	}
+
+	return signer
+}
+
+// MustOCSPRequest creates a DER encoded OCSP request for a certificate issued by an authority or fails the test.
+func MustOCSPRequest(leaf *identities.Identity, authority *identities.Identity, hash crypto.Hash, t *testing.T) []byte {
+
+	request, err := ocsp.CreateRequest(leaf.Certificate, authority.Certificate, &ocsp.RequestOptions{Hash: hash})
+	if err != nil {
+		t.Fatalf("error creating ocsp request [%s]", err.Error())
+	}
+
+	return request
+}
+
+// MustPost posts an OCSP request to a server and returns the response body or fails the test.
+func MustPost(server *httptest.Server, request []byte, t *testing.T) []byte {
+
+	response, err := http.Post(server.URL, "application/ocsp-request", bytes.NewReader(request))
+	if err != nil {
+		t.Fatalf("error posting ocsp request [%s]", err.Error())
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("error reading ocsp response [%s]", err.Error())
+	}
+
+	return body
+}
+
+func TestResponder(t *testing.T) {
+
+	Convey("When Responder", t, func() {
+
+		authority := identitytest.MustAuthority("NauTLS (Root)", t)
+		registry := identities.NewRevocationRegistry(authority)
+		issued := &Issued{}
+		revoked := issued.Add(MustLeaf(authority, "revoked.nautls.com", t))
+		valid := issued.Add(MustLeaf(authority, "valid.nautls.com", t))
+
+		if err := registry.RevokeCertificate(revoked.Certificate, identities.KeyCompromise); err != nil {
+			t.Fatalf("error revoking certificate [%s]", err.Error())
+		}
+
+		Convey(".NewResponder is invoked", func() {
+
+			Convey("with an invalid validity", func() {
+
+				_, err := NewResponder(registry, issued.Lookup, nil, 0)
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("without an issued lookup", func() {
+
+				_, err := NewResponder(registry, nil, nil, time.Hour)
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("with a signer that does not permit ocsp signing", func() {
+
+				_, err := NewResponder(registry, issued.Lookup, valid, time.Hour)
+
+				Convey("it returns an error describing the missing usage", func() {
+					So(err.Error(), ShouldContainSubstring, "does not permit ocsp signing")
+				})
+			})
+
+			Convey("with a signer issued by another authority", func() {
+
+				_, err := NewResponder(registry, issued.Lookup, MustOCSPSigner(identitytest.MustAuthority("NauTLS (Other)", t), t), time.Hour)
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey("is served by the issuer", func() {
+
+			responder, err := NewResponder(registry, issued.Lookup, nil, time.Hour)
+			So(err, ShouldBeNil)
+
+			server := httptest.NewServer(responder)
+			defer server.Close()
+
+			Convey("and a valid certificate is requested via post", func() {
+
+				response, err := ocsp.ParseResponseForCert(MustPost(server, MustOCSPRequest(valid, authority, crypto.SHA1, t), t), valid.Certificate, authority.Certificate)
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("it returns a good status", func() {
+					So(response.Status, ShouldEqual, ocsp.Good)
+				})
+
+				Convey("it returns the validity", func() {
+					So(response.NextUpdate.Sub(response.ThisUpdate), ShouldEqual, time.Hour)
+				})
+			})
+
+			Convey("and a revoked certificate is requested with sha256 hashes", func() {
+
+				response, err := ocsp.ParseResponseForCert(MustPost(server, MustOCSPRequest(revoked, authority, crypto.SHA256, t), t), revoked.Certificate, authority.Certificate)
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("it returns a revoked status with the reason", func() {
+					So(response.Status, ShouldEqual, ocsp.Revoked)
+					So(response.RevocationReason, ShouldEqual, ocsp.KeyCompromise)
+				})
+			})
+
+			Convey("and a certificate that was not issued is requested", func() {
+
+				unknown := MustLeaf(authority, "unknown.nautls.com", t)
+
+				response, err := ocsp.ParseResponseForCert(MustPost(server, MustOCSPRequest(unknown, authority, crypto.SHA1, t), t), unknown.Certificate, authority.Certificate)
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("it returns an unknown status", func() {
+					So(response.Status, ShouldEqual, ocsp.Unknown)
+				})
+			})
+
+			Convey("and a certificate is requested via get", func() {
+
+				request := base64.StdEncoding.EncodeToString(MustOCSPRequest(valid, authority, crypto.SHA1, t))
+
+				get, err := http.Get(server.URL + "/" + url.PathEscape(request))
+				So(err, ShouldBeNil)
+				defer get.Body.Close()
+
+				body, err := ioutil.ReadAll(get.Body)
+				So(err, ShouldBeNil)
+
+				response, err := ocsp.ParseResponseForCert(body, valid.Certificate, authority.Certificate)
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("it returns a good status", func() {
+					So(response.Status, ShouldEqual, ocsp.Good)
+				})
+
+				Convey("it returns caching headers", func() {
+					So(get.Header.Get("Content-Type"), ShouldEqual, "application/ocsp-response")
+					So(get.Header.Get("Cache-Control"), ShouldContainSubstring, "max-age=")
+				})
+			})
+
+			Convey("and a certificate from another issuer is requested", func() {
+
+				other := identitytest.MustAuthority("NauTLS (Other)", t)
+				_, err := ocsp.ParseResponse(MustPost(server, MustOCSPRequest(MustLeaf(other, "nautls.com", t), other, crypto.SHA1, t), t), nil)
+
+				Convey("it returns an unauthorized response", func() {
+					So(err, ShouldResemble, ocsp.ResponseError{Status: ocsp.Unauthorized})
+				})
+			})
+
+			Convey("and a malformed request is posted", func() {
+
+				_, err := ocsp.ParseResponse(MustPost(server, []byte("invalid"), t), nil)
+
+				Convey("it returns a malformed response", func() {
+					So(err, ShouldResemble, ocsp.ResponseError{Status: ocsp.Malformed})
+				})
+			})
+
+			Convey("and an unsupported method is used", func() {
+
+				request, err := http.NewRequest(http.MethodPut, server.URL, nil)
+				So(err, ShouldBeNil)
+
+				response, err := http.DefaultClient.Do(request)
+				So(err, ShouldBeNil)
+				response.Body.Close()
+
+				Convey("it returns method not allowed", func() {
+					So(response.StatusCode, ShouldEqual, http.StatusMethodNotAllowed)
+				})
+			})
+		})
+
+		Convey("is served with a failing issued lookup", func() {
+
+			responder, err := NewResponder(registry, func(serial *big.Int) (bool, error) { return false, fmt.Errorf("unavailable") }, nil, time.Hour)
+			So(err, ShouldBeNil)
+
+			response, expires := responder.Respond(MustOCSPRequest(valid, authority, crypto.SHA1, t))
+
+			Convey("it returns an internal error response", func() {
+				So(response, ShouldResemble, ocsp.InternalErrorErrorResponse)
+				So(expires.IsZero(), ShouldBeTrue)
+			})
+		})
+
+		Convey("is served by a delegated signer", func() {
+
+			signer := MustOCSPSigner(authority, t)
+
+			responder, err := NewResponder(registry, issued.Lookup, signer, time.Hour)
+			So(err, ShouldBeNil)
+
+			server := httptest.NewServer(responder)
+			defer server.Close()
+
+			response, err := ocsp.ParseResponseForCert(MustPost(server, MustOCSPRequest(revoked, authority, crypto.SHA1, t), t), revoked.Certificate, authority.Certificate)
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("it returns the signer certificate", func() {
+				So(response.Certificate.Equal(signer.Certificate), ShouldBeTrue)
+			})
+
+			Convey("it returns a revoked status", func() {
+				So(response.Status, ShouldEqual, ocsp.Revoked)
+			})
+		})
+	})
+}
@@ -0,0 +1,248 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revocations
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+
+	// staplerInterval defines how often responses without a next update are refreshed.
+	staplerInterval = time.Hour
+
+	// staplerRetry defines how long a Stapler waits before retrying a failed refresh.
+	staplerRetry = time.Minute
+)
+
+// Stapler maintains an OCSP response stapled to a tls.Certificate. The response is fetched from the responder when the
+// Stapler is started and refreshed in the background halfway between its this update and next update. Failed refreshes
+// are retried and, once the response expires, the certificate is served without a staple until a refresh succeeds.
+type Stapler struct {
+	certificate tls.Certificate
+	client      *http.Client
+	handler     func(error)
+	issuer      *x509.Certificate
+	leaf        *x509.Certificate
+	mutex       sync.RWMutex
+	responder   string
+	response    *ocsp.Response
+	stapled     tls.Certificate
+	stopped     bool
+	timer       *time.Timer
+}
+
+// NewStapler returns a new Stapler for a certificate issued by the issuer. The issuer is taken from the chain of the
+// certificate if it is nil, which requires the chain to include it (note that chains omit self signed roots such that
+// the issuer of a certificate issued by a root must be provided). The response is requested from the responder URL if
+// it is defined and otherwise from the first OCSP server of the certificate. Failures of background refreshes are passed
+// to the handler if it is not nil.
+func NewStapler(certificate tls.Certificate, issuer *x509.Certificate, responder string, handler func(error)) (*Stapler, error) {
+
+	if len(certificate.Certificate) == 0 {
+		return nil, errors.New("error creating ocsp stapler for an empty certificate")
+	}
+
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate for ocsp stapler")
+	}
+
+	if issuer == nil {
+
+		if len(certificate.Certificate) < 2 {
+			return nil, fmt.Errorf("error creating ocsp stapler for [%s] without an issuer", leaf.Subject.CommonName)
+		}
+
+		issuer, err = x509.ParseCertificate(certificate.Certificate[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing issuer of [%s] for ocsp stapler", leaf.Subject.CommonName)
+		}
+	}
+
+	if responder == "" {
+
+		if len(leaf.OCSPServer) == 0 {
+			return nil, fmt.Errorf("error creating ocsp stapler for [%s] without an ocsp server", leaf.Subject.CommonName)
+		}
+
+		responder = leaf.OCSPServer[0]
+	}
+
+	stapler := &Stapler{
+		certificate: certificate,
+		client:      &http.Client{Timeout: ocspTimeout},
+		handler:     handler,
+		issuer:      issuer,
+		leaf:        leaf,
+		responder:   responder,
+		stapled:     certificate,
+	}
+
+	return stapler, nil
+}
+
+// Start fetches the initial response and schedules the background refreshes. An error is returned, and no refreshes are
+// scheduled, if the initial response cannot be fetched or reports that the certificate is not good.
+func (s *Stapler) Start() error {
+
+	if err := s.Refresh(); err != nil {
+		return err
+	}
+
+	s.schedule(s.refreshDelay())
+
+	return nil
+}
+
+// Stop cancels the background refreshes of the Stapler.
+func (s *Stapler) Stop() {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.stopped = true
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+}
+
+// Stopped returns a value indicating whether the background refreshes of the Stapler have been stopped.
+func (s *Stapler) Stopped() bool {
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.stopped
+}
+
+// Refresh fetches a response from the responder and staples it to the certificate. Note that a verified response is
+// stapled even if the certificate is not good so that clients are informed of the revocation, but an error is still
+// returned.
+func (s *Stapler) Refresh() error {
+
+	response, bytes, err := fetchOCSP(s.client, s.responder, s.leaf, s.issuer)
+	if err != nil {
+		return errors.Wrapf(err, "error refreshing ocsp staple for [%s]", s.leaf.Subject.CommonName)
+	}
+
+	stapled := s.certificate
+	stapled.OCSPStaple = bytes
+
+	s.mutex.Lock()
+	s.response = response
+	s.stapled = stapled
+	s.mutex.Unlock()
+
+	if response.Status != ocsp.Good {
+		return fmt.Errorf("ocsp response for [%s] reports status [%d]", s.leaf.Subject.CommonName, response.Status)
+	}
+
+	return nil
+}
+
+// Certificate returns the certificate with the current response stapled or, if the response has expired, without a
+// staple.
+func (s *Stapler) Certificate() *tls.Certificate {
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.response == nil || (!s.response.NextUpdate.IsZero() && time.Now().After(s.response.NextUpdate)) {
+		certificate := s.certificate
+		return &certificate
+	}
+
+	stapled := s.stapled
+
+	return &stapled
+}
+
+// refreshDelay returns the duration until the current response should be refreshed.
+func (s *Stapler) refreshDelay() time.Duration {
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.response == nil || s.response.NextUpdate.IsZero() {
+		return staplerInterval
+	}
+
+	refresh := s.response.ThisUpdate.Add(s.response.NextUpdate.Sub(s.response.ThisUpdate) / 2)
+
+	if delay := time.Until(refresh); delay > 0 {
+		return delay
+	}
+
+	return staplerRetry
+}
+
+// schedule schedules a background refresh after a delay unless the Stapler has been stopped.
+func (s *Stapler) schedule(delay time.Duration) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stopped {
+		return
+	}
+
+	s.timer = time.AfterFunc(delay, s.run)
+}
+
+// run refreshes the response and schedules the next refresh reporting any failure to the handler.
+func (s *Stapler) run() {
+
+	if err := s.Refresh(); err != nil {
+		if s.handler != nil {
+			s.handler(err)
+		}
+		s.schedule(staplerRetry)
+		return
+	}
+
+	s.schedule(s.refreshDelay())
+}
+
+// GetCertificate returns a function suitable for the GetCertificate field of a tls.Config that serves the stapled
+// certificates of the staplers. The first certificate supported by the client is served and the certificate of the
+// first stapler is served if the client supports none of them.
+func GetCertificate(staplers []*Stapler) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+
+		if len(staplers) == 0 {
+			return nil, errors.New("no certificates available")
+		}
+
+		for _, stapler := range staplers {
+			certificate := stapler.Certificate()
+			if hello.SupportsCertificate(certificate) == nil {
+				return certificate, nil
+			}
+		}
+
+		return staplers[0].Certificate(), nil
+	}
+}
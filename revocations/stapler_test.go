@@ -0,0 +1,244 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package revocations
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/deciphernow/nautls/identities"
+	"github.com/deciphernow/nautls/internal/tests/identitytest"
+	"golang.org/x/crypto/ocsp"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// MustStapledLeaf issues a server certificate that names an OCSP server from an authority and records it as issued or
+// fails the test.
+func MustStapledLeaf(authority *identities.Identity, issued *Issued, name string, server string, t *testing.T) tls.Certificate {
+
+	template, err := identities.ServerTemplate([]string{name}, nil)
+	if err != nil {
+		t.Fatalf("error creating template [%s]", err.Error())
+	}
+
+	template.OCSPServer = []string{server}
+
+	leaf, err := authority.Issue(template, identities.ECDSA, 256)
+	if err != nil {
+		t.Fatalf("error issuing leaf [%s]", err.Error())
+	}
+
+	certificate, err := issued.Add(leaf).TLSCertificate()
+	if err != nil {
+		t.Fatalf("error creating tls certificate [%s]", err.Error())
+	}
+
+	return certificate
+}
+
+func TestStapler(t *testing.T) {
+
+	Convey("When Stapler", t, func() {
+
+		authority := identitytest.MustAuthority("NauTLS (Root)", t)
+		registry := identities.NewRevocationRegistry(authority)
+		issued := &Issued{}
+
+		responder, err := NewResponder(registry, issued.Lookup, nil, time.Hour)
+		So(err, ShouldBeNil)
+
+		server := httptest.NewServer(responder)
+		defer server.Close()
+
+		certificate := MustStapledLeaf(authority, issued, "nautls.com", server.URL, t)
+
+		Convey(".NewStapler is invoked", func() {
+
+			Convey("with a certificate without its issuer", func() {
+
+				_, err := NewStapler(certificate, nil, "", nil)
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("with a certificate with its issuer in its chain", func() {
+
+				certificate.Certificate = append(certificate.Certificate, authority.Certificate.Raw)
+				stapler, err := NewStapler(certificate, nil, "", nil)
+
+				Convey("it returns a stapler for the issuer", func() {
+					So(err, ShouldBeNil)
+					So(stapler.issuer.Raw, ShouldResemble, authority.Certificate.Raw)
+				})
+			})
+
+			Convey("with a certificate without an ocsp server", func() {
+
+				leaf, err := issued.Add(MustLeaf(authority, "nautls.com", t)).TLSCertificate()
+				So(err, ShouldBeNil)
+
+				Convey("and no responder", func() {
+
+					_, err := NewStapler(leaf, authority.Certificate, "", nil)
+
+					Convey("it returns a non-nil error", func() {
+						So(err, ShouldNotBeNil)
+					})
+				})
+
+				Convey("and a responder", func() {
+
+					stapler, err := NewStapler(leaf, authority.Certificate, server.URL, nil)
+					So(err, ShouldBeNil)
+
+					err = stapler.Start()
+					defer stapler.Stop()
+
+					Convey("it staples the response", func() {
+						So(err, ShouldBeNil)
+						So(stapler.Certificate().OCSPStaple, ShouldNotBeEmpty)
+					})
+				})
+			})
+		})
+
+		Convey(".Start is invoked", func() {
+
+			stapler, err := NewStapler(certificate, authority.Certificate, "", nil)
+			So(err, ShouldBeNil)
+			defer stapler.Stop()
+
+			Convey("for a good certificate", func() {
+
+				err := stapler.Start()
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("it staples a good response", func() {
+					response, err := ocsp.ParseResponse(stapler.Certificate().OCSPStaple, authority.Certificate)
+					So(err, ShouldBeNil)
+					So(response.Status, ShouldEqual, ocsp.Good)
+				})
+
+				Convey("it schedules a refresh halfway through the validity", func() {
+					So(stapler.refreshDelay(), ShouldBeBetween, 25*time.Minute, 31*time.Minute)
+				})
+
+				Convey("and .Stop is invoked it cancels the scheduled refresh", func() {
+					So(stapler.Stopped(), ShouldBeFalse)
+					stapler.Stop()
+					So(stapler.Stopped(), ShouldBeTrue)
+					So(stapler.timer.Stop(), ShouldBeFalse)
+				})
+			})
+
+			Convey("for a revoked certificate", func() {
+
+				if err := registry.RevokeCertificate(stapler.leaf, identities.KeyCompromise); err != nil {
+					t.Fatalf("error revoking certificate [%s]", err.Error())
+				}
+
+				err := stapler.Start()
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+
+				Convey("it staples the revoked response", func() {
+					response, err := ocsp.ParseResponse(stapler.Certificate().OCSPStaple, authority.Certificate)
+					So(err, ShouldBeNil)
+					So(response.Status, ShouldEqual, ocsp.Revoked)
+				})
+			})
+
+			Convey("with an unavailable responder", func() {
+
+				server.Close()
+				err := stapler.Start()
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+
+				Convey("it does not staple a response", func() {
+					So(stapler.Certificate().OCSPStaple, ShouldBeEmpty)
+				})
+			})
+		})
+
+		Convey("a background refresh fails", func() {
+
+			var failure error
+
+			stapler, err := NewStapler(certificate, authority.Certificate, "", func(err error) { failure = err })
+			So(err, ShouldBeNil)
+			defer stapler.Stop()
+
+			So(stapler.Start(), ShouldBeNil)
+
+			server.Close()
+			stapler.run()
+
+			Convey("it passes the error to the handler", func() {
+				So(failure, ShouldNotBeNil)
+			})
+
+			Convey("it retains the current staple", func() {
+				So(stapler.Certificate().OCSPStaple, ShouldNotBeEmpty)
+			})
+		})
+
+		Convey("#GetCertificate is invoked during a handshake", func() {
+
+			stapler, err := NewStapler(certificate, authority.Certificate, "", nil)
+			So(err, ShouldBeNil)
+			defer stapler.Stop()
+
+			So(stapler.Start(), ShouldBeNil)
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			So(err, ShouldBeNil)
+			defer listener.Close()
+
+			go func() {
+				connection, err := listener.Accept()
+				if err == nil {
+					tls.Server(connection, &tls.Config{GetCertificate: GetCertificate([]*Stapler{stapler})}).Handshake()
+					ioutil.ReadAll(connection)
+					connection.Close()
+				}
+			}()
+
+			connection, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{RootCAs: authority.TrustPool(), ServerName: "nautls.com"})
+			So(err, ShouldBeNil)
+			defer connection.Close()
+
+			Convey("it staples the response to the handshake", func() {
+				response, err := ocsp.ParseResponse(connection.ConnectionState().OCSPResponse, authority.Certificate)
+				So(err, ShouldBeNil)
+				So(response.Status, ShouldEqual, ocsp.Good)
+			})
+		})
+	})
+}
@@ -0,0 +1,179 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package servers
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/deciphernow/nautls/builders"
+	"github.com/deciphernow/nautls/identities"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ACMEConfig provides a serializable representation of an ACME (RFC 8555) client that obtains and renews server
+// certificates for a set of domains.
+type ACMEConfig struct {
+
+	// Directory defines the URL of the ACME directory. If omitted the Let's Encrypt production directory is used.
+	Directory string `json:"directory" mapstructure:"directory" yaml:"directory"`
+
+	// Authorities defines the trusted certificate authorities for verifying the ACME directory. The values must be URLs
+	// that point to the location of PEM encoded certificates. If omitted the system certificates are used.
+	Authorities []string `json:"authorities" mapstructure:"authorities" yaml:"authorities"`
+
+	// AccountKey defines the key of the ACME account. The value must be a URL that points to the location of a PEM
+	// encoded ECDSA or RSA key. If omitted a key is generated and, if a cache is defined, persisted to the cache.
+	AccountKey string `json:"account_key" mapstructure:"account_key" yaml:"account_key"`
+
+	// Contact defines the email address registered with the ACME account (e.g., "ops@nautls.com").
+	Contact string `json:"contact" mapstructure:"contact" yaml:"contact"`
+
+	// Domains defines the domains for which certificates are obtained. Each domain is issued a separate certificate when
+	// it is first requested by a client and the certificate is renewed automatically before it expires.
+	Domains []string `json:"domains" mapstructure:"domains" yaml:"domains"`
+
+	// Cache defines the path of a directory in which the account key and certificates are persisted between restarts.
+	// If omitted certificates are held in memory and obtained again when the process restarts.
+	Cache string `json:"cache" mapstructure:"cache" yaml:"cache"`
+
+	// RenewBefore defines how long before expiration certificates are renewed (e.g., "30d"). If omitted certificates are
+	// renewed 30 days before they expire.
+	RenewBefore identities.Duration `json:"renew_before" mapstructure:"renew_before" yaml:"renew_before"`
+}
+
+// ACMEManager obtains and renews server certificates from an ACME directory and responds to the TLS-ALPN-01 and
+// HTTP-01 challenges used to prove control of the domains. Note that the terms of service of the directory are accepted
+// on behalf of the caller.
+type ACMEManager struct {
+	domains []string
+	manager *autocert.Manager
+}
+
+// Build creates an ACMEManager from the ACMEConfig instance.
+func (c *ACMEConfig) Build() (*ACMEManager, error) {
+
+	if len(c.Domains) == 0 {
+		return nil, errors.New("error building acme manager without domains")
+	}
+
+	pool, err := builders.BuildCertificatePool(c.Authorities)
+	if err != nil {
+		return nil, errors.Wrap(err, "error building acme directory authority pool")
+	}
+
+	client := &acme.Client{
+		DirectoryURL: c.Directory,
+		HTTPClient: &http.Client{
+			Timeout:   time.Minute,
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}
+
+	if client.DirectoryURL == "" {
+		client.DirectoryURL = autocert.DefaultACMEDirectory
+	}
+
+	if c.AccountKey != "" {
+		client.Key, err = builders.BuildKey(c.AccountKey, "")
+		if err != nil {
+			return nil, errors.Wrapf(err, "error building acme account key from [%s]", c.AccountKey)
+		}
+	}
+
+	manager := &autocert.Manager{
+		Client:      client,
+		Email:       strings.TrimPrefix(c.Contact, "mailto:"),
+		HostPolicy:  autocert.HostWhitelist(c.Domains...),
+		Prompt:      autocert.AcceptTOS,
+		RenewBefore: time.Duration(c.RenewBefore),
+	}
+
+	if c.Cache != "" {
+		manager.Cache = autocert.DirCache(c.Cache)
+	}
+
+	return &ACMEManager{domains: c.Domains, manager: manager}, nil
+}
+
+// GetCertificate returns the certificate for a TLS handshake obtaining it from the ACME directory if needed. Handshakes
+// for the TLS-ALPN-01 challenge are answered with the challenge certificate.
+func (m *ACMEManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return m.manager.GetCertificate(hello)
+}
+
+// HTTPHandler returns a handler that responds to HTTP-01 challenges and delegates all other requests to the fallback.
+// If the fallback is nil other requests are redirected to HTTPS. Note that the HTTP-01 challenge is only attempted if
+// this method has been invoked and the handler is served on port 80 of the domains.
+func (m *ACMEManager) HTTPHandler(fallback http.Handler) http.Handler {
+	return m.manager.HTTPHandler(fallback)
+}
+
+// handles returns a value indicating whether a TLS handshake is for one of the domains of the manager.
+func (m *ACMEManager) handles(hello *tls.ClientHelloInfo) bool {
+
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	for _, domain := range m.domains {
+		if strings.EqualFold(name, domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// challenges returns a tls.Config GetConfigForClient function that answers TLS-ALPN-01 challenge handshakes with a
+// configuration that only negotiates the challenge protocol and leaves all other handshakes to the base configuration.
+func (m *ACMEManager) challenges() func(*tls.ClientHelloInfo) (*tls.Config, error) {
+
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+
+		for _, protocol := range hello.SupportedProtos {
+			if protocol == acme.ALPNProto {
+				return &tls.Config{GetCertificate: m.GetCertificate, NextProtos: []string{acme.ALPNProto}}, nil
+			}
+		}
+
+		return nil, nil
+	}
+}
+
+// certificates returns a tls.Config GetCertificate function that answers handshakes handled by the manager and
+// delegates all other handshakes to the fallback (or, if the fallback is nil, to the static certificates).
+func (m *ACMEManager) certificates(fallback func(*tls.ClientHelloInfo) (*tls.Certificate, error)) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+
+		if m.handles(hello) {
+
+			certificate, err := m.GetCertificate(hello)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error obtaining acme certificate for [%s]", hello.ServerName)
+			}
+
+			return certificate, nil
+		}
+
+		if fallback != nil {
+			return fallback(hello)
+		}
+
+		return nil, nil
+	}
+}
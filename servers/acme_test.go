@@ -0,0 +1,238 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package servers
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deciphernow/nautls/identities"
+	"github.com/deciphernow/nautls/internal/tests/acmetest"
+	"github.com/deciphernow/nautls/internal/tests/identitytest"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// mustServe serves TLS connections with a configuration on a loopback listener until the listener is closed or fails
+// the test.
+func mustServe(config *tls.Config, t *testing.T) net.Listener {
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatalf("error listening [%s]", err.Error())
+	}
+
+	go func() {
+		for {
+			connection, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer connection.Close()
+				if err := connection.(*tls.Conn).Handshake(); err == nil {
+					ioutil.ReadAll(connection)
+				}
+			}()
+		}
+	}()
+
+	return listener
+}
+
+func TestACME(t *testing.T) {
+
+	Convey("When ACMEConfig", t, func() {
+
+		authority := identitytest.MustAuthority("NauTLS (ACME)", t)
+
+		directory := acmetest.NewServer(authority)
+		defer directory.Close()
+
+		config := &ACMEConfig{
+			Authorities: []string{directory.AuthorityURL()},
+			Contact:     "mailto:ops@nautls.com",
+			Directory:   directory.DirectoryURL(),
+			Domains:     []string{"nautls.com"},
+			RenewBefore: identities.Duration(24 * time.Hour),
+		}
+
+		dial := func(listener net.Listener, name string) (*tls.Conn, error) {
+			return tls.Dial("tcp", listener.Addr().String(), &tls.Config{RootCAs: authority.TrustPool(), ServerName: name})
+		}
+
+		Convey(".Build is invoked without domains", func() {
+
+			config.Domains = nil
+			_, err := config.Build()
+
+			Convey("it returns a non-nil error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey(".Build is invoked with an invalid account key", func() {
+
+			config.AccountKey = "base64:///" + url.PathEscape(base64.StdEncoding.EncodeToString([]byte("invalid")))
+			_, err := config.Build()
+
+			Convey("it returns a non-nil error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("is used by a SecurityConfig", func() {
+
+			key, err := identities.GenerateKey(identities.ECDSA, 256)
+			So(err, ShouldBeNil)
+
+			encoded, err := identities.EncodeKey(key)
+			So(err, ShouldBeNil)
+
+			config.AccountKey = "base64:///" + url.PathEscape(base64.StdEncoding.EncodeToString(encoded))
+			directory.Challenges = []string{"tls-alpn-01"}
+
+			security, err := (&SecurityConfig{ACME: config}).Build()
+			So(err, ShouldBeNil)
+
+			listener := mustServe(security, t)
+			defer listener.Close()
+
+			directory.TLSAddress = listener.Addr().String()
+
+			Convey("and a client connects to a domain", func() {
+
+				connection, err := dial(listener, "nautls.com")
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("it serves a certificate issued by the directory", func() {
+					certificate := connection.ConnectionState().PeerCertificates[0]
+					So(certificate.DNSNames, ShouldResemble, []string{"nautls.com"})
+					So(certificate.CheckSignatureFrom(authority.Certificate), ShouldBeNil)
+				})
+
+				if connection != nil {
+					connection.Close()
+				}
+			})
+
+			Convey("and a client connects to another domain", func() {
+
+				_, err := dial(listener, "other.nautls.com")
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey("is used by a SecurityConfig built with .BuildSecurity", func() {
+
+			directory.Challenges = []string{"http-01"}
+
+			security, err := (&SecurityConfig{ACME: config}).BuildSecurity()
+			So(err, ShouldBeNil)
+			defer security.Close()
+
+			challenges := httptest.NewServer(security.ACME.HTTPHandler(nil))
+			defer challenges.Close()
+
+			directory.HTTPAddress = strings.TrimPrefix(challenges.URL, "http://")
+
+			listener := mustServe(security.Config, t)
+			defer listener.Close()
+
+			Convey("and a client connects to a domain", func() {
+
+				connection, err := dial(listener, "nautls.com")
+
+				Convey("it serves a certificate obtained with the http-01 challenge", func() {
+					So(err, ShouldBeNil)
+					So(connection.ConnectionState().PeerCertificates[0].DNSNames, ShouldResemble, []string{"nautls.com"})
+				})
+
+				if connection != nil {
+					connection.Close()
+				}
+			})
+		})
+
+		Convey("is built into an ACMEManager used by a SecurityBuilder", func() {
+
+			directory.Challenges = []string{"http-01"}
+
+			manager, err := config.Build()
+			So(err, ShouldBeNil)
+
+			challenges := httptest.NewServer(manager.HTTPHandler(nil))
+			defer challenges.Close()
+
+			directory.HTTPAddress = strings.TrimPrefix(challenges.URL, "http://")
+
+			identity, err := authority.Issue(identitytest.MustServerTemplate("static.nautls.com", t), identities.ECDSA, 256)
+			So(err, ShouldBeNil)
+
+			security, err := NewSecurityBuilder().WithIdentity(identity).WithACMEManager(manager).Build()
+			So(err, ShouldBeNil)
+
+			listener := mustServe(security, t)
+			defer listener.Close()
+
+			Convey("and a client connects to a domain", func() {
+
+				connection, err := dial(listener, "nautls.com")
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("it serves a certificate issued by the directory", func() {
+					So(connection.ConnectionState().PeerCertificates[0].DNSNames, ShouldResemble, []string{"nautls.com"})
+				})
+
+				if connection != nil {
+					connection.Close()
+				}
+			})
+
+			Convey("and a client connects to the domain of the static certificate", func() {
+
+				connection, err := dial(listener, "static.nautls.com")
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("it serves the static certificate", func() {
+					So(connection.ConnectionState().PeerCertificates[0].Equal(identity.Certificate), ShouldBeTrue)
+				})
+
+				if connection != nil {
+					connection.Close()
+				}
+			})
+		})
+	})
+}
@@ -14,11 +14,18 @@
 
 package servers
 
-import "crypto/tls"
+import (
+	"crypto/tls"
+	"crypto/x509"
+
+	"github.com/deciphernow/nautls/identities"
+	"github.com/deciphernow/nautls/revocations"
+)
 
 // SecurityBuilder provides an builder for server tls.Config instances.
 type SecurityBuilder struct {
-	config SecurityConfig
+	config    SecurityConfig
+	materials materials
 }
 
 // NewSecurityBuilder returns a new instance of the SecurityBuilder structure.
@@ -26,9 +33,23 @@ func NewSecurityBuilder() *SecurityBuilder {
 	return &SecurityBuilder{}
 }
 
-// Build creates a tls.Config from the SecurityBuilder.
+// Build creates a tls.Config from the SecurityBuilder. Note that the OCSP staplers started for the configuration (see
+// WithOCSPStapling) run for the lifetime of the process and that the HTTP-01 challenge of an ACME manager built from
+// WithACME cannot be served; use BuildSecurity for either.
 func (b *SecurityBuilder) Build() (*tls.Config, error) {
-	return b.config.Build()
+
+	security, err := b.BuildSecurity()
+	if err != nil {
+		return nil, err
+	}
+
+	return security.Config, nil
+}
+
+// BuildSecurity creates a Security from the SecurityBuilder. The caller is responsible for closing it once the
+// configuration is no longer served.
+func (b *SecurityBuilder) BuildSecurity() (*Security, error) {
+	return b.config.build(b.materials)
 }
 
 // WithAuthorities sets the trusted certificate authorities for verifying mTLS clients. The values must be URLs that
@@ -63,8 +84,132 @@ func (b *SecurityBuilder) WithKey(key string) *SecurityBuilder {
 	return b
 }
 
+// WithPassphrase sets the passphrase used to decrypt the key if it is encrypted and the password of the PKCS #12 bundle.
+// The value must be a URL that points to the location of the passphrase.
+//
+// Note that in addition to those schemes supported by [getter](https://godoc.org/github.com/hashicorp/go-getter) a
+// "base64" scheme is supported for providing the passphrase in the path of the URL directly. This is most applicable
+// when the passphrase must be provided via an environement variable.
+func (b *SecurityBuilder) WithPassphrase(passphrase string) *SecurityBuilder {
+	b.config.Passphrase = passphrase
+	return b
+}
+
+// WithPKCS12 sets a PKCS #12 bundle containing a certificate, key and certificate chain. The value must be a URL that
+// points to the location of a DER encoded PKCS #12 bundle whose password is set with WithPassphrase.
+//
+// Note that in addition to those schemes supported by [getter](https://godoc.org/github.com/hashicorp/go-getter) a
+// "base64" scheme is supported for providing the bundle in the path of the URL directly. This is most applicable when
+// the bundle must be provided via an environement variable.
+func (b *SecurityBuilder) WithPKCS12(pkcs12 string) *SecurityBuilder {
+	b.config.PKCS12 = pkcs12
+	return b
+}
+
 // WithAuthentication sets the client authentication mode for mTLS connections.
 func (b *SecurityBuilder) WithAuthentication(authentication Authentication) *SecurityBuilder {
 	b.config.Authentication = authentication
 	return b
 }
+
+// WithACME sets the ACME (RFC 8555) client that obtains and renews certificates for its domains. Handshakes for the
+// domains are answered with the ACME certificates and the TLS-ALPN-01 challenge is answered by the built configuration.
+// The manager built from the client is returned by BuildSecurity for serving the HTTP-01 challenge.
+func (b *SecurityBuilder) WithACME(acme *ACMEConfig) *SecurityBuilder {
+	b.config.ACME = acme
+	return b
+}
+
+// WithACMEManager sets an in-memory ACME manager that obtains and renews certificates for its domains and takes
+// precedence over any set with WithACME. Serving the handler returned by ACMEManager.HTTPHandler on port 80 enables the
+// HTTP-01 challenge in addition to the TLS-ALPN-01 challenge.
+func (b *SecurityBuilder) WithACMEManager(manager *ACMEManager) *SecurityBuilder {
+	b.materials.acme = manager
+	return b
+}
+
+// WithAuthorityCertificates adds in-memory certificates to the trusted certificate authorities for verifying mTLS
+// clients. These are trusted in addition to any set with WithAuthorities and, once provided, the system certificates
+// are no longer used by default.
+func (b *SecurityBuilder) WithAuthorityCertificates(authorities ...*x509.Certificate) *SecurityBuilder {
+	b.materials.authorities = append(b.materials.authorities, authorities...)
+	return b
+}
+
+// WithIdentity sets an in-memory identity used as the server certificate with its authorities attached as the
+// certificate chain. Note that the identity is provided in addition to any certificate and key set with WithCertificate
+// and WithKey.
+func (b *SecurityBuilder) WithIdentity(identity *identities.Identity) *SecurityBuilder {
+	b.materials.identity = identity
+	return b
+}
+
+// WithRevocations sets the certificate revocation lists used to check the client certificate chains. The values must be
+// URLs that point to the locations of PEM or DER encoded X.509 CRLs.
+//
+// Note that in addition to those schemes supported by [getter](https://godoc.org/github.com/hashicorp/go-getter) a
+// "base64" scheme is supported for providing the CRL in the path of the URL directly. This is most applicable when the
+// CRL must be provided via an environement variable.
+func (b *SecurityBuilder) WithRevocations(revocations []string) *SecurityBuilder {
+	b.config.Revocations = revocations
+	return b
+}
+
+// WithRevocationPolicy sets whether certificates are rejected or accepted when the CRL of their issuer is stale.
+func (b *SecurityBuilder) WithRevocationPolicy(policy revocations.Policy) *SecurityBuilder {
+	b.config.RevocationPolicy = policy
+	return b
+}
+
+// WithOCSPStapling sets whether OCSP responses are stapled to the server certificates.
+func (b *SecurityBuilder) WithOCSPStapling(stapling bool) *SecurityBuilder {
+	b.config.OCSPStapling = stapling
+	return b
+}
+
+// WithOCSPResponder sets the URL of the OCSP responder queried for stapled responses in place of the OCSP servers of the
+// certificates.
+func (b *SecurityBuilder) WithOCSPResponder(responder string) *SecurityBuilder {
+	b.config.OCSPResponder = responder
+	return b
+}
+
+// WithStaplingHandler sets a function that is passed the errors of background OCSP staple refreshes. Note that errors
+// fetching the initial responses are returned when the configuration is built.
+func (b *SecurityBuilder) WithStaplingHandler(handler func(error)) *SecurityBuilder {
+	b.materials.staplingHandler = handler
+	return b
+}
+
+// WithLint sets whether the server certificates and their chains are linted when the configuration is built and rejected
+// if there are findings of error severity (see lints.LintTLSCertificate). Note that ACME certificates are neither
+// linted nor stapled.
+func (b *SecurityBuilder) WithLint(lint bool) *SecurityBuilder {
+	b.config.Lint = lint
+	return b
+}
+
+// WithSPIFFEIDs sets the SPIFFE IDs of the clients that are authorized. Once SPIFFE IDs or trust domains are set the
+// client must present an X.509-SVID that is authorized by its SPIFFE ID in place of verifying its hostname.
+func (b *SecurityBuilder) WithSPIFFEIDs(ids []string) *SecurityBuilder {
+	b.config.SPIFFEIDs = ids
+	return b
+}
+
+// WithSPIFFETrustDomains sets the SPIFFE trust domains whose clients are authorized.
+func (b *SecurityBuilder) WithSPIFFETrustDomains(trustDomains []string) *SecurityBuilder {
+	b.config.SPIFFETrustDomains = trustDomains
+	return b
+}
+
+// WithSPIFFEBundles sets the SPIFFE trust bundles whose X.509-SVID authorities are trusted keyed by trust domain (e.g.,
+// "nautls.com"). The values must be URLs that point to the locations of bundles in the SPIFFE bundle (i.e., JWK set)
+// format. Note that an X.509-SVID is only verified against the bundle of its own trust domain.
+//
+// Note that in addition to those schemes supported by [getter](https://godoc.org/github.com/hashicorp/go-getter) a
+// "base64" scheme is supported for providing the bundle in the path of the URL directly. This is most applicable when
+// the bundle must be provided via an environement variable.
+func (b *SecurityBuilder) WithSPIFFEBundles(bundles map[string]string) *SecurityBuilder {
+	b.config.SPIFFEBundles = bundles
+	return b
+}
@@ -15,9 +15,19 @@
 package servers
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
+	"github.com/deciphernow/nautls/identities"
 	"github.com/deciphernow/nautls/internal/tests"
+	"github.com/deciphernow/nautls/revocations"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -63,6 +73,46 @@ func TestSecurityBuilder(t *testing.T) {
 			})
 		})
 
+		Convey("with an unordered certificate bundle and .Build is invoked", func() {
+
+			template, err := identities.RootTemplate(pkix.Name{CommonName: "NauTLS (Root)"})
+			So(err, ShouldBeNil)
+
+			root, err := identities.Self(template, identities.ECDSA, 256)
+			So(err, ShouldBeNil)
+
+			template, err = identities.IntermediateTemplate(pkix.Name{CommonName: "NauTLS (Intermediate)"})
+			So(err, ShouldBeNil)
+
+			intermediate, err := root.Issue(template, identities.ECDSA, 256)
+			So(err, ShouldBeNil)
+
+			template, err = identities.ServerTemplate([]string{"nautls.com"}, nil)
+			So(err, ShouldBeNil)
+
+			leaf, err := intermediate.Issue(template, identities.ECDSA, 256)
+			So(err, ShouldBeNil)
+
+			key, err := leaf.EncodeKey()
+			So(err, ShouldBeNil)
+
+			bundle := identities.EncodeCertificates([]*x509.Certificate{root.Certificate, leaf.Certificate, intermediate.Certificate})
+
+			builder.WithCertificate("base64:///" + url.PathEscape(base64.StdEncoding.EncodeToString(bundle)))
+			builder.WithKey("base64:///" + url.PathEscape(base64.StdEncoding.EncodeToString(key)))
+
+			config, err := builder.Build()
+
+			Convey("it returns a nil error", func() {
+				So(err, ShouldBeNil)
+			})
+
+			Convey("it returns the ordered chain without the root", func() {
+				So(config.Certificates, ShouldHaveLength, 1)
+				So(config.Certificates[0].Certificate, ShouldResemble, [][]byte{leaf.Certificate.Raw, intermediate.Certificate.Raw})
+			})
+		})
+
 		Convey(".WithKey is invoked", func() {
 
 			key := tests.MustGenerateString(t)
@@ -74,6 +124,28 @@ func TestSecurityBuilder(t *testing.T) {
 			})
 		})
 
+		Convey(".WithPassphrase is invoked", func() {
+
+			passphrase := tests.MustGenerateString(t)
+
+			builder.WithPassphrase(passphrase)
+
+			Convey("it sets the passphrase", func() {
+				So(builder.config.Passphrase, ShouldEqual, passphrase)
+			})
+		})
+
+		Convey(".WithPKCS12 is invoked", func() {
+
+			pkcs12 := tests.MustGenerateString(t)
+
+			builder.WithPKCS12(pkcs12)
+
+			Convey("it sets the pkcs12", func() {
+				So(builder.config.PKCS12, ShouldEqual, pkcs12)
+			})
+		})
+
 		Convey(".WithAuthentication is invoked", func() {
 
 			authentication := MustGenerateAuthentication(t)
@@ -84,5 +156,330 @@ func TestSecurityBuilder(t *testing.T) {
 				So(builder.config.Authentication, ShouldEqual, authentication)
 			})
 		})
+
+		Convey(".WithRevocations is invoked", func() {
+
+			revocations := tests.MustGenerateStrings(t)
+
+			builder.WithRevocations(revocations)
+
+			Convey("it sets the revocations", func() {
+				So(builder.config.Revocations, ShouldResemble, revocations)
+			})
+
+			Convey("with a valid crl and .Build is invoked", func() {
+
+				template, err := identities.RootTemplate(pkix.Name{CommonName: "NauTLS (Root)"})
+				So(err, ShouldBeNil)
+
+				authority, err := identities.Self(template, identities.ECDSA, 256)
+				So(err, ShouldBeNil)
+
+				crl, err := identities.NewRevocationRegistry(authority).CRL(time.Hour)
+				So(err, ShouldBeNil)
+
+				builder.WithRevocations([]string{"base64:///" + url.PathEscape(base64.StdEncoding.EncodeToString(identities.EncodeCRL(crl)))})
+				config, err := builder.Build()
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("it verifies peer certificates", func() {
+					So(config.VerifyPeerCertificate, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey(".WithRevocationPolicy is invoked", func() {
+
+			builder.WithRevocationPolicy(revocations.FailOpen)
+
+			Convey("it sets the revocation policy", func() {
+				So(builder.config.RevocationPolicy, ShouldEqual, revocations.FailOpen)
+			})
+		})
+
+		Convey(".WithOCSPStapling is invoked", func() {
+
+			builder.WithOCSPStapling(true)
+
+			Convey("it sets the ocsp stapling", func() {
+				So(builder.config.OCSPStapling, ShouldBeTrue)
+			})
+		})
+
+		Convey(".WithOCSPResponder is invoked", func() {
+
+			responder := tests.MustGenerateString(t)
+
+			builder.WithOCSPResponder(responder)
+
+			Convey("it sets the ocsp responder", func() {
+				So(builder.config.OCSPResponder, ShouldEqual, responder)
+			})
+		})
+
+		Convey(".WithStaplingHandler is invoked", func() {
+
+			builder.WithStaplingHandler(func(error) {})
+
+			Convey("it sets the stapling handler", func() {
+				So(builder.materials.staplingHandler, ShouldNotBeNil)
+			})
+		})
+
+		Convey("with ocsp stapling and .Build is invoked", func() {
+
+			template, err := identities.RootTemplate(pkix.Name{CommonName: "NauTLS (Root)"})
+			So(err, ShouldBeNil)
+
+			authority, err := identities.Self(template, identities.ECDSA, 256)
+			So(err, ShouldBeNil)
+
+			template, err = identities.ServerTemplate([]string{"nautls.com"}, nil)
+			So(err, ShouldBeNil)
+
+			identity, err := authority.Issue(template, identities.ECDSA, 256)
+			So(err, ShouldBeNil)
+
+			builder.WithIdentity(identity).WithOCSPStapling(true)
+
+			Convey("with an available responder", func() {
+
+				responder, err := revocations.NewResponder(identities.NewRevocationRegistry(authority), func(serial *big.Int) (bool, error) { return serial.Cmp(identity.Certificate.SerialNumber) == 0, nil }, nil, time.Hour)
+				So(err, ShouldBeNil)
+
+				server := httptest.NewServer(responder)
+				defer server.Close()
+
+				config, err := builder.WithOCSPResponder(server.URL).Build()
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("it serves stapled certificates", func() {
+					certificate, err := config.GetCertificate(&tls.ClientHelloInfo{})
+					So(err, ShouldBeNil)
+					So(certificate.OCSPStaple, ShouldNotBeEmpty)
+				})
+			})
+
+			Convey("with an available responder and .BuildSecurity is invoked", func() {
+
+				responder, err := revocations.NewResponder(identities.NewRevocationRegistry(authority), func(serial *big.Int) (bool, error) { return serial.Cmp(identity.Certificate.SerialNumber) == 0, nil }, nil, time.Hour)
+				So(err, ShouldBeNil)
+
+				server := httptest.NewServer(responder)
+				defer server.Close()
+
+				security, err := builder.WithOCSPResponder(server.URL).BuildSecurity()
+				So(err, ShouldBeNil)
+
+				Convey("it returns the running staplers", func() {
+					So(security.staplers, ShouldHaveLength, 1)
+					So(security.staplers[0].Stopped(), ShouldBeFalse)
+				})
+
+				Convey("and .Close is invoked it stops the staplers", func() {
+					So(security.Close(), ShouldBeNil)
+					So(security.staplers[0].Stopped(), ShouldBeTrue)
+				})
+			})
+
+			Convey("with a certificate issued by a root loaded from resources", func() {
+
+				responder, err := revocations.NewResponder(identities.NewRevocationRegistry(authority), func(serial *big.Int) (bool, error) { return serial.Cmp(identity.Certificate.SerialNumber) == 0, nil }, nil, time.Hour)
+				So(err, ShouldBeNil)
+
+				server := httptest.NewServer(responder)
+				defer server.Close()
+
+				encode := func(bytes []byte) string {
+					return "base64:///" + url.PathEscape(base64.StdEncoding.EncodeToString(bytes))
+				}
+
+				key, err := identity.EncodeKey()
+				So(err, ShouldBeNil)
+
+				resources := NewSecurityBuilder().WithKey(encode(key)).WithOCSPStapling(true).WithOCSPResponder(server.URL)
+
+				Convey("and the root in the authorities", func() {
+
+					config, err := resources.
+						WithCertificate(encode(identity.EncodeCertificate())).
+						WithAuthorities([]string{encode(identity.EncodeAuthorities())}).
+						Build()
+
+					Convey("it serves stapled certificates", func() {
+						So(err, ShouldBeNil)
+						certificate, err := config.GetCertificate(&tls.ClientHelloInfo{})
+						So(err, ShouldBeNil)
+						So(certificate.OCSPStaple, ShouldNotBeEmpty)
+					})
+				})
+
+				Convey("and the root in the certificate file", func() {
+
+					config, err := resources.WithCertificate(encode(identity.EncodeChain())).Build()
+
+					Convey("it serves stapled certificates", func() {
+						So(err, ShouldBeNil)
+						certificate, err := config.GetCertificate(&tls.ClientHelloInfo{})
+						So(err, ShouldBeNil)
+						So(certificate.OCSPStaple, ShouldNotBeEmpty)
+					})
+				})
+
+				Convey("and without the root", func() {
+
+					_, err := resources.WithCertificate(encode(identity.EncodeCertificate())).Build()
+
+					Convey("it returns a non-nil error", func() {
+						So(err, ShouldNotBeNil)
+					})
+				})
+			})
+
+			Convey("without a responder", func() {
+
+				_, err := builder.Build()
+
+				Convey("it returns a non-nil error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey(".WithLint is invoked", func() {
+
+			builder.WithLint(true)
+
+			Convey("it sets the lint", func() {
+				So(builder.config.Lint, ShouldBeTrue)
+			})
+
+			Convey("with a weak identity and .Build is invoked", func() {
+
+				template, err := identities.RootTemplate(pkix.Name{CommonName: "NauTLS (Root)"})
+				So(err, ShouldBeNil)
+
+				authority, err := identities.Self(template, identities.ECDSA, 256)
+				So(err, ShouldBeNil)
+
+				template, err = identities.ServerTemplate([]string{"nautls.com"}, nil)
+				So(err, ShouldBeNil)
+
+				template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+
+				identity, err := authority.Issue(template, identities.RSA, 1024)
+				So(err, ShouldBeNil)
+
+				_, err = builder.WithIdentity(identity).Build()
+
+				Convey("it returns a lint error", func() {
+					So(err, ShouldNotBeNil)
+					So(err.Error(), ShouldContainSubstring, "rsa key size [1024] is less than [2048]")
+				})
+			})
+		})
+
+		Convey(".WithSPIFFEIDs is invoked", func() {
+
+			ids := tests.MustGenerateStrings(t)
+
+			builder.WithSPIFFEIDs(ids)
+
+			Convey("it sets the spiffe ids", func() {
+				So(builder.config.SPIFFEIDs, ShouldResemble, ids)
+			})
+		})
+
+		Convey(".WithSPIFFETrustDomains is invoked", func() {
+
+			trustDomains := tests.MustGenerateStrings(t)
+
+			builder.WithSPIFFETrustDomains(trustDomains)
+
+			Convey("it sets the spiffe trust domains", func() {
+				So(builder.config.SPIFFETrustDomains, ShouldResemble, trustDomains)
+			})
+		})
+
+		Convey(".WithSPIFFEBundles is invoked", func() {
+
+			bundles := map[string]string{tests.MustGenerateString(t): tests.MustGenerateString(t)}
+
+			builder.WithSPIFFEBundles(bundles)
+
+			Convey("it sets the spiffe bundles", func() {
+				So(builder.config.SPIFFEBundles, ShouldResemble, bundles)
+			})
+		})
+
+		Convey(".WithACME is invoked", func() {
+
+			acme := &ACMEConfig{Domains: tests.MustGenerateStrings(t)}
+
+			builder.WithACME(acme)
+
+			Convey("it sets the acme configuration", func() {
+				So(builder.config.ACME, ShouldEqual, acme)
+			})
+		})
+
+		Convey(".WithACMEManager is invoked", func() {
+
+			manager := &ACMEManager{}
+
+			builder.WithACMEManager(manager)
+
+			Convey("it sets the acme manager", func() {
+				So(builder.materials.acme, ShouldEqual, manager)
+			})
+		})
+
+		Convey(".WithAuthorityCertificates is invoked", func() {
+
+			authorities := []*x509.Certificate{&x509.Certificate{}, &x509.Certificate{}}
+
+			builder.WithAuthorityCertificates(authorities...)
+
+			Convey("it sets the authority certificates", func() {
+				So(builder.materials.authorities, ShouldResemble, authorities)
+			})
+		})
+
+		Convey(".WithIdentity is invoked", func() {
+
+			identity, err := identities.Self(identities.Template{
+				NotAfter:     time.Now().AddDate(0, 1, 0),
+				NotBefore:    time.Now(),
+				SerialNumber: big.NewInt(time.Now().UnixNano()),
+				Subject:      pkix.Name{CommonName: "nautls.com"},
+			}, identities.ECDSA, 256)
+			So(err, ShouldBeNil)
+
+			builder.WithIdentity(identity)
+
+			Convey("it sets the identity", func() {
+				So(builder.materials.identity, ShouldEqual, identity)
+			})
+
+			Convey("and .Build is invoked", func() {
+
+				config, err := builder.Build()
+
+				Convey("it returns a nil error", func() {
+					So(err, ShouldBeNil)
+				})
+
+				Convey("it returns the identity as a certificate", func() {
+					So(config.Certificates, ShouldHaveLength, 1)
+					So(config.Certificates[0].Leaf, ShouldEqual, identity.Certificate)
+				})
+			})
+		})
 	})
 }
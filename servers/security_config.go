@@ -16,8 +16,12 @@ package servers
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 
 	"github.com/deciphernow/nautls/builders"
+	"github.com/deciphernow/nautls/identities"
+	"github.com/deciphernow/nautls/lints"
+	"github.com/deciphernow/nautls/revocations"
 	"github.com/pkg/errors"
 )
 
@@ -47,31 +51,305 @@ type SecurityConfig struct {
 	// applicable when the certificate data must be provided via an environement variable.
 	Key string `json:"key" mapstructure:"key" yaml:"key"`
 
+	// Passphrase defines the passphrase used to decrypt the key if it is encrypted and the password of the PKCS #12
+	// bundle. The value must be a URL that points to the location of the passphrase. Both legacy encrypted PEM blocks
+	// and PBES2 encrypted PKCS #8 keys are supported.
+	//
+	// Note that in addition to those schemes supported by [getter](https://godoc.org/github.com/hashicorp/go-getter) a
+	// "base64" scheme is supported for providing the passphrase in the path of the URL directly. This is most applicable
+	// when the passphrase must be provided via an environement variable.
+	Passphrase string `json:"passphrase" mapstructure:"passphrase" yaml:"passphrase"`
+
+	// PKCS12 defines a PKCS #12 (i.e., .p12 or .pfx) bundle containing a certificate, key and certificate chain. The
+	// value must be a URL that points to the location of a DER encoded PKCS #12 bundle whose password is defined by the
+	// passphrase. Note that the bundle may be provided in addition to the certificate and key.
+	//
+	// Note that in addition to those schemes supported by [getter](https://godoc.org/github.com/hashicorp/go-getter) a
+	// "base64" scheme is supported for providing the bundle in the path of the URL directly. This is most applicable
+	// when the bundle must be provided via an environement variable.
+	PKCS12 string `json:"pkcs12" mapstructure:"pkcs12" yaml:"pkcs12"`
+
+	// Revocations defines the certificate revocation lists used to check the client certificate chains. The values must be
+	// URLs that point to the locations of PEM or DER encoded X.509 CRLs. A CRL is only applied to certificates whose
+	// issuer signed the CRL and stale CRLs (i.e., those past their next update) are reloaded in the background when checked.
+	//
+	// Note that in addition to those schemes supported by [getter](https://godoc.org/github.com/hashicorp/go-getter) a
+	// "base64" scheme is supported for providing the CRL in the path of the URL directly. This is most applicable when
+	// the CRL must be provided via an environement variable.
+	Revocations []string `json:"revocations" mapstructure:"revocations" yaml:"revocations"`
+
+	// RevocationPolicy defines whether certificates are rejected (i.e., "FailClosed") or accepted (i.e., "FailOpen") when
+	// the CRL of their issuer is stale. Note that certificates listed as revoked are always rejected.
+	RevocationPolicy revocations.Policy `json:"revocation_policy" mapstructure:"revocation_policy" yaml:"revocation_policy"`
+
+	// OCSPStapling defines whether OCSP responses are stapled to the server certificates. Responses are fetched when
+	// the configuration is built, which fails if a response cannot be fetched, and are refreshed in the background
+	// before they expire until the Security built for the configuration is closed (see BuildSecurity). The issuer of
+	// each certificate is looked up in the certificate file, the authorities and the authorities of an in-memory
+	// identity (see WithIdentity) and otherwise taken from its chain, which omits self signed roots, such that the root
+	// that issued a certificate directly must be included in one of them.
+	OCSPStapling bool `json:"ocsp_stapling" mapstructure:"ocsp_stapling" yaml:"ocsp_stapling"`
+
+	// OCSPResponder defines the URL of the OCSP responder queried for stapled responses. If omitted the first OCSP server
+	// of each certificate is queried.
+	OCSPResponder string `json:"ocsp_responder" mapstructure:"ocsp_responder" yaml:"ocsp_responder"`
+
+	// ACME defines an ACME (RFC 8555) client that obtains and renews certificates for its domains. Handshakes for the
+	// domains are answered with the ACME certificates (which are not stapled) and all other handshakes with the static
+	// certificates. The TLS-ALPN-01 challenge is answered by the built configuration while the HTTP-01 challenge
+	// requires serving the handler of the ACME manager of the Security built for the configuration (see BuildSecurity).
+	ACME *ACMEConfig `json:"acme" mapstructure:"acme" yaml:"acme"`
+
 	// Authentication defines the client authentication mode for mTLS connections.
 	//
 	// For serialization puposes (i.e., JSON and YAML) the value must be the string representation of a tls.ClientAuthType
 	// constant (e.g., "RequireAnyClientCert"). See https://golang.org/pkg/crypto/tls/#ClientAuthType.
 	Authentication Authentication `json:"authentication" mapstructure:"authentication" yaml:"authentication"`
+
+	// Lint defines whether the server certificates and their chains are linted for weak cryptography and misconfigurations
+	// (e.g., RSA keys of less than 2048 bits, SHA-1 signatures or expired certificates) when the configuration is built.
+	// Certificates with findings of error severity are rejected (see lints.LintTLSCertificate). Note that ACME
+	// certificates are obtained after the configuration is built and are neither linted nor stapled.
+	Lint bool `json:"lint" mapstructure:"lint" yaml:"lint"`
+
+	// SPIFFEIDs defines the SPIFFE IDs (e.g., "spiffe://nautls.com/api") of the clients that are authorized. When either
+	// the SPIFFE IDs or trust domains are defined every client must present a verified X.509-SVID that is authorized by
+	// its SPIFFE ID, so the authentication mode should be "RequireAndVerifyClientCert".
+	SPIFFEIDs []string `json:"spiffe_ids" mapstructure:"spiffe_ids" yaml:"spiffe_ids"`
+
+	// SPIFFETrustDomains defines the SPIFFE trust domains (e.g., "nautls.com") whose clients are authorized.
+	SPIFFETrustDomains []string `json:"spiffe_trust_domains" mapstructure:"spiffe_trust_domains" yaml:"spiffe_trust_domains"`
+
+	// SPIFFEBundles defines the SPIFFE trust bundles of trust domains (e.g., "nautls.com") whose X.509-SVID authorities
+	// are trusted in addition to the authorities. The values must be URLs that point to the locations of bundles in the
+	// SPIFFE bundle (i.e., JWK set) format. An X.509-SVID is only verified against the bundle of its own trust domain and
+	// against the authorities whose SPIFFE ID belongs to its trust domain, so the SPIFFE IDs and trust domains require a
+	// bundle or such an authority.
+	//
+	// Note that in addition to those schemes supported by [getter](https://godoc.org/github.com/hashicorp/go-getter) a
+	// "base64" scheme is supported for providing the bundle in the path of the URL directly. This is most applicable
+	// when the bundle must be provided via an environement variable.
+	SPIFFEBundles map[string]string `json:"spiffe_bundles" mapstructure:"spiffe_bundles" yaml:"spiffe_bundles"`
+}
+
+// materials defines in-memory cryptographic materials that supplement the resources of a SecurityConfig.
+type materials struct {
+	acme            *ACMEManager
+	authorities     []*x509.Certificate
+	identity        *identities.Identity
+	staplingHandler func(error)
+}
+
+// Security represents a server tls.Config along with the ACME manager that obtains its ACME certificates and the
+// background OCSP staplers that refresh the responses stapled to its certificates.
+type Security struct {
+
+	// ACME defines the ACME manager of the configuration or nil if ACME is not configured. Serving the handler returned
+	// by ACMEManager.HTTPHandler on port 80 enables the HTTP-01 challenge in addition to the TLS-ALPN-01 challenge.
+	ACME *ACMEManager
+
+	// Config defines the tls.Config of the server.
+	Config *tls.Config
+
+	staplers []*revocations.Stapler
+}
+
+// Close stops the background refreshes of the OCSP staplers of the configuration. Note that the stapled responses are
+// no longer refreshed once closed so the configuration should no longer be served.
+func (s *Security) Close() error {
+
+	for _, stapler := range s.staplers {
+		stapler.Stop()
+	}
+
+	return nil
 }
 
-// Build creates a tls.Config from the SecurityConfig instance.
+// Build creates a tls.Config from the SecurityConfig instance. Note that the OCSP staplers started for the configuration
+// (see OCSPStapling) run for the lifetime of the process and that the HTTP-01 challenge of the ACME manager cannot be
+// served; use BuildSecurity for either.
 func (c *SecurityConfig) Build() (*tls.Config, error) {
 
-	pool, err := builders.BuildCertificatePool(c.Authorities)
+	security, err := c.BuildSecurity()
+	if err != nil {
+		return nil, err
+	}
+
+	return security.Config, nil
+}
+
+// BuildSecurity creates a Security from the SecurityConfig instance. The caller is responsible for closing it once the
+// configuration is no longer served.
+func (c *SecurityConfig) BuildSecurity() (*Security, error) {
+	return c.build(materials{})
+}
+
+// build creates a Security from the SecurityConfig instance and the in-memory materials.
+func (c *SecurityConfig) build(materials materials) (*Security, error) {
+
+	bundles, err := builders.BuildSPIFFEBundles(c.SPIFFEBundles)
+	if err != nil {
+		return nil, errors.Wrap(err, "error building spiffe bundles")
+	}
+
+	var authorities []*x509.Certificate
+	for _, bundle := range bundles {
+		authorities = append(authorities, bundle...)
+	}
+
+	pool, err := builders.BuildCertificatePool(c.Authorities, append(authorities, materials.authorities...)...)
 	if err != nil {
 		return nil, errors.Wrap(err, "error building certificate authority pool")
 	}
 
-	certificates, err := builders.BuildCertificates(c.Certificate, c.Key)
+	certificates, err := builders.BuildCertificates(c.Certificate, c.Key, c.Passphrase)
 	if err != nil {
 		return nil, errors.Wrap(err, "error building certificates")
 	}
 
+	bundled, err := builders.BuildPKCS12Certificates(c.PKCS12, c.Passphrase)
+	if err != nil {
+		return nil, errors.Wrap(err, "error building pkcs12 certificates")
+	}
+
+	certificates = append(certificates, bundled...)
+
+	if materials.identity != nil {
+
+		certificate, err := materials.identity.TLSCertificate()
+		if err != nil {
+			return nil, errors.Wrap(err, "error building identity certificate")
+		}
+
+		certificates = append(certificates, certificate)
+	}
+
+	if c.Lint {
+		if err := builders.LintCertificates(certificates, lints.ServerUsage); err != nil {
+			return nil, errors.Wrap(err, "error linting certificates")
+		}
+	}
+
 	config := &tls.Config{
 		Certificates: certificates,
 		ClientAuth:   tls.ClientAuthType(c.Authentication),
 		ClientCAs:    pool,
 	}
 
-	return config, nil
+	manager := materials.acme
+	if manager == nil && c.ACME != nil {
+		manager, err = c.ACME.Build()
+		if err != nil {
+			return nil, errors.Wrap(err, "error building acme manager")
+		}
+	}
+
+	if len(c.Revocations) > 0 {
+
+		checker, err := revocations.NewCRLChecker(c.Revocations, c.RevocationPolicy)
+		if err != nil {
+			return nil, errors.Wrap(err, "error building revocation checker")
+		}
+
+		config.VerifyPeerCertificate = checker.VerifyPeerCertificate
+	}
+
+	if len(c.SPIFFEIDs) > 0 || len(c.SPIFFETrustDomains) > 0 {
+
+		roots, err := builders.BuildSPIFFERoots(bundles, c.Authorities, materials.authorities...)
+		if err != nil {
+			return nil, errors.Wrap(err, "error building spiffe roots")
+		}
+
+		verifier, err := builders.BuildSPIFFEVerifier(c.SPIFFEIDs, c.SPIFFETrustDomains, roots, nil, config.VerifyConnection)
+		if err != nil {
+			return nil, errors.Wrap(err, "error building spiffe verifier")
+		}
+
+		config.VerifyConnection = verifier
+	}
+
+	security := &Security{ACME: manager, Config: config}
+
+	if c.OCSPStapling {
+
+		candidates := append([]*x509.Certificate{}, materials.authorities...)
+		if materials.identity != nil {
+			candidates = append(candidates, materials.identity.Authorities...)
+		}
+
+		resources := c.Authorities
+		if c.Certificate != "" {
+			resources = append([]string{c.Certificate}, resources...)
+		}
+
+		issuers, err := builders.BuildCertificateList(resources, candidates...)
+		if err != nil {
+			return nil, errors.Wrap(err, "error building ocsp stapling issuers")
+		}
+
+		staplers, err := staple(certificates, issuers, c.OCSPResponder, materials.staplingHandler)
+		if err != nil {
+			return nil, errors.Wrap(err, "error stapling ocsp responses")
+		}
+
+		config.Certificates = nil
+		config.GetCertificate = revocations.GetCertificate(staplers)
+
+		security.staplers = staplers
+	}
+
+	if manager != nil {
+		config.GetCertificate = manager.certificates(config.GetCertificate)
+		config.GetConfigForClient = manager.challenges()
+	}
+
+	return security, nil
+}
+
+// staple starts an OCSP stapler for each certificate stopping those already started if any fails. The issuer of each
+// certificate is taken from the issuers if it is one of them and otherwise from its chain.
+func staple(certificates []tls.Certificate, issuers []*x509.Certificate, responder string, handler func(error)) ([]*revocations.Stapler, error) {
+
+	var staplers []*revocations.Stapler
+
+	for _, certificate := range certificates {
+
+		stapler, err := revocations.NewStapler(certificate, issuerOf(certificate, issuers), responder, handler)
+		if err == nil {
+			err = stapler.Start()
+		}
+
+		if err != nil {
+			for _, started := range staplers {
+				started.Stop()
+			}
+			return nil, err
+		}
+
+		staplers = append(staplers, stapler)
+	}
+
+	return staplers, nil
+}
+
+// issuerOf returns the candidate that issued the leaf of a certificate or nil if there is no such candidate.
+func issuerOf(certificate tls.Certificate, candidates []*x509.Certificate) *x509.Certificate {
+
+	if len(certificate.Certificate) == 0 {
+		return nil
+	}
+
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return nil
+	}
+
+	for _, candidate := range candidates {
+		if identities.IssuedBy(leaf, candidate) {
+			return candidate
+		}
+	}
+
+	return nil
 }
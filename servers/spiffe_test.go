@@ -0,0 +1,288 @@
+// Copyright 2019 Decipher Technology Studios
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package servers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/deciphernow/nautls/clients"
+	"github.com/deciphernow/nautls/identities"
+	"github.com/deciphernow/nautls/internal/tests/identitytest"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// MustHandshake performs a TLS handshake between a server and client configuration over a loopback listener and returns
+// the errors of the server and client handshakes.
+func MustHandshake(server *tls.Config, client *tls.Config, t *testing.T) (error, error) {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening [%s]", err.Error())
+	}
+	defer listener.Close()
+
+	errs := make(chan error, 1)
+
+	go func() {
+		connection, err := listener.Accept()
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer connection.Close()
+		errs <- tls.Server(connection, server).Handshake()
+	}()
+
+	connection, err := tls.Dial("tcp", listener.Addr().String(), client)
+	if err == nil {
+		connection.Close()
+	}
+
+	return <-errs, err
+}
+
+func TestSPIFFE(t *testing.T) {
+
+	Convey("When authorizing peers by SPIFFE ID", t, func() {
+
+		template, err := identities.RootTemplate(pkix.Name{CommonName: "NauTLS (SPIFFE)"})
+		So(err, ShouldBeNil)
+
+		authority, err := identities.Self(template, identities.ECDSA, 256)
+		So(err, ShouldBeNil)
+
+		bundle, err := identities.EncodeSPIFFEBundle([]*x509.Certificate{authority.Certificate})
+		So(err, ShouldBeNil)
+
+		bundles := map[string]string{"nautls.com": "base64:///" + url.PathEscape(base64.StdEncoding.EncodeToString(bundle))}
+
+		server := mustSVID(authority, "spiffe://nautls.com/server", t)
+		client := mustSVID(authority, "spiffe://nautls.com/client", t)
+
+		serverBuilder := NewSecurityBuilder().
+			WithAuthentication(Authentication(tls.RequireAndVerifyClientCert)).
+			WithIdentity(server).
+			WithSPIFFEBundles(bundles)
+
+		clientBuilder := clients.NewSecurityBuilder().
+			WithIdentity(client).
+			WithSPIFFEBundles(bundles)
+
+		Convey("with authorized identifiers", func() {
+
+			serverConfig, err := serverBuilder.WithSPIFFEIDs([]string{"spiffe://nautls.com/client"}).Build()
+			So(err, ShouldBeNil)
+
+			clientConfig, err := clientBuilder.WithSPIFFEIDs([]string{"spiffe://nautls.com/server"}).Build()
+			So(err, ShouldBeNil)
+
+			serverErr, clientErr := MustHandshake(serverConfig, clientConfig, t)
+
+			Convey("it completes the handshake", func() {
+				So(serverErr, ShouldBeNil)
+				So(clientErr, ShouldBeNil)
+			})
+		})
+
+		Convey("with authorized trust domains", func() {
+
+			serverConfig, err := serverBuilder.WithSPIFFETrustDomains([]string{"nautls.com"}).Build()
+			So(err, ShouldBeNil)
+
+			clientConfig, err := clientBuilder.WithSPIFFETrustDomains([]string{"nautls.com"}).Build()
+			So(err, ShouldBeNil)
+
+			serverErr, clientErr := MustHandshake(serverConfig, clientConfig, t)
+
+			Convey("it completes the handshake", func() {
+				So(serverErr, ShouldBeNil)
+				So(clientErr, ShouldBeNil)
+			})
+		})
+
+		Convey("with an unauthorized server", func() {
+
+			serverConfig, err := serverBuilder.Build()
+			So(err, ShouldBeNil)
+
+			clientConfig, err := clientBuilder.WithSPIFFEIDs([]string{"spiffe://nautls.com/other"}).Build()
+			So(err, ShouldBeNil)
+
+			_, clientErr := MustHandshake(serverConfig, clientConfig, t)
+
+			Convey("the client rejects the handshake", func() {
+				So(clientErr, ShouldNotBeNil)
+			})
+		})
+
+		Convey("with an unauthorized client", func() {
+
+			serverConfig, err := serverBuilder.WithSPIFFETrustDomains([]string{"nautls.org"}).Build()
+			So(err, ShouldBeNil)
+
+			clientConfig, err := clientBuilder.WithSPIFFETrustDomains([]string{"nautls.com"}).Build()
+			So(err, ShouldBeNil)
+
+			serverErr, _ := MustHandshake(serverConfig, clientConfig, t)
+
+			Convey("the server rejects the handshake", func() {
+				So(serverErr, ShouldNotBeNil)
+			})
+		})
+
+		Convey("with a server certificate that is not an svid", func() {
+
+			leaf, err := authority.Issue(identitytest.MustServerTemplate("nautls.com", t), identities.ECDSA, 256)
+			So(err, ShouldBeNil)
+
+			serverConfig, err := NewSecurityBuilder().WithIdentity(leaf).Build()
+			So(err, ShouldBeNil)
+
+			clientConfig, err := clientBuilder.WithSPIFFETrustDomains([]string{"nautls.com"}).Build()
+			So(err, ShouldBeNil)
+
+			_, clientErr := MustHandshake(serverConfig, clientConfig, t)
+
+			Convey("the client rejects the handshake", func() {
+				So(clientErr, ShouldNotBeNil)
+			})
+		})
+
+		Convey("with an svid issued for another trust domain by the authority of a trust domain", func() {
+
+			other := identitytest.MustAuthority("NauTLS (Other)", t)
+
+			otherBundle, err := identities.EncodeSPIFFEBundle([]*x509.Certificate{other.Certificate})
+			So(err, ShouldBeNil)
+
+			bundles["nautls.org"] = "base64:///" + url.PathEscape(base64.StdEncoding.EncodeToString(otherBundle))
+
+			serverConfig, err := NewSecurityBuilder().WithIdentity(mustSVID(authority, "spiffe://nautls.org/server", t)).Build()
+			So(err, ShouldBeNil)
+
+			clientConfig, err := clientBuilder.WithSPIFFEBundles(bundles).WithSPIFFETrustDomains([]string{"nautls.com", "nautls.org"}).Build()
+			So(err, ShouldBeNil)
+
+			_, clientErr := MustHandshake(serverConfig, clientConfig, t)
+
+			Convey("the client rejects the handshake", func() {
+				So(clientErr, ShouldNotBeNil)
+			})
+		})
+
+		Convey("without spiffe bundles", func() {
+
+			Convey("and without authorities", func() {
+
+				_, serverErr := NewSecurityBuilder().WithIdentity(server).WithSPIFFETrustDomains([]string{"nautls.com"}).Build()
+				_, clientErr := clients.NewSecurityBuilder().WithIdentity(client).WithSPIFFETrustDomains([]string{"nautls.com"}).Build()
+
+				Convey("it returns errors", func() {
+					So(serverErr, ShouldNotBeNil)
+					So(clientErr, ShouldNotBeNil)
+				})
+			})
+
+			Convey("and with an authority without a spiffe id", func() {
+
+				_, err := clients.NewSecurityBuilder().
+					WithAuthorityCertificates(authority.Certificate).
+					WithIdentity(client).
+					WithSPIFFETrustDomains([]string{"nautls.com"}).
+					Build()
+
+				Convey("it returns an error", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("and with an authority with the spiffe id of the trust domain", func() {
+
+				template, err := identities.RootTemplate(pkix.Name{CommonName: "NauTLS (SPIFFE Domain)"})
+				So(err, ShouldBeNil)
+
+				template.URIs = []*url.URL{{Scheme: "spiffe", Host: "nautls.com"}}
+
+				domain, err := identities.Self(template, identities.ECDSA, 256)
+				So(err, ShouldBeNil)
+
+				serverConfig, err := NewSecurityBuilder().
+					WithAuthentication(Authentication(tls.RequireAndVerifyClientCert)).
+					WithAuthorityCertificates(domain.Certificate).
+					WithIdentity(mustSVID(domain, "spiffe://nautls.com/server", t)).
+					WithSPIFFETrustDomains([]string{"nautls.com"}).
+					Build()
+				So(err, ShouldBeNil)
+
+				clientConfig, err := clients.NewSecurityBuilder().
+					WithAuthorityCertificates(domain.Certificate).
+					WithIdentity(mustSVID(domain, "spiffe://nautls.com/client", t)).
+					WithSPIFFETrustDomains([]string{"nautls.com"}).
+					Build()
+				So(err, ShouldBeNil)
+
+				serverErr, clientErr := MustHandshake(serverConfig, clientConfig, t)
+
+				Convey("it completes the handshake", func() {
+					So(serverErr, ShouldBeNil)
+					So(clientErr, ShouldBeNil)
+				})
+			})
+		})
+
+		Convey("with an svid from an untrusted authority", func() {
+
+			template, err := identities.RootTemplate(pkix.Name{CommonName: "NauTLS (Other)"})
+			So(err, ShouldBeNil)
+
+			other, err := identities.Self(template, identities.ECDSA, 256)
+			So(err, ShouldBeNil)
+
+			serverConfig, err := NewSecurityBuilder().WithIdentity(mustSVID(other, "spiffe://nautls.com/server", t)).Build()
+			So(err, ShouldBeNil)
+
+			clientConfig, err := clientBuilder.WithSPIFFETrustDomains([]string{"nautls.com"}).Build()
+			So(err, ShouldBeNil)
+
+			_, clientErr := MustHandshake(serverConfig, clientConfig, t)
+
+			Convey("the client rejects the handshake", func() {
+				So(clientErr, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func mustSVID(authority *identities.Identity, id string, t *testing.T) *identities.Identity {
+
+	template, err := identities.SVIDTemplate(id)
+	if err != nil {
+		t.Fatalf("error creating svid template [%s]", err.Error())
+	}
+
+	svid, err := authority.Issue(template, identities.ECDSA, 256)
+	if err != nil {
+		t.Fatalf("error issuing svid [%s]", err.Error())
+	}
+
+	return svid
+}